@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+// BitcoindClient structure of the bitcoind json-rpc client
+type BitcoindClient struct {
+	*http.Client
+	url      string
+	user     string
+	password string
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      string        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Bitcoind instance of the BitcoindClient api
+var Bitcoind *BitcoindClient
+
+// InitBitcoindClient initialize an instance of Bitcoind
+func InitBitcoindClient() {
+	Bitcoind = &BitcoindClient{
+		Client:   &http.Client{},
+		url:      env.EnvVars.BitcoindURL,
+		user:     env.EnvVars.BitcoindUser,
+		password: env.EnvVars.BitcoindPassword,
+	}
+}
+
+// PushTransaction broadcast a hex encoded transaction to the network
+func (b *BitcoindClient) PushTransaction(rawTx string) error {
+	var hash string
+	return b.call("sendrawtransaction", []interface{}{rawTx}, &hash)
+}
+
+func (b *BitcoindClient) call(method string, params []interface{}, i interface{}) error {
+	body, err := json.Marshal(&rpcRequest{JSONRPC: "1.0", ID: method, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(b.user, b.password)
+	req.Header.Set("content-type", "application/json")
+
+	rsp, err := b.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+
+	// bitcoind answers rpc errors with a 500 status and an error object
+	var out rpcResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return fmt.Errorf("expected json-rpc response, got %s: %s", rsp.Status, string(data))
+	}
+	if out.Error != nil {
+		return fmt.Errorf("%s failed with code %d: %s", method, out.Error.Code, out.Error.Message)
+	}
+
+	return json.Unmarshal(out.Result, i)
+}
+
+// EstimateFeeRate get the fee rate (sat/vB) estimated to confirm within target blocks
+func (b *BitcoindClient) EstimateFeeRate(target int) (float64, error) {
+	var estimate struct {
+		FeeRate float64  `json:"feerate"`
+		Errors  []string `json:"errors"`
+	}
+	if err := b.call("estimatesmartfee", []interface{}{target}, &estimate); err != nil {
+		return 0, err
+	}
+	if len(estimate.Errors) > 0 {
+		return 0, fmt.Errorf("estimatesmartfee: %s", estimate.Errors[0])
+	}
+
+	// bitcoind estimates are in btc per kvB
+	return estimate.FeeRate * 1e5, nil
+}
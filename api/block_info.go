@@ -6,13 +6,17 @@ import (
 	"io/ioutil"
 	"math/big"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/SoteriaTech/blockchain-functions/btc"
 )
 
 const (
 	baseURL string = "https://blockchain.info"
+	// rawaddrLimit maximum number of transactions of a rawaddr page
+	rawaddrLimit int = 50
 )
 
 // BlockInfoClient structure of the blockInfo api client
@@ -21,12 +25,13 @@ type BlockInfoClient struct {
 }
 
 type bIAccount struct {
-	Address       string  `json:"address"`
-	FinalBalance  big.Int `json:"final_balance"`
-	TotalReceived big.Int `json:"total_received"`
-	TotalSent     big.Int `json:"total_sent"`
-	NTx           big.Int `json:"n_tx"`
-	NUnredeemed   big.Int `json:"n_unredeemed"`
+	Address       string    `json:"address"`
+	FinalBalance  big.Int   `json:"final_balance"`
+	TotalReceived big.Int   `json:"total_received"`
+	TotalSent     big.Int   `json:"total_sent"`
+	NTx           big.Int   `json:"n_tx"`
+	NUnredeemed   big.Int   `json:"n_unredeemed"`
+	Txs           []*btc.Tx `json:"txs"`
 }
 
 // BlockInfo instance of the BlockInfoClient api
@@ -80,6 +85,9 @@ func (b *BlockInfoClient) GetTransactionsFromBlock(block *btc.Block) ([]*btc.Tra
 	for _, tx := range block.Txs {
 		txs = append(txs, parseTx(&tx, block.Height)...)
 	}
+	for _, t := range txs {
+		t.BlockTime = block.Time
+	}
 	return txs, errs
 }
 
@@ -93,32 +101,122 @@ func (b *BlockInfoClient) GetTransactionByHash(hash string) (tx *btc.Transaction
 	return tx, nil
 }
 
+// GetTransaction get the inputs and outputs of a transaction from its hash
+func (b *BlockInfoClient) GetTransaction(hash string) (txs []*btc.Transaction, err error) {
+	tx := &btc.Tx{}
+	if err = b.request("/rawtx/"+hash, tx, false); err != nil {
+		return nil, err
+	}
+	txs = parseTx(tx, tx.BlockHeight)
+	for _, t := range txs {
+		t.BlockTime = tx.Time
+	}
+	return txs, nil
+}
+
+// GetAddressHistory get the inputs and outputs of the confirmed transactions involving the given address, going
+// through every page of rawaddr
+func (b *BlockInfoClient) GetAddressHistory(address string) (txs []*btc.Transaction, err error) {
+	for offset := 0; ; offset += rawaddrLimit {
+		acc := &bIAccount{}
+		endpoint := fmt.Sprintf("/rawaddr/%s?limit=%d&offset=%d", address, rawaddrLimit, offset)
+		if err = b.request(endpoint, acc, false); err != nil {
+			return nil, err
+		}
+
+		for _, tx := range acc.Txs {
+			// unconfirmed transactions are picked up by the block scan once mined
+			if tx.BlockHeight == 0 {
+				continue
+			}
+			for _, t := range parseTx(tx, tx.BlockHeight) {
+				if t.Address != address {
+					continue
+				}
+				t.BlockTime = tx.Time
+				txs = append(txs, t)
+			}
+		}
+
+		if len(acc.Txs) < rawaddrLimit {
+			return txs, nil
+		}
+	}
+}
+
+// GetAddressMempool get the inputs and outputs of the unconfirmed transactions involving the given address, which
+// rawaddr lists first
+func (b *BlockInfoClient) GetAddressMempool(address string) (txs []*btc.Transaction, err error) {
+	acc := &bIAccount{}
+	if err = b.request(fmt.Sprintf("/rawaddr/%s?limit=%d", address, rawaddrLimit), acc, false); err != nil {
+		return nil, err
+	}
+
+	for _, tx := range acc.Txs {
+		if tx.BlockHeight != 0 {
+			continue
+		}
+		for _, t := range parseTx(tx, 0) {
+			if t.Address == address {
+				txs = append(txs, t)
+			}
+		}
+	}
+	return txs, nil
+}
+
+// GetRawTransaction get the hex encoded transaction from its hash
+func (b *BlockInfoClient) GetRawTransaction(hash string) (string, error) {
+	data, err := b.read(b.Get(baseURL + "/rawtx/" + hash + "?format=hex"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// PushTransaction broadcast a hex encoded transaction to the network
+func (b *BlockInfoClient) PushTransaction(rawTx string) error {
+	_, err := b.read(b.PostForm(baseURL+"/pushtx", url.Values{"tx": {rawTx}}))
+	return err
+}
+
 func (b *BlockInfoClient) request(endpoint string, i interface{}, isJSON bool) error {
 	fullPath := baseURL + endpoint
 	if isJSON {
 		fullPath = baseURL + endpoint + "?format=json"
 	}
 
-	rsp, err := b.Get(fullPath)
+	data, err := b.read(b.Get(fullPath))
 	if err != nil {
 		return err
 	}
 
+	return json.Unmarshal(data, &i)
+}
+
+func (b *BlockInfoClient) read(rsp *http.Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
 	defer rsp.Body.Close()
 	data, err := ioutil.ReadAll(rsp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if rsp.Status[0] != '2' {
-		return fmt.Errorf("expected status 2xx, got %s: %s", rsp.Status, string(data))
+		return nil, fmt.Errorf("expected status 2xx, got %s: %s", rsp.Status, string(data))
 	}
 
-	return json.Unmarshal(data, &i)
+	return data, nil
 }
 
 func parseTx(tx *btc.Tx, height int) (ts []*btc.Transaction) {
 
+	ins := parseInTxs(tx.Inputs, tx.Hash, height)
+	ts = append(ts, ins...)
+
 	outs := parseOutTxs(tx.Out, tx.Hash, height)
 	ts = append(ts, outs...)
 
@@ -133,6 +231,7 @@ func parseOutTxs(out []*btc.Out, hash string, height int) (ts []*btc.Transaction
 			Value:       o.Value,
 			TxIndex:     o.TxIndex,
 			N:           o.N,
+			Script:      o.Script,
 			BlockHeight: height,
 		}
 		ts = append(ts, t)
@@ -153,7 +252,9 @@ func parseInTxs(in []*btc.Inputs, hash string, height int) (ts []*btc.Transactio
 			Value:       *sentValue,
 			TxIndex:     i.PrevOut.TxIndex,
 			N:           i.PrevOut.N,
+			Script:      i.PrevOut.Script,
 			BlockHeight: height,
+			Sequence:    int64(i.Sequence),
 		}
 		ts = append(ts, t)
 	}
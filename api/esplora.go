@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+// EsploraClient structure of the esplora api client
+type EsploraClient struct {
+	*http.Client
+	baseURL string
+}
+
+// Esplora instance of the EsploraClient api
+var Esplora *EsploraClient
+
+// InitEsploraClient initialize an instance of Esplora
+func InitEsploraClient() {
+	Esplora = &EsploraClient{
+		Client:  &http.Client{},
+		baseURL: strings.TrimSuffix(env.EnvVars.EsploraURL, "/"),
+	}
+}
+
+// PushTransaction broadcast a hex encoded transaction to the network
+func (e *EsploraClient) PushTransaction(rawTx string) error {
+	_, err := e.read(e.Post(e.baseURL+"/tx", "text/plain", strings.NewReader(rawTx)))
+	return err
+}
+
+func (e *EsploraClient) read(rsp *http.Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.Status[0] != '2' {
+		return nil, fmt.Errorf("expected status 2xx, got %s: %s", rsp.Status, string(data))
+	}
+
+	return data, nil
+}
+
+// EstimateFeeRate get the fee rate (sat/vB) estimated to confirm within target blocks
+func (e *EsploraClient) EstimateFeeRate(target int) (float64, error) {
+	data, err := e.read(e.Get(e.baseURL + "/fee-estimates"))
+	if err != nil {
+		return 0, err
+	}
+
+	estimates := make(map[string]float64)
+	if err := json.Unmarshal(data, &estimates); err != nil {
+		return 0, err
+	}
+
+	rate, ok := estimates[strconv.Itoa(target)]
+	if !ok {
+		return 0, fmt.Errorf("no fee estimate for a target of %d blocks", target)
+	}
+	return rate, nil
+}
+
+// esploraPageSize number of confirmed transactions of an address returned per page
+const esploraPageSize = 25
+
+type esploraTx struct {
+	Txid string `json:"txid"`
+	Vin  []struct {
+		Vout     int         `json:"vout"`
+		Prevout  *esploraOut `json:"prevout"`
+		Sequence int64       `json:"sequence"`
+	} `json:"vin"`
+	Vout   []*esploraOut `json:"vout"`
+	Status struct {
+		Confirmed   bool `json:"confirmed"`
+		BlockHeight int  `json:"block_height"`
+		BlockTime   int  `json:"block_time"`
+	} `json:"status"`
+}
+
+type esploraOut struct {
+	Script  string `json:"scriptpubkey"`
+	Address string `json:"scriptpubkey_address"`
+	Value   int64  `json:"value"`
+	N       int    `json:"-"`
+}
+
+// GetAddressHistory get the inputs and outputs of the confirmed transactions involving the given address, going
+// through every page of /address/:address/txs/chain. Esplora has no transaction index, TxIndex is left empty
+func (e *EsploraClient) GetAddressHistory(address string) (txs []*btc.Transaction, err error) {
+	lastSeen := ""
+	for {
+		endpoint := e.baseURL + "/address/" + address + "/txs/chain"
+		if lastSeen != "" {
+			endpoint += "/" + lastSeen
+		}
+		data, errGet := e.read(e.Get(endpoint))
+		if errGet != nil {
+			return nil, errGet
+		}
+
+		var page []*esploraTx
+		if err = json.Unmarshal(data, &page); err != nil {
+			return nil, err
+		}
+
+		for _, tx := range page {
+			if !tx.Status.Confirmed {
+				continue
+			}
+			for _, in := range tx.Vin {
+				if in.Prevout == nil || in.Prevout.Address != address {
+					continue
+				}
+				in.Prevout.N = in.Vout
+				txs = append(txs, parseEsploraOut(tx, in.Prevout, true))
+			}
+			for n, out := range tx.Vout {
+				if out.Address != address {
+					continue
+				}
+				out.N = n
+				txs = append(txs, parseEsploraOut(tx, out, false))
+			}
+		}
+
+		if len(page) < esploraPageSize {
+			return txs, nil
+		}
+		lastSeen = page[len(page)-1].Txid
+	}
+}
+
+// GetTransaction get the inputs and outputs of a transaction from /tx/:txid, the inputs of coinbase transactions
+// are left out
+func (e *EsploraClient) GetTransaction(hash string) (txs []*btc.Transaction, err error) {
+	data, err := e.read(e.Get(e.baseURL + "/tx/" + hash))
+	if err != nil {
+		return nil, err
+	}
+	tx := &esploraTx{}
+	if err = json.Unmarshal(data, tx); err != nil {
+		return nil, err
+	}
+
+	for _, in := range tx.Vin {
+		if in.Prevout == nil {
+			continue
+		}
+		in.Prevout.N = in.Vout
+		t := parseEsploraOut(tx, in.Prevout, true)
+		t.Sequence = in.Sequence
+		txs = append(txs, t)
+	}
+	for n, out := range tx.Vout {
+		out.N = n
+		txs = append(txs, parseEsploraOut(tx, out, false))
+	}
+	return txs, nil
+}
+
+// GetAddressMempool get the inputs and outputs of the unconfirmed transactions involving the given address, from
+// /address/:address/txs/mempool
+func (e *EsploraClient) GetAddressMempool(address string) (txs []*btc.Transaction, err error) {
+	data, err := e.read(e.Get(e.baseURL + "/address/" + address + "/txs/mempool"))
+	if err != nil {
+		return nil, err
+	}
+	var page []*esploraTx
+	if err = json.Unmarshal(data, &page); err != nil {
+		return nil, err
+	}
+
+	for _, tx := range page {
+		for _, in := range tx.Vin {
+			if in.Prevout == nil || in.Prevout.Address != address {
+				continue
+			}
+			in.Prevout.N = in.Vout
+			txs = append(txs, parseEsploraOut(tx, in.Prevout, true))
+		}
+		for n, out := range tx.Vout {
+			if out.Address != address {
+				continue
+			}
+			out.N = n
+			txs = append(txs, parseEsploraOut(tx, out, false))
+		}
+	}
+	return txs, nil
+}
+
+func parseEsploraOut(tx *esploraTx, out *esploraOut, spent bool) *btc.Transaction {
+	value := big.NewInt(out.Value)
+	if spent {
+		value.Neg(value)
+	}
+	return &btc.Transaction{
+		Hash:        tx.Txid,
+		Address:     out.Address,
+		Value:       *value,
+		N:           out.N,
+		Script:      out.Script,
+		BlockHeight: tx.Status.BlockHeight,
+		BlockTime:   tx.Status.BlockTime,
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEsploraGetTransaction(t *testing.T) {
+	var uri string
+	srv := priceServer(t, "/tx/ab01", 200, `{
+		"txid": "ab01",
+		"vin": [
+			{"vout": 3, "sequence": 4294967293, "prevout": {"scriptpubkey": "0014aa", "scriptpubkey_address": "bc1qsender", "value": 70000}},
+			{"vout": 0, "sequence": 4294967295, "prevout": null}
+		],
+		"vout": [
+			{"scriptpubkey": "0014bb", "scriptpubkey_address": "bc1qdest", "value": 50000},
+			{"scriptpubkey": "0014aa", "scriptpubkey_address": "bc1qsender", "value": 19000}
+		],
+		"status": {"confirmed": true, "block_height": 680000, "block_time": 1618000000}
+	}`, &uri)
+
+	e := &EsploraClient{Client: http.DefaultClient, baseURL: srv.URL}
+	txs, err := e.GetTransaction("ab01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 3 {
+		t.Fatalf("got %d inputs and outputs, want the spent input and both outputs", len(txs))
+	}
+
+	in := txs[0]
+	if !in.IsInput() || in.Address != "bc1qsender" || in.Value.Int64() != -70000 || in.N != 3 || !in.SignalsRBF() {
+		t.Fatalf("input = %+v", in)
+	}
+	for i, want := range []struct {
+		address string
+		value   int64
+	}{{"bc1qdest", 50000}, {"bc1qsender", 19000}} {
+		out := txs[i+1]
+		if out.IsInput() || out.Address != want.address || out.Value.Int64() != want.value || out.N != i {
+			t.Fatalf("output %d = %+v", i, out)
+		}
+		if out.Hash != "ab01" || out.BlockHeight != 680000 || out.BlockTime != 1618000000 {
+			t.Fatalf("output %d isn't dated by its block: %+v", i, out)
+		}
+	}
+}
+
+func TestEsploraGetTransactionNotFound(t *testing.T) {
+	var uri string
+	srv := priceServer(t, "/tx/ab01", 200, `{}`, &uri)
+
+	e := &EsploraClient{Client: http.DefaultClient, baseURL: srv.URL}
+	if _, err := e.GetTransaction("cd02"); err == nil {
+		t.Fatal("got a transaction the provider doesn't know")
+	}
+}
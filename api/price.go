@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/price"
+)
+
+// priceTimeout time after which a price source is considered unavailable
+const priceTimeout = 10 * time.Second
+
+// priceClient http client of an exchange rest api
+type priceClient struct {
+	*http.Client
+	baseURL string
+}
+
+func newPriceClient(baseURL string) priceClient {
+	return priceClient{
+		Client:  &http.Client{Timeout: priceTimeout},
+		baseURL: baseURL,
+	}
+}
+
+func (p *priceClient) request(endpoint string, i interface{}) error {
+	rsp, err := p.Get(p.baseURL + endpoint)
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+
+	if rsp.Status[0] != '2' {
+		return fmt.Errorf("expected status 2xx, got %s: %s", rsp.Status, string(data))
+	}
+
+	return json.Unmarshal(data, i)
+}
+
+// CoinbaseClient structure of the coinbase api client
+type CoinbaseClient struct {
+	priceClient
+}
+
+// Coinbase instance of the CoinbaseClient api
+var Coinbase *CoinbaseClient
+
+// InitCoinbaseClient initialize an instance of Coinbase
+func InitCoinbaseClient() {
+	Coinbase = NewCoinbaseClient("https://api.coinbase.com/v2")
+}
+
+// NewCoinbaseClient create a coinbase client of the api served at baseURL
+func NewCoinbaseClient(baseURL string) *CoinbaseClient {
+	return &CoinbaseClient{newPriceClient(baseURL)}
+}
+
+type coinbasePrice struct {
+	Data struct {
+		Base     string `json:"base"`
+		Currency string `json:"currency"`
+		Amount   string `json:"amount"`
+	} `json:"data"`
+}
+
+// GetRate get the spot exchange rate of a currency pair
+func (c *CoinbaseClient) GetRate(base, quote string) (*price.Rate, error) {
+	return c.spot(base, quote, "", time.Now())
+}
+
+// GetHistoricalRate get the spot exchange rate of a currency pair on the day of t
+func (c *CoinbaseClient) GetHistoricalRate(base, quote string, t time.Time) (*price.Rate, error) {
+	day := t.UTC().Truncate(24 * time.Hour)
+	return c.spot(base, quote, "?date="+day.Format("2006-01-02"), day)
+}
+
+func (c *CoinbaseClient) spot(base, quote, query string, t time.Time) (*price.Rate, error) {
+	p := &coinbasePrice{}
+	if err := c.request("/prices/"+base+"-"+quote+"/spot"+query, p); err != nil {
+		return nil, err
+	}
+
+	value, err := strconv.ParseFloat(p.Data.Amount, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &price.Rate{Base: base, Quote: quote, Value: value, Time: t}, nil
+}
+
+// KrakenClient structure of the kraken api client
+type KrakenClient struct {
+	priceClient
+}
+
+// Kraken instance of the KrakenClient api
+var Kraken *KrakenClient
+
+// InitKrakenClient initialize an instance of Kraken
+func InitKrakenClient() {
+	Kraken = NewKrakenClient("https://api.kraken.com/0/public")
+}
+
+// NewKrakenClient create a kraken client of the api served at baseURL
+func NewKrakenClient(baseURL string) *KrakenClient {
+	return &KrakenClient{newPriceClient(baseURL)}
+}
+
+type krakenTicker struct {
+	Error  []string `json:"error"`
+	Result map[string]struct {
+		// Close last trade closed, as [price, volume]
+		Close []string `json:"c"`
+	} `json:"result"`
+}
+
+// GetRate get the price of the last trade of a currency pair
+func (k *KrakenClient) GetRate(base, quote string) (*price.Rate, error) {
+	pair := krakenAsset(base) + krakenAsset(quote)
+	t := &krakenTicker{}
+	if err := k.request("/Ticker?pair="+pair, t); err != nil {
+		return nil, err
+	}
+	if len(t.Error) > 0 {
+		return nil, errors.New(strings.Join(t.Error, ", "))
+	}
+
+	// results are keyed by the kraken name of the pair, eg. XXBTZEUR for XBTEUR
+	for _, r := range t.Result {
+		if len(r.Close) == 0 {
+			break
+		}
+		value, err := strconv.ParseFloat(r.Close[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		return &price.Rate{Base: base, Quote: quote, Value: value, Time: time.Now()}, nil
+	}
+	return nil, fmt.Errorf("no ticker for %s", pair)
+}
+
+func krakenAsset(currency string) string {
+	if currency == "BTC" {
+		return "XBT"
+	}
+	return currency
+}
+
+// BitstampClient structure of the bitstamp api client
+type BitstampClient struct {
+	priceClient
+}
+
+// Bitstamp instance of the BitstampClient api
+var Bitstamp *BitstampClient
+
+// InitBitstampClient initialize an instance of Bitstamp
+func InitBitstampClient() {
+	Bitstamp = NewBitstampClient("https://www.bitstamp.net/api/v2")
+}
+
+// NewBitstampClient create a bitstamp client of the api served at baseURL
+func NewBitstampClient(baseURL string) *BitstampClient {
+	return &BitstampClient{newPriceClient(baseURL)}
+}
+
+type bitstampTicker struct {
+	Last      string `json:"last"`
+	Timestamp string `json:"timestamp"`
+}
+
+// GetRate get the price of the last trade of a currency pair
+func (b *BitstampClient) GetRate(base, quote string) (*price.Rate, error) {
+	t := &bitstampTicker{}
+	if err := b.request("/ticker/"+strings.ToLower(base+quote)+"/", t); err != nil {
+		return nil, err
+	}
+
+	value, err := strconv.ParseFloat(t.Last, 64)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := strconv.ParseInt(t.Timestamp, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &price.Rate{Base: base, Quote: quote, Value: value, Time: time.Unix(ts, 0)}, nil
+}
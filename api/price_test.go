@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// priceServer serve body with the given status on the path, recording the requested uri
+func priceServer(t *testing.T, path string, status int, body string, uri *string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*uri = r.URL.RequestURI()
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCoinbaseGetRate(t *testing.T) {
+	var uri string
+	srv := priceServer(t, "/prices/BTC-USD/spot", 200, `{"data":{"base":"BTC","currency":"USD","amount":"48250.12"}}`, &uri)
+
+	r, err := NewCoinbaseClient(srv.URL).GetRate("BTC", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Value != 48250.12 || r.Base != "BTC" || r.Quote != "USD" {
+		t.Fatalf("rate = %+v", r)
+	}
+	if uri != "/prices/BTC-USD/spot" {
+		t.Fatalf("requested %s", uri)
+	}
+}
+
+func TestCoinbaseGetHistoricalRate(t *testing.T) {
+	var uri string
+	srv := priceServer(t, "/prices/BTC-EUR/spot", 200, `{"data":{"base":"BTC","currency":"EUR","amount":"30000"}}`, &uri)
+
+	at := time.Date(2021, 2, 3, 15, 4, 5, 0, time.UTC)
+	r, err := NewCoinbaseClient(srv.URL).GetHistoricalRate("BTC", "EUR", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri != "/prices/BTC-EUR/spot?date=2021-02-03" {
+		t.Fatalf("requested %s", uri)
+	}
+	if r.Value != 30000 || !r.Time.Equal(time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("rate = %+v, want 30000 at the start of the day", r)
+	}
+}
+
+func TestKrakenGetRate(t *testing.T) {
+	var uri string
+	srv := priceServer(t, "/Ticker", 200, `{"error":[],"result":{"XXBTZUSD":{"a":["48300.0","1","1.000"],"c":["48291.5","0.01"]}}}`, &uri)
+
+	r, err := NewKrakenClient(srv.URL).GetRate("BTC", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri != "/Ticker?pair=XBTUSD" {
+		t.Fatalf("requested %s, want the kraken name of btc", uri)
+	}
+	if r.Value != 48291.5 || r.Base != "BTC" || r.Quote != "USD" {
+		t.Fatalf("rate = %+v", r)
+	}
+}
+
+func TestBitstampGetRate(t *testing.T) {
+	var uri string
+	srv := priceServer(t, "/ticker/btcusd/", 200, `{"last":"48275.00","timestamp":"1614600000","volume":"1.5"}`, &uri)
+
+	r, err := NewBitstampClient(srv.URL).GetRate("BTC", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Value != 48275 || !r.Time.Equal(time.Unix(1614600000, 0)) {
+		t.Fatalf("rate = %+v", r)
+	}
+}
+
+func TestPriceClientErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+		get    func(baseURL string) error
+		err    string
+	}{
+		{"coinbase error status", "/prices/BTC-USD/spot", 404, `{"errors":[{"id":"not_found"}]}`, func(u string) error {
+			_, err := NewCoinbaseClient(u).GetRate("BTC", "USD")
+			return err
+		}, "expected status 2xx"},
+		{"coinbase invalid amount", "/prices/BTC-USD/spot", 200, `{"data":{"amount":"n/a"}}`, func(u string) error {
+			_, err := NewCoinbaseClient(u).GetRate("BTC", "USD")
+			return err
+		}, "invalid syntax"},
+		{"kraken api error", "/Ticker", 200, `{"error":["EQuery:Unknown asset pair"]}`, func(u string) error {
+			_, err := NewKrakenClient(u).GetRate("BTC", "USD")
+			return err
+		}, "EQuery:Unknown asset pair"},
+		{"kraken no ticker", "/Ticker", 200, `{"error":[],"result":{}}`, func(u string) error {
+			_, err := NewKrakenClient(u).GetRate("BTC", "USD")
+			return err
+		}, "no ticker for XBTUSD"},
+		{"kraken no trade", "/Ticker", 200, `{"error":[],"result":{"XXBTZUSD":{"c":[]}}}`, func(u string) error {
+			_, err := NewKrakenClient(u).GetRate("BTC", "USD")
+			return err
+		}, "no ticker for XBTUSD"},
+		{"bitstamp error status", "/ticker/btcusd/", 500, `oops`, func(u string) error {
+			_, err := NewBitstampClient(u).GetRate("BTC", "USD")
+			return err
+		}, "expected status 2xx"},
+		{"bitstamp invalid timestamp", "/ticker/btcusd/", 200, `{"last":"1","timestamp":"now"}`, func(u string) error {
+			_, err := NewBitstampClient(u).GetRate("BTC", "USD")
+			return err
+		}, "invalid syntax"},
+		{"malformed json", "/ticker/btcusd/", 200, `{"last":`, func(u string) error {
+			_, err := NewBitstampClient(u).GetRate("BTC", "USD")
+			return err
+		}, "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var uri string
+			srv := priceServer(t, tt.path, tt.status, tt.body, &uri)
+			if err := tt.get(srv.URL); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
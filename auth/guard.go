@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// Authorize authenticate the caller of an HTTP function, restricting it to admins if required
+func Authorize(r *http.Request, admin bool) (*Token, *utils.ErrorService) {
+	t, err := Verifier.Authenticate(r)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 401, Err: err}
+	}
+	if admin && !Verifier.IsAdmin(t) {
+		return nil, &utils.ErrorService{Code: 403, Err: errors.New("admin role required")}
+	}
+	return t, nil
+}
+
+// TargetUID uid a request acts on: admins may act on the uid they give, users always act on their own
+func TargetUID(t *Token, uid string) string {
+	if uid != "" && Verifier.IsAdmin(t) {
+		return uid
+	}
+	return t.UID
+}
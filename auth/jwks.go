@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKeysTTL how long keys are cached when the source doesn't tell
+	defaultKeysTTL = time.Hour
+	// minRefreshInterval minimum delay between two refreshes triggered by an unknown key id
+	minRefreshInterval = time.Minute
+)
+
+var maxAgeRegexp = regexp.MustCompile(`max-age=(\d+)`)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// KeySet RSA public keys of a JWKS source, cached until they expire
+type KeySet struct {
+	source      string
+	client      *http.Client
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	expiresAt   time.Time
+	refreshedAt time.Time
+}
+
+// NewKeySet create a key set loaded from a JWKS url, or from a local file if source is not an http(s) url
+func NewKeySet(source string) *KeySet {
+	return &KeySet{
+		source: source,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key get the public key with the given key id, refreshing the key set if it expired or doesn't know the id
+func (k *KeySet) Key(kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	key, ok := k.keys[kid]
+	if ok && now.Before(k.expiresAt) {
+		return key, nil
+	}
+	if !ok && now.Before(k.expiresAt) && now.Sub(k.refreshedAt) < minRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %s", kid)
+	}
+
+	if err := k.refresh(now); err != nil {
+		return nil, err
+	}
+	if key, ok = k.keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown key id %s", kid)
+	}
+	return key, nil
+}
+
+func (k *KeySet) refresh(now time.Time) error {
+	data, ttl, err := k.load()
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, j := range set.Keys {
+		if j.Kty != "RSA" {
+			continue
+		}
+		key, err := j.publicKey()
+		if err != nil {
+			return err
+		}
+		keys[j.Kid] = key
+	}
+
+	k.keys = keys
+	k.refreshedAt = now
+	k.expiresAt = now.Add(ttl)
+	return nil
+}
+
+func (k *KeySet) load() ([]byte, time.Duration, error) {
+	if !strings.HasPrefix(k.source, "http://") && !strings.HasPrefix(k.source, "https://") {
+		data, err := ioutil.ReadFile(strings.TrimPrefix(k.source, "file://"))
+		return data, defaultKeysTTL, err
+	}
+
+	rsp, err := k.client.Get(k.source)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if rsp.Status[0] != '2' {
+		return nil, 0, fmt.Errorf("expected status 2xx, got %s: %s", rsp.Status, string(data))
+	}
+
+	ttl := defaultKeysTTL
+	if m := maxAgeRegexp.FindStringSubmatch(rsp.Header.Get("Cache-Control")); m != nil {
+		if maxAge, err := strconv.Atoi(m[1]); err == nil {
+			ttl = time.Duration(maxAge) * time.Second
+		}
+	}
+	return data, ttl, nil
+}
+
+func (j *jwk) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(j.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus of key %s: %v", j.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(j.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent of key %s: %v", j.Kid, err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
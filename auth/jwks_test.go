@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeySetKey(t *testing.T) {
+	key := generateKey(t)
+	var hits int32
+	srv := jwksServer(t, map[string]*rsa.PrivateKey{testKid: key}, &hits)
+	ks := NewKeySet(srv.URL)
+
+	got, err := ks.Key(testKid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.N.Cmp(key.N) != 0 || got.E != key.E {
+		t.Fatal("key doesn't match the served one")
+	}
+	if d := ks.expiresAt.Sub(ks.refreshedAt); d != time.Hour {
+		t.Fatalf("keys cached for %s, want the max-age of an hour", d)
+	}
+
+	// cached keys are served without fetching the set again
+	if _, err := ks.Key(testKid); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("fetched %d times, want 1", atomic.LoadInt32(&hits))
+	}
+}
+
+func TestKeySetUnknownKid(t *testing.T) {
+	key := generateKey(t)
+	var hits int32
+	srv := jwksServer(t, map[string]*rsa.PrivateKey{testKid: key}, &hits)
+	ks := NewKeySet(srv.URL)
+
+	if _, err := ks.Key("key-2"); err == nil || err.Error() != "unknown key id key-2" {
+		t.Fatalf("error = %v, want unknown key id", err)
+	}
+	// unknown ids don't refresh the set more than once per interval
+	if _, err := ks.Key("key-3"); err == nil {
+		t.Fatal("unknown key id accepted")
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("fetched %d times, want 1", atomic.LoadInt32(&hits))
+	}
+
+	// a rotated key is fetched once the interval is over
+	ks.refreshedAt = ks.refreshedAt.Add(-minRefreshInterval)
+	if _, err := ks.Key("key-2"); err == nil {
+		t.Fatal("unknown key id accepted")
+	}
+	if atomic.LoadInt32(&hits) != 2 {
+		t.Fatalf("fetched %d times, want 2", atomic.LoadInt32(&hits))
+	}
+}
+
+func TestKeySetExpired(t *testing.T) {
+	key := generateKey(t)
+	var hits int32
+	srv := jwksServer(t, map[string]*rsa.PrivateKey{testKid: key}, &hits)
+	ks := NewKeySet(srv.URL)
+
+	if _, err := ks.Key(testKid); err != nil {
+		t.Fatal(err)
+	}
+	ks.expiresAt = time.Now().Add(-time.Second)
+	if _, err := ks.Key(testKid); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&hits) != 2 {
+		t.Fatalf("fetched %d times, want 2", atomic.LoadInt32(&hits))
+	}
+}
+
+func TestKeySetErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if _, err := NewKeySet(srv.URL).Key(testKid); err == nil || !strings.Contains(err.Error(), "expected status 2xx") {
+		t.Fatalf("error = %v, want a status error", err)
+	}
+}
+
+func TestKeySetFile(t *testing.T) {
+	key := generateKey(t)
+	set := map[string][]jwk{"keys": {
+		{Kid: "ec-key", Kty: "EC"},
+		{
+			Kid: testKid,
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ks := NewKeySet("file://" + path)
+	if _, err := ks.Key(testKid); err != nil {
+		t.Fatal(err)
+	}
+	// keys of other types are ignored
+	if _, err := ks.Key("ec-key"); err == nil {
+		t.Fatal("EC key accepted")
+	}
+}
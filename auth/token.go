@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+)
+
+// clockSkew tolerance applied to the time claims of a token
+const clockSkew = time.Minute
+
+// Token verified claims of an ID token
+type Token struct {
+	UID      string `json:"sub"`
+	Issuer   string `json:"iss"`
+	Audience string `json:"aud"`
+	Expires  int64  `json:"exp"`
+	IssuedAt int64  `json:"iat"`
+	Role     string `json:"role"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// TokenVerifier structure of the ID token verifier
+type TokenVerifier struct {
+	keys      *KeySet
+	issuers   []string
+	audience  string
+	adminRole string
+}
+
+// Verifier instance of the ID token verifier
+var Verifier *TokenVerifier
+
+// InitVerifier initialize the instance of the ID token verifier
+func InitVerifier() {
+	Verifier = &TokenVerifier{
+		keys:      NewKeySet(env.EnvVars.AuthJWKSURL),
+		issuers:   env.EnvVars.AuthIssuers,
+		audience:  env.EnvVars.AuthAudience,
+		adminRole: env.EnvVars.AuthAdminRole,
+	}
+}
+
+// IsAdmin whether the token carries the admin role claim
+func (v *TokenVerifier) IsAdmin(t *Token) bool {
+	return t.Role == v.adminRole
+}
+
+// Authenticate verify the bearer ID token of a request
+func (v *TokenVerifier) Authenticate(r *http.Request) (*Token, error) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, errors.New("missing bearer token")
+	}
+	return v.Verify(strings.TrimPrefix(authorization, "Bearer "))
+}
+
+// Verify verify the RS256 signature and the claims of an ID token
+func (v *TokenVerifier) Verify(raw string) (*Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+	if h.Alg != "RS256" {
+		return nil, fmt.Errorf("unexpected signing algorithm %s", h.Alg)
+	}
+
+	key, err := v.keys.Key(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, errors.New("invalid token signature")
+	}
+
+	var t Token
+	if err := decodeSegment(parts[1], &t); err != nil {
+		return nil, err
+	}
+	if err := v.checkClaims(&t, time.Now()); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (v *TokenVerifier) checkClaims(t *Token, now time.Time) error {
+	if now.Add(-clockSkew).Unix() >= t.Expires {
+		return errors.New("token expired")
+	}
+	if now.Add(clockSkew).Unix() < t.IssuedAt {
+		return errors.New("token issued in the future")
+	}
+	if t.Audience != v.audience {
+		return fmt.Errorf("unexpected token audience %s", t.Audience)
+	}
+	if t.UID == "" {
+		return errors.New("token has no subject")
+	}
+	for _, iss := range v.issuers {
+		if t.Issuer == iss {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected token issuer %s", t.Issuer)
+}
+
+func decodeSegment(seg string, i interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("malformed token segment")
+	}
+	return json.Unmarshal(data, i)
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://securetoken.google.com/test-project"
+	testAudience = "test-project"
+	testKid      = "key-1"
+)
+
+// jwksServer serve the public keys of the given key ids as a JWKS, counting the requests it receives
+func jwksServer(t *testing.T, keys map[string]*rsa.PrivateKey, hits *int32) *httptest.Server {
+	t.Helper()
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, k := range keys {
+		set.Keys = append(set.Keys, jwk{
+			Kid: kid,
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits != nil {
+			atomic.AddInt32(hits, 1)
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// signToken sign the claims with key, the header carrying alg and kid
+func signToken(t *testing.T, key *rsa.PrivateKey, alg, kid string, claims interface{}) string {
+	t.Helper()
+	h, err := json.Marshal(&header{Alg: alg, Kid: kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() *Token {
+	now := time.Now()
+	return &Token{
+		UID:      "user-1",
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		Expires:  now.Add(time.Hour).Unix(),
+		IssuedAt: now.Add(-time.Minute).Unix(),
+	}
+}
+
+func newTestVerifier(source string) *TokenVerifier {
+	return &TokenVerifier{
+		keys:      NewKeySet(source),
+		issuers:   []string{testIssuer},
+		audience:  testAudience,
+		adminRole: "admin",
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := generateKey(t)
+	other := generateKey(t)
+	srv := jwksServer(t, map[string]*rsa.PrivateKey{testKid: key}, nil)
+
+	withClaims := func(fn func(c *Token)) *Token {
+		c := validClaims()
+		fn(c)
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"valid", signToken(t, key, "RS256", testKid, validClaims()), ""},
+		{"bad signature", signToken(t, other, "RS256", testKid, validClaims()), "invalid token signature"},
+		{"wrong issuer", signToken(t, key, "RS256", testKid, withClaims(func(c *Token) { c.Issuer = "https://evil.example" })), "unexpected token issuer"},
+		{"wrong audience", signToken(t, key, "RS256", testKid, withClaims(func(c *Token) { c.Audience = "other-project" })), "unexpected token audience"},
+		{"expired", signToken(t, key, "RS256", testKid, withClaims(func(c *Token) { c.Expires = time.Now().Add(-2 * clockSkew).Unix() })), "token expired"},
+		{"issued in the future", signToken(t, key, "RS256", testKid, withClaims(func(c *Token) { c.IssuedAt = time.Now().Add(2 * clockSkew).Unix() })), "issued in the future"},
+		{"no subject", signToken(t, key, "RS256", testKid, withClaims(func(c *Token) { c.UID = "" })), "no subject"},
+		{"alg none", signToken(t, key, "none", testKid, validClaims()), "unexpected signing algorithm none"},
+		{"alg HS256", signToken(t, key, "HS256", testKid, validClaims()), "unexpected signing algorithm HS256"},
+		{"unknown kid", signToken(t, key, "RS256", "key-2", validClaims()), "unknown key id key-2"},
+		{"malformed", "not.a-token", "malformed token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := newTestVerifier(srv.URL).Verify(tt.token)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tok.UID != "user-1" {
+					t.Fatalf("uid = %q, want user-1", tok.UID)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedClaims(t *testing.T) {
+	key := generateKey(t)
+	srv := jwksServer(t, map[string]*rsa.PrivateKey{testKid: key}, nil)
+
+	raw := signToken(t, key, "RS256", testKid, validClaims())
+	parts := strings.Split(raw, ".")
+	admin := validClaims()
+	admin.Role = "admin"
+	c, _ := json.Marshal(admin)
+	parts[1] = base64.RawURLEncoding.EncodeToString(c)
+
+	if _, err := newTestVerifier(srv.URL).Verify(strings.Join(parts, ".")); err == nil || err.Error() != "invalid token signature" {
+		t.Fatalf("error = %v, want invalid token signature", err)
+	}
+}
+
+func TestAuthorizeAdminRole(t *testing.T) {
+	key := generateKey(t)
+	srv := jwksServer(t, map[string]*rsa.PrivateKey{testKid: key}, nil)
+	prev := Verifier
+	Verifier = newTestVerifier(srv.URL)
+	t.Cleanup(func() { Verifier = prev })
+
+	admin := validClaims()
+	admin.Role = "admin"
+	user := validClaims()
+	user.Role = "support"
+
+	tests := []struct {
+		name   string
+		header string
+		admin  bool
+		code   int
+	}{
+		{"user on user function", "Bearer " + signToken(t, key, "RS256", testKid, user), false, 0},
+		{"user on admin function", "Bearer " + signToken(t, key, "RS256", testKid, user), true, 403},
+		{"admin on admin function", "Bearer " + signToken(t, key, "RS256", testKid, admin), true, 0},
+		{"missing bearer", "", false, 401},
+		{"invalid token", "Bearer " + signToken(t, key, "RS256", "key-2", admin), true, 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			_, errAuth := Authorize(r, tt.admin)
+			code := 0
+			if errAuth != nil {
+				code = errAuth.Code
+			}
+			if code != tt.code {
+				t.Fatalf("code = %d, want %d (%v)", code, tt.code, errAuth)
+			}
+		})
+	}
+}
+
+func TestTargetUID(t *testing.T) {
+	prev := Verifier
+	Verifier = newTestVerifier("")
+	t.Cleanup(func() { Verifier = prev })
+
+	if uid := TargetUID(&Token{UID: "user-1"}, "user-2"); uid != "user-1" {
+		t.Fatalf("user acted on %s", uid)
+	}
+	if uid := TargetUID(&Token{UID: "admin-1", Role: "admin"}, "user-2"); uid != "user-2" {
+		t.Fatalf("admin acted on %s", uid)
+	}
+	if uid := TargetUID(&Token{UID: "admin-1", Role: "admin"}, ""); uid != "admin-1" {
+		t.Fatalf("admin without uid acted on %s", uid)
+	}
+}
@@ -0,0 +1,83 @@
+package btc
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// Chains as stored in the chain_state collection
+const (
+	ChainMain  = "btc_main"
+	ChainTest3 = "btc_test3"
+)
+
+// ChainParams get the network parameters of a chain
+func ChainParams(chain string) *chaincfg.Params {
+	if chain == ChainMain {
+		return &chaincfg.MainNetParams
+	}
+	return &chaincfg.TestNet3Params
+}
+
+// DecodeAddress decode an address, check its checksum and that it belongs to the given network
+func DecodeAddress(addr string, params *chaincfg.Params) (btcutil.Address, error) {
+	a, err := btcutil.DecodeAddress(addr, params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %v", addr, err)
+	}
+	if !a.IsForNet(params) {
+		return nil, fmt.Errorf("address %s is not a %s address", addr, params.Name)
+	}
+	return a, nil
+}
+
+// DeriveAddress derive the native segwit receive address of index i from an account extended public key
+func DeriveAddress(xpub string, i uint32, params *chaincfg.Params) (string, error) {
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil {
+		return "", err
+	}
+	if key.IsPrivate() {
+		return "", errors.New("extended key must be public")
+	}
+	if !key.IsForNet(params) {
+		return "", fmt.Errorf("extended key is not a %s key", params.Name)
+	}
+
+	// external chain of the account, eg. m/84'/0'/0'/0/i
+	external, err := key.Child(0)
+	if err != nil {
+		return "", err
+	}
+	child, err := external.Child(i)
+	if err != nil {
+		return "", err
+	}
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return "", err
+	}
+
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pubKey.SerializeCompressed()), params)
+	if err != nil {
+		return "", err
+	}
+	return addr.EncodeAddress(), nil
+}
+
+// PaymentURI BIP21 uri requesting amount satoshis to an address, with an optional message
+func PaymentURI(address string, amount int64, message string) string {
+	btc := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%d.%08d", amount/1e8, amount%1e8), "0"), ".")
+	uri := "bitcoin:" + address + "?amount=" + btc
+	if message != "" {
+		// BIP21 percent-encodes spaces
+		uri += "&message=" + strings.ReplaceAll(url.QueryEscape(message), "+", "%20")
+	}
+	return uri
+}
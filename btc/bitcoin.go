@@ -1,9 +1,12 @@
 package btc
 
 import (
+	"encoding/hex"
 	"math/big"
+	"sort"
 
 	"github.com/blockcypher/gobcy"
+	"github.com/btcsuite/btcd/wire"
 )
 
 type result struct {
@@ -12,27 +15,54 @@ type result struct {
 	error
 }
 
+// Broadcaster interface of the providers able to broadcast raw transactions
+type Broadcaster interface {
+	PushTransaction(rawTx string) error
+}
+
+// AddressHistory interface of the providers able to list the confirmed transactions of an address, and those
+// waiting in the mempool, and to detail the inputs and outputs of a transaction
+type AddressHistory interface {
+	GetAddressHistory(address string) ([]*Transaction, error)
+	GetAddressMempool(address string) ([]*Transaction, error)
+	GetTransaction(hash string) ([]*Transaction, error)
+}
+
 // BitcoinAPI interface that the Btc Service implements
 type BitcoinAPI interface {
+	Broadcaster
+	AddressHistory
 	GetBlock(height int) (*Block, error)
 	GetHeadBlock() (*HeadBlock, error)
 	GetTransactionsFromBlock(block *Block) ([]*Transaction, []error)
 	GetTransactionByHash(hash string) (*Transaction, error)
 	GetBalance(address string) (*big.Int, error)
+	GetRawTransaction(hash string) (string, error)
 }
 
 //Btc structure of the Btc service
 type Btc struct {
-	api BitcoinAPI
+	api         BitcoinAPI
+	broadcaster Broadcaster
+	history     AddressHistory
 }
 
 // BtcService instance of the btc service
 var BtcService *Btc
 
-// InitBtcService initialize the instance of the btc service
-func InitBtcService(a BitcoinAPI) {
+// InitBtcService initialize the instance of the btc service. Transactions are broadcast through b and addresses
+// history is fetched from h, a is used for both if they are nil
+func InitBtcService(a BitcoinAPI, b Broadcaster, h AddressHistory) {
+	if b == nil {
+		b = a
+	}
+	if h == nil {
+		h = a
+	}
 	BtcService = &Btc{
-		api: a,
+		api:         a,
+		broadcaster: b,
+		history:     h,
 	}
 }
 
@@ -56,18 +86,23 @@ func (b *Btc) GetAccountBalance(address string) (*big.Int, error) {
 	return balance, nil
 }
 
+// GetAddressMempool get the inputs and outputs of the unconfirmed transactions involving the given address
+func (b *Btc) GetAddressMempool(address string) ([]*Transaction, error) {
+	return b.history.GetAddressMempool(address)
+}
+
 // ScanBlock scan a btc Block, extract and parse its transactions
-func (b *Btc) ScanBlock(height int) ([]*Transaction, error) {
+func (b *Btc) ScanBlock(height int) (*Block, []*Transaction, error) {
 	block, err := b.FetchBlock(height)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	txs, errs := b.api.GetTransactionsFromBlock(block)
 	if len(errs) > 0 {
-		return nil, errs[0]
+		return nil, nil, errs[0]
 	}
 
-	return txs, nil
+	return block, txs, nil
 }
 
 // GetHeadInfo get the info of the head block of the blockchain
@@ -94,3 +129,49 @@ func (b *Btc) ConfirmTransactions(hashes []string) (confirmed []string, errs []e
 	}
 	return
 }
+
+// GetRawTransaction get the serialized transaction corresponding to the given hash
+func (b *Btc) GetRawTransaction(hash string) ([]byte, error) {
+	rawTx, err := b.api.GetRawTransaction(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(rawTx)
+}
+
+// Broadcast broadcast a signed transaction to the network and return its hash
+func (b *Btc) Broadcast(tx *wire.MsgTx) (string, error) {
+	rawTx, err := EncodeRawTransaction(tx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := b.broadcaster.PushTransaction(rawTx); err != nil {
+		return "", err
+	}
+
+	return tx.TxHash().String(), nil
+}
+
+// GetTransaction get every input and output of a transaction, whichever addresses they belong to
+func (b *Btc) GetTransaction(hash string) ([]*Transaction, error) {
+	return b.history.GetTransaction(hash)
+}
+
+// GetAddressHistory get the inputs and outputs of the confirmed transactions involving the given address, ordered by
+// block height then with the outputs of a block before its inputs, so that outputs are always created before spent
+func (b *Btc) GetAddressHistory(address string) ([]*Transaction, error) {
+	txs, err := b.history.GetAddressHistory(address)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].BlockHeight != txs[j].BlockHeight {
+			return txs[i].BlockHeight < txs[j].BlockHeight
+		}
+		return !txs[i].IsInput() && txs[j].IsInput()
+	})
+	return txs, nil
+}
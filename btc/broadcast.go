@@ -0,0 +1,38 @@
+package btc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MaxFeeRate fee rate (sat/vB) above which a transaction fee is considered absurd
+const MaxFeeRate int64 = 1000
+
+// VSize virtual size of a transaction
+func VSize(tx *wire.MsgTx) int64 {
+	weight := int64(tx.SerializeSizeStripped()*3 + tx.SerializeSize())
+	return (weight + 3) / 4
+}
+
+// CheckFee check that the fee paid by a transaction spending inputValue satoshis is neither negative nor absurd
+func CheckFee(tx *wire.MsgTx, inputValue int64) (fee int64, err error) {
+	if len(tx.TxIn) == 0 || len(tx.TxOut) == 0 {
+		return 0, errors.New("transaction has no inputs or no outputs")
+	}
+
+	var outputValue int64
+	for _, out := range tx.TxOut {
+		outputValue += out.Value
+	}
+
+	fee = inputValue - outputValue
+	if fee < 0 {
+		return fee, fmt.Errorf("transaction spends %d satoshis more than its inputs", -fee)
+	}
+	if rate := fee / VSize(tx); rate > MaxFeeRate {
+		return fee, fmt.Errorf("fee rate of %d sat/vB is absurdly high", rate)
+	}
+	return fee, nil
+}
@@ -0,0 +1,180 @@
+package btc
+
+import (
+	"errors"
+	"sort"
+)
+
+const (
+	// DustLimit amount under which an output is not worth creating
+	DustLimit int64 = 546
+	// txOverheadVSize virtual size of the version, locktime, counts and segwit marker of a transaction
+	txOverheadVSize int64 = 11
+	// bnbMaxTries maximum number of branches explored by the branch and bound selection
+	bnbMaxTries = 100000
+)
+
+// ErrInsufficientFunds returned when the utxos cannot cover the amount and the fee
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+var inputVSizes = map[string]int64{
+	ScriptP2PKH:  148,
+	ScriptP2SH:   91,
+	ScriptP2WPKH: 68,
+	ScriptP2WSH:  105,
+	ScriptP2TR:   58,
+}
+
+var outputVSizes = map[string]int64{
+	ScriptP2PKH:  34,
+	ScriptP2SH:   32,
+	ScriptP2WPKH: 31,
+	ScriptP2WSH:  43,
+	ScriptP2TR:   43,
+}
+
+// Utxo spendable output used for coin selection
+type Utxo struct {
+	TxHash     string
+	Vout       int
+	Value      int64
+	Script     string
+	ScriptType string
+}
+
+// CoinSelection utxos selected to pay an amount, with the resulting fee and change
+type CoinSelection struct {
+	Inputs []*Utxo
+	Fee    int64
+	Change int64
+}
+
+// InputVSize estimated virtual size of an input spending the given script type
+func InputVSize(scriptType string) int64 {
+	if s, ok := inputVSizes[scriptType]; ok {
+		return s
+	}
+	return inputVSizes[ScriptP2PKH]
+}
+
+// OutputVSize estimated virtual size of an output of the given script type
+func OutputVSize(scriptType string) int64 {
+	if s, ok := outputVSizes[scriptType]; ok {
+		return s
+	}
+	return outputVSizes[ScriptP2PKH]
+}
+
+// SelectCoins select utxos to pay amount to an output of type outType at the given fee rate (sat/vB).
+// Branch and bound looks for a changeless selection first, then falls back to largest first with a change
+// output of type changeType
+func SelectCoins(utxos []*Utxo, amount, feeRate int64, outType, changeType string) (*CoinSelection, error) {
+	sorted := make([]*Utxo, len(utxos))
+	copy(sorted, utxos)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Value > sorted[j].Value })
+
+	// fee of the parts of the transaction that don't depend on the inputs
+	baseFee := (txOverheadVSize + OutputVSize(outType)) * feeRate
+	changeFee := OutputVSize(changeType) * feeRate
+	costOfChange := changeFee + InputVSize(changeType)*feeRate
+
+	if sel := branchAndBound(sorted, amount+baseFee, costOfChange, feeRate); sel != nil {
+		sel.Fee = totalValue(sel.Inputs) - amount
+		return sel, nil
+	}
+
+	return largestFirst(sorted, amount, baseFee, changeFee, feeRate)
+}
+
+func effectiveValue(u *Utxo, feeRate int64) int64 {
+	return u.Value - InputVSize(u.ScriptType)*feeRate
+}
+
+func totalValue(utxos []*Utxo) (total int64) {
+	for _, u := range utxos {
+		total += u.Value
+	}
+	return
+}
+
+// branchAndBound depth first search of a subset of utxos whose effective value lies in [target, target+costOfChange]
+func branchAndBound(utxos []*Utxo, target, costOfChange, feeRate int64) *CoinSelection {
+	var pool []*Utxo
+	var available int64
+	for _, u := range utxos {
+		if ev := effectiveValue(u, feeRate); ev > 0 {
+			pool = append(pool, u)
+			available += ev
+		}
+	}
+	if available < target {
+		return nil
+	}
+
+	tries := 0
+	selected := make([]bool, len(pool))
+	var best []bool
+	var bestWaste int64 = -1
+
+	var search func(depth int, value, remaining int64)
+	search = func(depth int, value, remaining int64) {
+		tries++
+		if tries > bnbMaxTries || value > target+costOfChange || value+remaining < target {
+			return
+		}
+		if value >= target {
+			if waste := value - target; bestWaste < 0 || waste < bestWaste {
+				bestWaste = waste
+				best = append([]bool(nil), selected...)
+			}
+			return
+		}
+		if depth == len(pool) {
+			return
+		}
+		ev := effectiveValue(pool[depth], feeRate)
+		selected[depth] = true
+		search(depth+1, value+ev, remaining-ev)
+		selected[depth] = false
+		search(depth+1, value, remaining-ev)
+	}
+	search(0, 0, available)
+
+	if best == nil {
+		return nil
+	}
+	sel := &CoinSelection{}
+	for i, ok := range best {
+		if ok {
+			sel.Inputs = append(sel.Inputs, pool[i])
+		}
+	}
+	return sel
+}
+
+// largestFirst add the largest utxos until the amount, the fee and a change output are covered
+func largestFirst(utxos []*Utxo, amount, baseFee, changeFee, feeRate int64) (*CoinSelection, error) {
+	sel := &CoinSelection{}
+	var total int64
+	fee := baseFee
+	for _, u := range utxos {
+		sel.Inputs = append(sel.Inputs, u)
+		total += u.Value
+		fee += InputVSize(u.ScriptType) * feeRate
+
+		if total < amount+fee {
+			continue
+		}
+		change := total - amount - fee - changeFee
+		if change < DustLimit {
+			// change is not worth an output, leave it to the miners
+			sel.Fee = total - amount
+			return sel, nil
+		}
+		sel.Fee = fee + changeFee
+		sel.Change = change
+		return sel, nil
+	}
+
+	return nil, ErrInsufficientFunds
+}
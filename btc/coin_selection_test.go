@@ -0,0 +1,91 @@
+package btc
+
+import (
+	"testing"
+)
+
+func TestSelectCoins(t *testing.T) {
+	// at 1 sat/vB with p2wpkh outputs: base fee 42, input fee 68, change output fee 31
+	tests := []struct {
+		name   string
+		values []int64
+		amount int64
+		inputs []int64
+		fee    int64
+		change int64
+	}{
+		{"changeless exact match", []int64{50000, 10110}, 10000, []int64{10110}, 110, 0},
+		{"changeless within the cost of change", []int64{50000, 10150}, 10000, []int64{10150}, 150, 0},
+		{"changeless with several inputs", []int64{20000, 6068, 4110}, 10000, []int64{6068, 4110}, 178, 0},
+		{"uneconomical utxos are ignored", []int64{50000, 10110, 50}, 10000, []int64{10110}, 110, 0},
+		// no subset lands in the changeless window, fall back to largest first with a change output
+		{"fallback with change", []int64{30000, 50000}, 10000, []int64{50000}, 141, 39859},
+		{"fallback with several inputs", []int64{6000, 5000}, 10000, []int64{6000, 5000}, 209, 791},
+		{"fallback drops dust change", []int64{10500}, 10000, []int64{10500}, 500, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var utxos []*Utxo
+			for i, v := range tt.values {
+				utxos = append(utxos, &Utxo{TxHash: "ab01", Vout: i, Value: v, ScriptType: ScriptP2WPKH})
+			}
+			sel, err := SelectCoins(utxos, tt.amount, 1, ScriptP2WPKH, ScriptP2WPKH)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sel.Inputs) != len(tt.inputs) {
+				t.Fatalf("selected %d inputs, want %v", len(sel.Inputs), tt.inputs)
+			}
+			for i, u := range sel.Inputs {
+				if u.Value != tt.inputs[i] {
+					t.Fatalf("input %d = %d, want %d", i, u.Value, tt.inputs[i])
+				}
+			}
+			if sel.Fee != tt.fee || sel.Change != tt.change {
+				t.Fatalf("fee %d and change %d, want %d and %d", sel.Fee, sel.Change, tt.fee, tt.change)
+			}
+			// inputs pay exactly the amount, the fee and the change
+			if totalValue(sel.Inputs) != tt.amount+sel.Fee+sel.Change {
+				t.Fatalf("inputs of %d don't balance the amount, fee and change", totalValue(sel.Inputs))
+			}
+			if tt.values[0] != utxos[0].Value {
+				t.Fatal("the utxos of the caller were reordered")
+			}
+		})
+	}
+}
+
+func TestSelectCoinsInsufficientFunds(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []int64
+		amount  int64
+		feeRate int64
+	}{
+		{"no utxos", nil, 10000, 1},
+		{"below the amount", []int64{6000, 3000}, 10000, 1},
+		{"below the amount and the fee", []int64{10100}, 10000, 1},
+		{"eaten by the fee", []int64{10000, 10000}, 10000, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var utxos []*Utxo
+			for i, v := range tt.values {
+				utxos = append(utxos, &Utxo{TxHash: "ab01", Vout: i, Value: v, ScriptType: ScriptP2WPKH})
+			}
+			if _, err := SelectCoins(utxos, tt.amount, tt.feeRate, ScriptP2WPKH, ScriptP2WPKH); err != ErrInsufficientFunds {
+				t.Fatalf("error = %v, want ErrInsufficientFunds", err)
+			}
+		})
+	}
+}
+
+func TestVSizes(t *testing.T) {
+	// unknown script types are estimated as p2pkh, the largest
+	if InputVSize("nonstandard") != InputVSize(ScriptP2PKH) || OutputVSize("nonstandard") != OutputVSize(ScriptP2PKH) {
+		t.Fatal("unknown script types aren't estimated as p2pkh")
+	}
+	if InputVSize(ScriptP2TR) >= InputVSize(ScriptP2WPKH) {
+		t.Fatal("taproot inputs are larger than p2wpkh inputs")
+	}
+}
@@ -42,14 +42,29 @@ type Address struct {
 	Txs           []*Tx  `json:"txs"`
 }
 
-// Transaction decoded transaction from TX inputs and outputs with only required properties
+// Transaction decoded transaction from TX inputs and outputs with only required properties.
+// Outputs have a positive value, spent inputs have a negative value and reference the previous output
 type Transaction struct {
 	Address     string  `json:"address"`
 	Value       big.Int `json:"value"`
 	BlockHeight int     `json:"block_height"`
+	BlockTime   int     `json:"block_time"`
 	Hash        string  `json:"hash"`
 	TxIndex     big.Int `json:"tx_index"`
 	N           int     `json:"n"`
+	Script      string  `json:"script"`
+	// Sequence sequence number of spent inputs
+	Sequence int64 `json:"sequence,omitempty"`
+}
+
+// IsInput whether the transaction is a spent input rather than a created output
+func (t *Transaction) IsInput() bool {
+	return t.Value.Sign() < 0
+}
+
+// SignalsRBF whether a spent input signals that its transaction may be replaced by fee (BIP125)
+func (t *Transaction) SignalsRBF() bool {
+	return t.IsInput() && t.Sequence < 0xfffffffe
 }
 
 // Tx structure of a BTC transaction
@@ -57,6 +72,7 @@ type Tx struct {
 	Result      int       `json:"result"`
 	Ver         int       `json:"ver"`
 	Size        int       `json:"size"`
+	Weight      int       `json:"weight"`
 	Inputs      []*Inputs `json:"inputs"`
 	Time        int       `json:"time"`
 	BlockHeight int       `json:"block_height"`
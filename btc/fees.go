@@ -0,0 +1,138 @@
+package btc
+
+import (
+	"log"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// Confirmation targets (in blocks) of the fee estimates
+const (
+	FastTarget   = 1
+	NormalTarget = 3
+	SlowTarget   = 6
+)
+
+// Percentiles of the recent fee rates used for each target
+const (
+	fastPercentile   = 50
+	normalPercentile = 25
+	slowPercentile   = 10
+)
+
+// FeeEstimator interface of the providers able to estimate a fee rate (sat/vB) for a confirmation target
+type FeeEstimator interface {
+	EstimateFeeRate(target int) (float64, error)
+}
+
+// FeeRates fee rates (sat/vB) for each confirmation target
+type FeeRates struct {
+	Fast   float64 `firestore:"fast" json:"fast"`
+	Normal float64 `firestore:"normal" json:"normal"`
+	Slow   float64 `firestore:"slow" json:"slow"`
+}
+
+// FeeService structure of the fee estimation service
+type FeeService struct {
+	estimator FeeEstimator
+}
+
+// Fees instance of the fee estimation service
+var Fees *FeeService
+
+// InitFeeService initialize the instance of the fee service. Provider estimates are blended in if e is not nil
+func InitFeeService(e FeeEstimator) {
+	Fees = &FeeService{
+		estimator: e,
+	}
+}
+
+// BlockFeeRates fee rate (sat/vB) of every transaction of a block but the coinbase
+func BlockFeeRates(block *Block) []float64 {
+	var rates []float64
+	for i, tx := range block.Txs {
+		if i == 0 {
+			continue
+		}
+		vsize := float64(tx.Size)
+		if tx.Weight > 0 {
+			vsize = math.Ceil(float64(tx.Weight) / 4)
+		}
+		if vsize == 0 {
+			continue
+		}
+		fee, _ := new(big.Float).SetInt(&tx.Fee).Float64()
+		rates = append(rates, fee/vsize)
+	}
+	return rates
+}
+
+// Quantiles summarize fee rates into n+1 evenly spaced quantiles, from the minimum to the maximum
+func Quantiles(rates []float64, n int) []float64 {
+	if len(rates) == 0 {
+		return nil
+	}
+	sorted := make([]float64, len(rates))
+	copy(sorted, rates)
+	sort.Float64s(sorted)
+
+	qs := make([]float64, n+1)
+	for i := range qs {
+		qs[i] = Percentile(sorted, float64(i)*100/float64(n))
+	}
+	return qs
+}
+
+// Percentile nearest rank percentile p (0-100) of sorted values
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// Estimate estimate the fee rates of each target from the quantiles of the fee rates of recent blocks,
+// averaged with the provider estimates when a provider is configured. A failing provider is only logged, unless no
+// block was scanned
+func (f *FeeService) Estimate(blockQuantiles [][]float64) (*FeeRates, error) {
+	var all []float64
+	for _, qs := range blockQuantiles {
+		all = append(all, qs...)
+	}
+	sort.Float64s(all)
+
+	rates := &FeeRates{
+		Fast:   Percentile(all, fastPercentile),
+		Normal: Percentile(all, normalPercentile),
+		Slow:   Percentile(all, slowPercentile),
+	}
+
+	if f.estimator == nil {
+		return rates, nil
+	}
+	for _, r := range []struct {
+		target int
+		rate   *float64
+	}{{FastTarget, &rates.Fast}, {NormalTarget, &rates.Normal}, {SlowTarget, &rates.Slow}} {
+		est, err := f.estimator.EstimateFeeRate(r.target)
+		if err != nil {
+			if len(all) == 0 {
+				return nil, err
+			}
+			log.Printf("fee estimate for %d blocks: %v", r.target, err)
+			continue
+		}
+		if len(all) == 0 {
+			*r.rate = est
+			continue
+		}
+		*r.rate = (*r.rate + est) / 2
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,267 @@
+package btc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/bech32"
+)
+
+// Formats of a signed message
+const (
+	// SignatureLegacy compact signature of the signmessage rpc, for P2PKH addresses
+	SignatureLegacy = "legacy"
+	// SignatureBIP322 BIP-322 simple signature, the witness of a virtual transaction, for segwit and taproot addresses
+	SignatureBIP322 = "bip322"
+)
+
+// ErrInvalidSignature the signature is well formed but doesn't sign the message for the address
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// VerifyMessage verify the base64 signature of a message by the key controlling an address, and return the format
+// of the signature
+func VerifyMessage(address, message, signature string, params *chaincfg.Params) (string, error) {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", errors.New("signature must be base64")
+	}
+	script, err := AddressScript(address, params)
+	if err != nil {
+		return "", err
+	}
+
+	switch ScriptType(fmt.Sprintf("%x", script)) {
+	case ScriptP2PKH:
+		return SignatureLegacy, verifyLegacy(script, message, sig)
+	case ScriptP2WPKH, ScriptP2WSH, ScriptP2TR:
+		return SignatureBIP322, verifyBIP322(script, message, sig)
+	}
+	return "", fmt.Errorf("signed messages of address %s are not supported", address)
+}
+
+// AddressScript locking script of an address, taproot addresses included
+func AddressScript(address string, params *chaincfg.Params) ([]byte, error) {
+	if program, ok := decodeTaproot(address, params); ok {
+		return append([]byte{txscript.OP_1, txscript.OP_DATA_32}, program...), nil
+	}
+	a, err := DecodeAddress(address, params)
+	if err != nil {
+		return nil, err
+	}
+	return txscript.PayToAddrScript(a)
+}
+
+// bech32mConst checksum constant of the BIP-350 encoding of segwit v1+ addresses
+const bech32mConst = 0x2bc830a3
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// decodeTaproot decode the witness program of a taproot address, which btcutil doesn't support
+func decodeTaproot(address string, params *chaincfg.Params) ([]byte, bool) {
+	addr := strings.ToLower(address)
+	// addresses are either all lowercase or all uppercase
+	if addr != address && strings.ToUpper(address) != address {
+		return nil, false
+	}
+	sep := strings.LastIndexByte(addr, '1')
+	if sep < 1 || addr[:sep] != params.Bech32HRPSegwit || len(addr)-sep-1 < 7 {
+		return nil, false
+	}
+	values := make([]int, 0, len(addr)*2)
+	for _, c := range addr[:sep] {
+		values = append(values, int(c>>5))
+	}
+	values = append(values, 0)
+	for _, c := range addr[:sep] {
+		values = append(values, int(c&31))
+	}
+	data := make([]byte, 0, len(addr)-sep-1)
+	for _, c := range addr[sep+1:] {
+		i := strings.IndexRune(bech32Charset, c)
+		if i < 0 {
+			return nil, false
+		}
+		data = append(data, byte(i))
+		values = append(values, i)
+	}
+	if bech32Polymod(values) != bech32mConst {
+		return nil, false
+	}
+
+	// version 1 and a 32 bytes program
+	data = data[:len(data)-6]
+	if len(data) == 0 || data[0] != 1 {
+		return nil, false
+	}
+	program, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil || len(program) != 32 {
+		return nil, false
+	}
+	return program, true
+}
+
+func bech32Polymod(values []int) int {
+	gen := []int{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := 1
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ v
+		for i := 0; i < 5; i++ {
+			if (b>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// verifyLegacy verify a compact signature of the double sha256 of the message, prefixed as by signmessage
+func verifyLegacy(script []byte, message string, sig []byte) error {
+	// headers 27-30 for uncompressed keys and 31-34 for compressed ones
+	if len(sig) != 65 || sig[0] < 27 || sig[0] > 34 {
+		return errors.New("legacy signature must be a 65 bytes compact signature")
+	}
+	var buf bytes.Buffer
+	wire.WriteVarString(&buf, 0, "Bitcoin Signed Message:\n")
+	wire.WriteVarString(&buf, 0, message)
+
+	key, compressed, err := btcec.RecoverCompact(btcec.S256(), sig, chainhash.DoubleHashB(buf.Bytes()))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	serialized := key.SerializeUncompressed()
+	if compressed {
+		serialized = key.SerializeCompressed()
+	}
+	// P2PKH script: OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+	if !bytes.Equal(btcutil.Hash160(serialized), script[3:23]) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// verifyBIP322 verify a BIP-322 simple signature: the witness spending a virtual output locked by the script and
+// committing to the message
+func verifyBIP322(script []byte, message string, sig []byte) error {
+	witness, err := readWitness(sig)
+	if err != nil || len(witness) == 0 {
+		return errors.New("bip322 signature must be a serialized witness")
+	}
+	toSign := bip322ToSign(script, message, witness)
+
+	if ScriptType(fmt.Sprintf("%x", script)) == ScriptP2TR {
+		return verifyTaprootKeySpend(script, toSign)
+	}
+	engine, err := txscript.NewEngine(script, toSign, 0, txscript.StandardVerifyFlags, nil, txscript.NewTxSigHashes(toSign), 0)
+	if err != nil {
+		return err
+	}
+	if err := engine.Execute(); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// bip322ToSign virtual transaction spending the output of the message, signed by the witness
+func bip322ToSign(script []byte, message string, witness wire.TxWitness) *wire.MsgTx {
+	hash := TaggedHash("BIP0322-signed-message", []byte(message))
+
+	toSpend := wire.NewMsgTx(0)
+	toSpend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: 0xffffffff},
+		SignatureScript:  append([]byte{txscript.OP_0, txscript.OP_DATA_32}, hash...),
+		Sequence:         0,
+	})
+	toSpend.AddTxOut(wire.NewTxOut(0, script))
+
+	toSign := wire.NewMsgTx(0)
+	toSign.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: toSpend.TxHash(), Index: 0},
+		Witness:          witness,
+		Sequence:         0,
+	})
+	toSign.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return toSign
+}
+
+// verifyTaprootKeySpend verify the key path spend of the only input of a transaction spending a 0 value taproot
+// output, signed with SIGHASH_DEFAULT or SIGHASH_ALL
+func verifyTaprootKeySpend(script []byte, tx *wire.MsgTx) error {
+	witness := tx.TxIn[0].Witness
+	if len(witness) != 1 {
+		return errors.New("only taproot key path spends are supported")
+	}
+	sig := witness[0]
+	hashType := byte(txscript.SigHashAll)
+	switch {
+	case len(sig) == 64:
+		hashType = 0
+	case len(sig) == 65 && sig[64] == byte(txscript.SigHashAll):
+		sig = sig[:64]
+	default:
+		return errors.New("taproot signature must use SIGHASH_DEFAULT or SIGHASH_ALL")
+	}
+
+	// BIP-341 signature message, without annex nor script path
+	var prevouts, amounts, scripts, sequences, outputs bytes.Buffer
+	for _, in := range tx.TxIn {
+		prevouts.Write(in.PreviousOutPoint.Hash[:])
+		binary.Write(&prevouts, binary.LittleEndian, in.PreviousOutPoint.Index)
+		binary.Write(&amounts, binary.LittleEndian, int64(0))
+		wire.WriteVarBytes(&scripts, 0, script)
+		binary.Write(&sequences, binary.LittleEndian, in.Sequence)
+	}
+	for _, out := range tx.TxOut {
+		binary.Write(&outputs, binary.LittleEndian, out.Value)
+		wire.WriteVarBytes(&outputs, 0, out.PkScript)
+	}
+	var msg bytes.Buffer
+	msg.WriteByte(0)
+	msg.WriteByte(hashType)
+	binary.Write(&msg, binary.LittleEndian, tx.Version)
+	binary.Write(&msg, binary.LittleEndian, tx.LockTime)
+	for _, b := range []*bytes.Buffer{&prevouts, &amounts, &scripts, &sequences, &outputs} {
+		h := sha256.Sum256(b.Bytes())
+		msg.Write(h[:])
+	}
+	msg.WriteByte(0)
+	binary.Write(&msg, binary.LittleEndian, uint32(0))
+
+	if !VerifySchnorr(script[2:], TaggedHash("TapSighash", msg.Bytes()), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// readWitness decode a serialized witness, as in BIP-322 simple signatures
+func readWitness(b []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(b)
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	// every item takes at least a byte, the count must not exceed what is left before allocating anything
+	if n > uint64(r.Len()) {
+		return nil, fmt.Errorf("witness of %d items is longer than the signature", n)
+	}
+	witness := make(wire.TxWitness, 0, n)
+	for i := uint64(0); i < n; i++ {
+		item, err := wire.ReadVarBytes(r, 0, wire.MaxBlockPayload, "witness item")
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, item)
+	}
+	return witness, nil
+}
@@ -0,0 +1,152 @@
+package btc
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const (
+	// address and signatures of the test vectors of BIP-322
+	bip322Address        = "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l"
+	bip322TaprootAddress = "bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3"
+	bip322EmptySig       = "AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI="
+	bip322HelloSig       = "AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI="
+	bip322HelloSig2      = "AkgwRQIhAOzyynlqt93lOKJr+wmmxIens//zPzl9tqIOua93wO6MAiBi5n5EyAcPScOjf1lAqIUIQtr3zKNeavYabHyR8eGhowEhAsfxIAMZZEKUPYWI4BruhAQjzFT8FSFSajuFwrDL1Yhy"
+	bip322TaprootSig     = "AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ=="
+
+	// signmessagewithprivkey vector of the functional tests of bitcoin core
+	legacyAddress = "mpLQjfK79b7CCV4VMJWEWAj5Mpx8Up5zxB"
+	legacyMessage = "This is just a test message"
+	legacySig     = "INbVnW4e6PeRmsv2Qgu8NuopvrVjkcxob+sX8OcZG0SALhWybUjzMLPdAsXI46YZGb0KQTRii+wWIQzRpG/U+S0="
+)
+
+func TestVerifyMessage(t *testing.T) {
+	mainnet, testnet := &chaincfg.MainNetParams, &chaincfg.TestNet3Params
+	tests := []struct {
+		name      string
+		address   string
+		message   string
+		signature string
+		params    *chaincfg.Params
+		format    string
+		invalid   bool
+		err       bool
+	}{
+		{"legacy", legacyAddress, legacyMessage, legacySig, testnet, SignatureLegacy, false, false},
+		{"legacy other message", legacyAddress, "This is another message", legacySig, testnet, SignatureLegacy, true, false},
+		{"legacy truncated", legacyAddress, legacyMessage, "INbVnW4e6PeRmsv2Qgu8NuopvrVjkcxob+sX8OcZG0SA", testnet, SignatureLegacy, false, true},
+		{"bip322 empty message", bip322Address, "", bip322EmptySig, mainnet, SignatureBIP322, false, false},
+		{"bip322 hello world", bip322Address, "Hello World", bip322HelloSig, mainnet, SignatureBIP322, false, false},
+		{"bip322 hello world other signature", bip322Address, "Hello World", bip322HelloSig2, mainnet, SignatureBIP322, false, false},
+		{"bip322 signature of another message", bip322Address, "", bip322HelloSig, mainnet, SignatureBIP322, true, false},
+		{"bip322 empty signature of hello world", bip322Address, "Hello World", bip322EmptySig, mainnet, SignatureBIP322, true, false},
+		{"bip322 taproot", bip322TaprootAddress, "Hello World", bip322TaprootSig, mainnet, SignatureBIP322, false, false},
+		{"bip322 taproot other message", bip322TaprootAddress, "Hello World!", bip322TaprootSig, mainnet, SignatureBIP322, true, false},
+		{"bip322 signature of another address", bip322TaprootAddress, "Hello World", bip322HelloSig, mainnet, SignatureBIP322, false, true},
+		{"legacy signature of a segwit address", bip322Address, legacyMessage, legacySig, mainnet, SignatureBIP322, false, true},
+		{"bip322 oversized witness count", bip322Address, "Hello World", "/wAAAAAQAAAA", mainnet, SignatureBIP322, false, true},
+		{"not base64", bip322Address, "Hello World", "not base64!", mainnet, "", false, true},
+		{"address of another network", bip322Address, "Hello World", bip322HelloSig, testnet, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := VerifyMessage(tt.address, tt.message, tt.signature, tt.params)
+			if format != tt.format {
+				t.Fatalf("format = %q, want %q", format, tt.format)
+			}
+			switch {
+			case tt.invalid:
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("error = %v, want ErrInvalidSignature", err)
+				}
+			case tt.err:
+				if err == nil || errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("error = %v, want a malformed signature", err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBip322ToSign(t *testing.T) {
+	// transaction ids of the to_spend and to_sign transactions of BIP-322
+	tests := []struct {
+		message string
+		toSpend string
+		toSign  string
+	}{
+		{"", "c5680aa69bb8d860bf82d4e9cd3504b55dde018de765a91bb566283c545a99a7", "1e9654e951a5ba44c8604c4de6c67fd78a27e81dcadcfe1edf638ba3aaebaed6"},
+		{"Hello World", "b79d196740ad5217771c1098fc4a4b51e0535c32236c71f1ea4d61a2d603352b", "88737ae86f2077145f93cc4b153ae9a1cb8d56afa511988c149c5c8c9d93bddf"},
+	}
+	script, err := AddressScript(bip322Address, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		tx := bip322ToSign(script, tt.message, nil)
+		if got := tx.TxIn[0].PreviousOutPoint.Hash.String(); got != tt.toSpend {
+			t.Fatalf("to_spend of %q = %s, want %s", tt.message, got, tt.toSpend)
+		}
+		if got := tx.TxHash().String(); got != tt.toSign {
+			t.Fatalf("to_sign of %q = %s, want %s", tt.message, got, tt.toSign)
+		}
+	}
+}
+
+func TestAddressScript(t *testing.T) {
+	// valid segwit addresses of BIP-350, the v1 programs other than 32 bytes and v2+ aren't supported
+	valid := []struct {
+		address string
+		params  *chaincfg.Params
+		script  string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", &chaincfg.MainNetParams, "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", &chaincfg.TestNet3Params, "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", &chaincfg.TestNet3Params, "0020000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", &chaincfg.TestNet3Params, "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", &chaincfg.MainNetParams, "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{"BC1P0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQZK5JJ0", &chaincfg.MainNetParams, "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+	for _, tt := range valid {
+		script, err := AddressScript(tt.address, tt.params)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.address, err)
+		}
+		if got := hex.EncodeToString(script); got != tt.script {
+			t.Fatalf("script of %s = %s, want %s", tt.address, got, tt.script)
+		}
+	}
+
+	// invalid segwit addresses of BIP-350
+	invalid := []string{
+		"tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd",
+		"tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf",
+		"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh",
+		"tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47",
+		"bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4",
+		"BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R",
+		"bc1pw5dgrnzv",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v8n0nx0muaewav253zgeav",
+		"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P",
+		"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47Zagq",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v07qwwzcrf",
+		"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vpggkg4j",
+		"bc1gmk9yu",
+	}
+	for _, address := range invalid {
+		params := &chaincfg.MainNetParams
+		if address[:2] == "tb" {
+			params = &chaincfg.TestNet3Params
+		}
+		if script, err := AddressScript(address, params); err == nil {
+			t.Fatalf("%s decoded to %x", address, script)
+		}
+	}
+}
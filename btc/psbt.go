@@ -0,0 +1,115 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil/psbt"
+)
+
+// psbtSequenceRbfEnabled sequence of the inputs of the withdrawal psbts, signaling replace-by-fee
+const psbtSequenceRbfEnabled = wire.MaxTxInSequenceNum - 2
+
+// PsbtInput utxo spent by a psbt. PrevTx is the serialized previous transaction, required by non segwit inputs
+type PsbtInput struct {
+	Utxo   *Utxo
+	PrevTx []byte
+}
+
+// NewPsbt build an unsigned BIP174 psbt spending the given inputs to the given outputs, encoded in base64
+func NewPsbt(inputs []*PsbtInput, outputs []*wire.TxOut) (string, error) {
+	outPoints := make([]*wire.OutPoint, 0, len(inputs))
+	sequences := make([]uint32, 0, len(inputs))
+	for _, in := range inputs {
+		hash, err := chainhash.NewHashFromStr(in.Utxo.TxHash)
+		if err != nil {
+			return "", err
+		}
+		outPoints = append(outPoints, wire.NewOutPoint(hash, uint32(in.Utxo.Vout)))
+		sequences = append(sequences, psbtSequenceRbfEnabled)
+	}
+
+	p, err := psbt.New(outPoints, outputs, 2, 0, sequences)
+	if err != nil {
+		return "", err
+	}
+	u, err := psbt.NewUpdater(p)
+	if err != nil {
+		return "", err
+	}
+	for i, in := range inputs {
+		script, err := hex.DecodeString(in.Utxo.Script)
+		if err != nil {
+			return "", err
+		}
+		if txscript.IsWitnessProgram(script) {
+			if err := u.AddInWitnessUtxo(wire.NewTxOut(in.Utxo.Value, script), i); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if len(in.PrevTx) == 0 {
+			return "", fmt.Errorf("input %s:%d requires its previous transaction", in.Utxo.TxHash, in.Utxo.Vout)
+		}
+		prevTx := &wire.MsgTx{}
+		if err := prevTx.Deserialize(bytes.NewReader(in.PrevTx)); err != nil {
+			return "", err
+		}
+		if err := u.AddInNonWitnessUtxo(prevTx, i); err != nil {
+			return "", err
+		}
+	}
+
+	return p.B64Encode()
+}
+
+// ExtractPsbtTransaction decode a signed base64 psbt, finalize its inputs if needed and extract the network transaction
+func ExtractPsbtTransaction(encoded string) (*wire.MsgTx, error) {
+	p, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		return nil, err
+	}
+	for i := range p.Inputs {
+		if _, err := psbt.MaybeFinalize(p, i); err != nil {
+			return nil, fmt.Errorf("input %d: %v", i, err)
+		}
+	}
+	return psbt.Extract(p)
+}
+
+// PsbtUnsignedTransaction decode the unsigned transaction of a base64 psbt
+func PsbtUnsignedTransaction(encoded string) (*wire.MsgTx, error) {
+	p, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		return nil, err
+	}
+	return p.UnsignedTx, nil
+}
+
+// DecodeRawTransaction decode a hex encoded network transaction
+func DecodeRawTransaction(rawTx string) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// EncodeRawTransaction encode a network transaction in hex
+func EncodeRawTransaction(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
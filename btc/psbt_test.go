@@ -0,0 +1,132 @@
+package btc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/psbt"
+)
+
+// testPrevTx transaction paying value to each of the scripts
+func testPrevTx(values []int64, scripts [][]byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 0xffffffff}, []byte{0x51}, nil))
+	for i, s := range scripts {
+		tx.AddTxOut(wire.NewTxOut(values[i], s))
+	}
+	return tx
+}
+
+// signPsbt sign every input of a base64 psbt with key, as an offline signer would, without finalizing them
+func signPsbt(t *testing.T, encoded string, key *btcec.PrivateKey) string {
+	t.Helper()
+	p, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := psbt.NewUpdater(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := key.PubKey().SerializeCompressed()
+	for i, in := range p.Inputs {
+		var sig []byte
+		if in.WitnessUtxo != nil {
+			sig, err = txscript.RawTxInWitnessSignature(p.UnsignedTx, txscript.NewTxSigHashes(p.UnsignedTx), i,
+				in.WitnessUtxo.Value, in.WitnessUtxo.PkScript, txscript.SigHashAll, key)
+		} else {
+			script := in.NonWitnessUtxo.TxOut[p.UnsignedTx.TxIn[i].PreviousOutPoint.Index].PkScript
+			sig, err = txscript.RawTxInSignature(p.UnsignedTx, i, script, txscript.SigHashAll, key)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.Sign(i, sig, pubKey, nil, nil); err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+	}
+	signed, err := p.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestPsbtRoundTrip(t *testing.T) {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := btcutil.Hash160(key.PubKey().SerializeCompressed())
+	p2wpkh, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(hash).Script()
+	p2pkh, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).AddData(hash).
+		AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+
+	values := []int64{50000, 30000}
+	prev := testPrevTx(values, [][]byte{p2wpkh, p2pkh})
+	var prevRaw bytes.Buffer
+	if err := prev.Serialize(&prevRaw); err != nil {
+		t.Fatal(err)
+	}
+	inputs := []*PsbtInput{
+		{Utxo: &Utxo{TxHash: prev.TxHash().String(), Vout: 0, Value: values[0], Script: hex.EncodeToString(p2wpkh)}},
+		{Utxo: &Utxo{TxHash: prev.TxHash().String(), Vout: 1, Value: values[1], Script: hex.EncodeToString(p2pkh)}, PrevTx: prevRaw.Bytes()},
+	}
+	outputs := []*wire.TxOut{wire.NewTxOut(70000, p2wpkh), wire.NewTxOut(9000, p2pkh)}
+
+	encoded, err := NewPsbt(inputs, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the unsigned psbt is well formed and can't be extracted
+	p, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.UnsignedTx.TxIn) != 2 || len(p.UnsignedTx.TxOut) != 2 || p.UnsignedTx.TxIn[0].Sequence != psbtSequenceRbfEnabled {
+		t.Fatalf("unexpected unsigned transaction %+v", p.UnsignedTx)
+	}
+	if p.Inputs[0].WitnessUtxo == nil || p.Inputs[1].NonWitnessUtxo == nil {
+		t.Fatal("inputs miss their utxo")
+	}
+	if _, err := ExtractPsbtTransaction(encoded); err == nil {
+		t.Fatal("extracted an unsigned psbt")
+	}
+	unsigned, err := PsbtUnsignedTransaction(encoded)
+	if err != nil || unsigned.TxHash() != p.UnsignedTx.TxHash() {
+		t.Fatalf("unsigned transaction %v (%v), want %v", unsigned, err, p.UnsignedTx)
+	}
+
+	tx, err := ExtractPsbtTransaction(signPsbt(t, encoded, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, in := range inputs {
+		if tx.TxIn[i].PreviousOutPoint != unsigned.TxIn[i].PreviousOutPoint {
+			t.Fatalf("input %d spends %v, want %v", i, tx.TxIn[i].PreviousOutPoint, unsigned.TxIn[i].PreviousOutPoint)
+		}
+		script, _ := hex.DecodeString(in.Utxo.Script)
+		engine, err := txscript.NewEngine(script, tx, i, txscript.StandardVerifyFlags, nil, txscript.NewTxSigHashes(tx), in.Utxo.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Execute(); err != nil {
+			t.Fatalf("input %d doesn't spend its utxo: %v", i, err)
+		}
+	}
+}
+
+func TestNewPsbtRequiresPrevTx(t *testing.T) {
+	p2pkh := "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"
+	inputs := []*PsbtInput{{Utxo: &Utxo{TxHash: strings.Repeat("ab", 32), Vout: 0, Value: 1000, Script: p2pkh}}}
+	if _, err := NewPsbt(inputs, []*wire.TxOut{wire.NewTxOut(500, nil)}); err == nil {
+		t.Fatal("built a psbt without the previous transaction of a legacy input")
+	}
+}
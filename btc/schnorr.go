@@ -0,0 +1,71 @@
+package btc
+
+import (
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// TaggedHash BIP-340 hash of msg under tag
+func TaggedHash(tag string, msg ...[]byte) []byte {
+	t := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(t[:])
+	h.Write(t[:])
+	for _, m := range msg {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
+
+// liftX point of even y whose x coordinate is x, nil if there is none
+func liftX(x *big.Int) (*big.Int, *big.Int) {
+	curve := btcec.S256()
+	p := curve.P
+	if x.Cmp(p) >= 0 {
+		return nil, nil
+	}
+	// y² = x³ + 7, p = 3 mod 4 so the root is c^((p+1)/4)
+	c := new(big.Int).Exp(x, big.NewInt(3), p)
+	c.Add(c, big.NewInt(7))
+	c.Mod(c, p)
+	exp := new(big.Int).Add(p, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(c, exp, p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(c) != 0 {
+		return nil, nil
+	}
+	if y.Bit(0) == 1 {
+		y.Sub(p, y)
+	}
+	return x, y
+}
+
+// VerifySchnorr verify a BIP-340 signature of a 32 bytes message by an x-only public key
+func VerifySchnorr(pubKey, msg, sig []byte) bool {
+	if len(pubKey) != 32 || len(msg) != 32 || len(sig) != 64 {
+		return false
+	}
+	curve := btcec.S256()
+	px, py := liftX(new(big.Int).SetBytes(pubKey))
+	if px == nil {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(curve.P) >= 0 || s.Cmp(curve.N) >= 0 {
+		return false
+	}
+
+	e := new(big.Int).SetBytes(TaggedHash("BIP0340/challenge", sig[:32], pubKey, msg))
+	e.Mod(e, curve.N)
+	// R = s⋅G - e⋅P
+	sx, sy := curve.ScalarBaseMult(s.Bytes())
+	ex, ey := curve.ScalarMult(px, py, new(big.Int).Sub(curve.N, e).Bytes())
+	rx, ry := curve.Add(sx, sy, ex, ey)
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return ry.Bit(0) == 0 && rx.Cmp(r) == 0
+}
@@ -0,0 +1,34 @@
+package btc
+
+import "strings"
+
+// Script types of an output locking script
+const (
+	ScriptP2PKH    = "p2pkh"
+	ScriptP2SH     = "p2sh"
+	ScriptP2WPKH   = "p2wpkh"
+	ScriptP2WSH    = "p2wsh"
+	ScriptP2TR     = "p2tr"
+	ScriptNullData = "nulldata"
+	ScriptUnknown  = "unknown"
+)
+
+// ScriptType detect the type of a locking script from its hex representation
+func ScriptType(script string) string {
+	s := strings.ToLower(script)
+	switch {
+	case len(s) == 50 && strings.HasPrefix(s, "76a914") && strings.HasSuffix(s, "88ac"):
+		return ScriptP2PKH
+	case len(s) == 46 && strings.HasPrefix(s, "a914") && strings.HasSuffix(s, "87"):
+		return ScriptP2SH
+	case len(s) == 44 && strings.HasPrefix(s, "0014"):
+		return ScriptP2WPKH
+	case len(s) == 68 && strings.HasPrefix(s, "0020"):
+		return ScriptP2WSH
+	case len(s) == 68 && strings.HasPrefix(s, "5120"):
+		return ScriptP2TR
+	case strings.HasPrefix(s, "6a"):
+		return ScriptNullData
+	}
+	return ScriptUnknown
+}
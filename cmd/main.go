@@ -3,18 +3,78 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 
 	functions "github.com/SoteriaTech/blockchain-functions"
+	"github.com/SoteriaTech/blockchain-functions/openapi"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
 )
 
 func main() {
 	ctx := context.Background()
-	funcframework.RegisterHTTPFunctionContext(ctx, "/SyncBtcBalance", functions.SyncBtcBalance)
-	funcframework.RegisterHTTPFunctionContext(ctx, "/ScanBtcBlock", functions.ScanBtcBlock)
-	funcframework.RegisterHTTPFunctionContext(ctx, "/test", functions.ScanBtcHead)
+	// responses of the local server are checked against the OpenAPI specification
+	for path, fn := range map[string]func(http.ResponseWriter, *http.Request){
+		"/SyncBtcBalance":         functions.SyncBtcBalance,
+		"/RegisterWebhook":        functions.RegisterWebhook,
+		"/ListWebhooks":           functions.ListWebhooks,
+		"/RotateWebhookSecret":    functions.RotateWebhookSecret,
+		"/ReplayWebhookDelivery":  functions.ReplayWebhookDelivery,
+		"/RelayOutbox":            functions.RelayOutbox,
+		"/ReconcileBtcBalances":   functions.ReconcileBtcBalances,
+		"/GenerateReserveReport":  functions.GenerateReserveReport,
+		"/GetReserveReport":       functions.GetReserveReport,
+		"/GetReserveProof":        functions.GetReserveProof,
+		"/ScanBtcBlock":           functions.ScanBtcBlock,
+		"/RegisterBtcAccount":     functions.RegisterBtcAccount,
+		"/CreateAddressChallenge": functions.CreateAddressChallenge,
+		"/VerifyBtcAddress":       functions.VerifyBtcAddress,
+		"/BackfillBtcAccount":     functions.BackfillBtcAccount,
+		"/GetBtcUtxos":            functions.GetBtcUtxos,
+		"/ListBtcTransactions":    functions.ListBtcTransactions,
+		"/CreateBtcWithdrawal":    functions.CreateBtcWithdrawal,
+		"/SubmitBtcWithdrawal":    functions.SubmitBtcWithdrawal,
+		"/ListBtcWithdrawals":     functions.ListBtcWithdrawals,
+		"/ListScreeningAlerts":    functions.ListScreeningAlerts,
+		"/FreezeBtcAccount":       functions.FreezeBtcAccount,
+		"/UnfreezeBtcAccount":     functions.UnfreezeBtcAccount,
+		"/CloseBtcAccount":        functions.CloseBtcAccount,
+		"/ListBtcAccountAudit":    functions.ListBtcAccountAudit,
+		"/ListBtcDepositReviews":  functions.ListBtcDepositReviews,
+		"/ApproveBtcDeposit":      functions.ApproveBtcDeposit,
+		"/RejectBtcDeposit":       functions.RejectBtcDeposit,
+		"/ApproveBtcWithdrawal":   functions.ApproveBtcWithdrawal,
+		"/CancelBtcWithdrawal":    functions.CancelBtcWithdrawal,
+		"/CreateInvoice":          functions.CreateInvoice,
+		"/GetInvoice":             functions.GetInvoice,
+		"/ListInvoices":           functions.ListInvoices,
+		"/GetBtcFeeEstimate":      functions.GetBtcFeeEstimate,
+		"/GetBalanceHistory":      functions.GetBalanceHistory,
+		"/GetBtcRate":             functions.GetBtcRate,
+		"/ListConvertRequests":    functions.ListConvertRequests,
+		"/ProcessConvertRequests": functions.ProcessConvertRequests,
+		"/test":                   functions.ScanBtcHead,
+	} {
+		if !openapi.Documented(path) {
+			log.Fatalf("%s is missing from the openapi specification", path)
+		}
+		funcframework.RegisterHTTPFunctionContext(ctx, path, openapi.Contract(path, fn))
+	}
+	funcframework.RegisterHTTPFunctionContext(ctx, "/openapi.json", openapi.ServeSpec)
+	// streams are written as they go, so their responses aren't validated
+	funcframework.RegisterHTTPFunctionContext(ctx, "/StreamBtcBalance", functions.StreamBtcBalance)
+
+	// background functions are triggered by posting an event, see the samples of cmd/events
+	for path, fn := range map[string]interface{}{
+		"/BtcAccountCreated":     functions.BtcAccountCreated,
+		"/BtcAccountUpdated":     functions.BtcAccountUpdated,
+		"/ConvertRequestCreated": functions.ConvertRequestCreated,
+	} {
+		if err := funcframework.RegisterEventFunctionContext(ctx, path, fn); err != nil {
+			log.Fatalf("funcframework.RegisterEventFunctionContext: %v\n", err)
+		}
+	}
 
 	port := "8080"
 	if envPort := os.Getenv("PORT"); envPort != "" {
@@ -2,6 +2,9 @@ package env
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Constants for project ids
@@ -10,10 +13,77 @@ const (
 	PRODUCTION string = "soteria-production"
 )
 
+// Providers used to broadcast transactions, to estimate fees and to fetch addresses history
+const (
+	BlockInfoProvider = "blockinfo"
+	EsploraProvider   = "esplora"
+	BitcoindProvider  = "bitcoind"
+)
+
+// Publishers the outbox is relayed through
+const (
+	PubSubPublisher = "pubsub"
+	MemoryPublisher = "memory"
+)
+
+// Exchanges used as price sources
+const (
+	CoinbaseProvider = "coinbase"
+	KrakenProvider   = "kraken"
+	BitstampProvider = "bitstamp"
+)
+
 type globalEnv struct {
-	ProjectID string
-	Keypath   string
-	BtcChain  string
+	ProjectID        string
+	Keypath          string
+	BtcChain         string
+	Broadcaster      string
+	EsploraURL       string
+	BitcoindURL      string
+	BitcoindUser     string
+	BitcoindPassword string
+	FeeEstimator     string
+	HistoryProvider  string
+	FeeBlocks        int
+	// withdrawals of at least ApprovalThreshold satoshis require Approvers approvals instead of one
+	ApprovalThreshold int64
+	Approvers         int
+	// withdrawals whose transaction isn't mined BroadcastTimeout after its broadcast fail and release their hold
+	BroadcastTimeout time.Duration
+	// ID tokens are verified against the keys of AuthJWKSURL (an url or a local file)
+	AuthJWKSURL   string
+	AuthIssuers   []string
+	AuthAudience  string
+	AuthAdminRole string
+	// BtcXpub account extended public key from which addresses are assigned
+	BtcXpub string
+	// ConvertMaxSlippage maximum relative difference between the quoted and the market rate of a conversion
+	ConvertMaxSlippage float64
+	// rates are the median of PriceSources, ignoring rates older than PriceMaxAge and those deviating by more than
+	// PriceMaxDeviation, at least PriceMinSources must agree
+	PriceSources      []string
+	PriceMaxAge       time.Duration
+	PriceMaxDeviation float64
+	PriceMinSources   int
+	// PriceCurrencies fiat currencies whose btc rate is recorded along the scan
+	PriceCurrencies []string
+	// webhook deliveries are attempted at most WebhookMaxAttempts times, waiting twice as long after each
+	// failure starting from WebhookBackoff
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	// outbox events are published to OutboxPublisher topics named after their type, prefixed with OutboxTopicPrefix
+	OutboxPublisher   string
+	OutboxTopicPrefix string
+	// discrepancies of at most ReconcileTolerance btc are corrected by the reconciliation, none if it is 0
+	ReconcileTolerance float64
+	// proofs of reserves sum the balance of the account addresses and of ReserveAddresses, and are signed with the
+	// hex ed25519 seed ReservesSigningKey
+	ReserveAddresses   []string
+	ReservesSigningKey string
+	// BlocklistPath CSV or JSON file of the addresses deposits and withdrawals are screened against, if any
+	BlocklistPath string
+	// RiskRulesPath JSON file of the rules scoring the detected deposits, if any
+	RiskRulesPath string
 }
 
 // EnvVars container for global variables
@@ -35,9 +105,139 @@ func InitEnvVars() {
 		panic("project id is invalid")
 	}
 
+	broadcaster := os.Getenv("BTC_BROADCASTER")
+	if broadcaster == "" {
+		broadcaster = BlockInfoProvider
+	}
+	esploraURL := os.Getenv("ESPLORA_URL")
+	if esploraURL == "" {
+		esploraURL = "https://blockstream.info/testnet/api"
+		if projectID == PRODUCTION {
+			esploraURL = "https://blockstream.info/api"
+		}
+	}
+
+	feeBlocks, err := strconv.Atoi(os.Getenv("FEE_BLOCKS"))
+	if err != nil || feeBlocks <= 0 {
+		feeBlocks = 6
+	}
+
+	approvalThreshold, err := strconv.ParseInt(os.Getenv("WITHDRAWAL_APPROVAL_THRESHOLD"), 10, 64)
+	if err != nil || approvalThreshold <= 0 {
+		approvalThreshold = 10000000
+	}
+	approvers, err := strconv.Atoi(os.Getenv("WITHDRAWAL_APPROVERS"))
+	if err != nil || approvers <= 0 {
+		approvers = 2
+	}
+
+	// the default mempool expiry of bitcoind
+	broadcastTimeout, err := strconv.Atoi(os.Getenv("BROADCAST_TIMEOUT"))
+	if err != nil || broadcastTimeout <= 0 {
+		broadcastTimeout = 336
+	}
+
+	jwksURL := os.Getenv("AUTH_JWKS_URL")
+	if jwksURL == "" {
+		jwksURL = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+	}
+	issuers := []string{"https://securetoken.google.com/" + projectID}
+	if iss := os.Getenv("AUTH_ISSUERS"); iss != "" {
+		issuers = strings.Split(iss, ",")
+	}
+	audience := os.Getenv("AUTH_AUDIENCE")
+	if audience == "" {
+		audience = projectID
+	}
+	adminRole := os.Getenv("AUTH_ADMIN_ROLE")
+	if adminRole == "" {
+		adminRole = "admin"
+	}
+
+	maxSlippage, err := strconv.ParseFloat(os.Getenv("CONVERT_MAX_SLIPPAGE"), 64)
+	if err != nil || maxSlippage <= 0 {
+		maxSlippage = 0.01
+	}
+
+	priceSources := []string{CoinbaseProvider, KrakenProvider, BitstampProvider}
+	if sources := os.Getenv("PRICE_SOURCES"); sources != "" {
+		priceSources = strings.Split(sources, ",")
+	}
+	priceMaxAge, err := strconv.Atoi(os.Getenv("PRICE_MAX_AGE"))
+	if err != nil || priceMaxAge <= 0 {
+		priceMaxAge = 300
+	}
+	priceMaxDeviation, err := strconv.ParseFloat(os.Getenv("PRICE_MAX_DEVIATION"), 64)
+	if err != nil || priceMaxDeviation <= 0 {
+		priceMaxDeviation = 0.02
+	}
+	priceMinSources, err := strconv.Atoi(os.Getenv("PRICE_MIN_SOURCES"))
+	if err != nil || priceMinSources <= 0 {
+		priceMinSources = 2
+	}
+	priceCurrencies := []string{"EUR", "USD"}
+	if currencies := os.Getenv("PRICE_CURRENCIES"); currencies != "" {
+		priceCurrencies = strings.Split(currencies, ",")
+	}
+
+	webhookMaxAttempts, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+	if err != nil || webhookMaxAttempts <= 0 {
+		webhookMaxAttempts = 8
+	}
+	webhookBackoff, err := strconv.Atoi(os.Getenv("WEBHOOK_BACKOFF"))
+	if err != nil || webhookBackoff <= 0 {
+		webhookBackoff = 30
+	}
+
+	outboxPublisher := os.Getenv("OUTBOX_PUBLISHER")
+	if outboxPublisher == "" {
+		outboxPublisher = PubSubPublisher
+	}
+
+	reconcileTolerance, err := strconv.ParseFloat(os.Getenv("RECONCILE_TOLERANCE"), 64)
+	if err != nil || reconcileTolerance < 0 {
+		reconcileTolerance = 0
+	}
+
+	var reserveAddresses []string
+	if addrs := os.Getenv("RESERVE_ADDRESSES"); addrs != "" {
+		reserveAddresses = strings.Split(addrs, ",")
+	}
+
 	EnvVars = &globalEnv{
-		ProjectID: projectID,
-		Keypath:   keyPath,
-		BtcChain:  btcChain,
+		ProjectID:          projectID,
+		Keypath:            keyPath,
+		BtcChain:           btcChain,
+		Broadcaster:        broadcaster,
+		EsploraURL:         esploraURL,
+		BitcoindURL:        os.Getenv("BITCOIND_URL"),
+		BitcoindUser:       os.Getenv("BITCOIND_USER"),
+		BitcoindPassword:   os.Getenv("BITCOIND_PASSWORD"),
+		FeeEstimator:       os.Getenv("FEE_ESTIMATOR"),
+		HistoryProvider:    os.Getenv("BTC_HISTORY_PROVIDER"),
+		FeeBlocks:          feeBlocks,
+		ApprovalThreshold:  approvalThreshold,
+		Approvers:          approvers,
+		BroadcastTimeout:   time.Duration(broadcastTimeout) * time.Hour,
+		AuthJWKSURL:        jwksURL,
+		AuthIssuers:        issuers,
+		AuthAudience:       audience,
+		AuthAdminRole:      adminRole,
+		BtcXpub:            os.Getenv("BTC_XPUB"),
+		ConvertMaxSlippage: maxSlippage,
+		PriceSources:       priceSources,
+		PriceMaxAge:        time.Duration(priceMaxAge) * time.Second,
+		PriceMaxDeviation:  priceMaxDeviation,
+		PriceMinSources:    priceMinSources,
+		PriceCurrencies:    priceCurrencies,
+		WebhookMaxAttempts: webhookMaxAttempts,
+		WebhookBackoff:     time.Duration(webhookBackoff) * time.Second,
+		OutboxPublisher:    outboxPublisher,
+		OutboxTopicPrefix:  os.Getenv("OUTBOX_TOPIC_PREFIX"),
+		ReconcileTolerance: reconcileTolerance,
+		ReserveAddresses:   reserveAddresses,
+		ReservesSigningKey: os.Getenv("RESERVES_SIGNING_KEY"),
+		BlocklistPath:      os.Getenv("BLOCKLIST_PATH"),
+		RiskRulesPath:      os.Getenv("RISK_RULES_PATH"),
 	}
 }
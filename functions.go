@@ -2,129 +2,654 @@ package functions
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math"
+	"math/big"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/SoteriaTech/blockchain-functions/api"
+	"github.com/SoteriaTech/blockchain-functions/auth"
 	"github.com/SoteriaTech/blockchain-functions/btc"
 	"github.com/SoteriaTech/blockchain-functions/env"
 	"github.com/SoteriaTech/blockchain-functions/functions"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/outbox"
+	"github.com/SoteriaTech/blockchain-functions/price"
+	"github.com/SoteriaTech/blockchain-functions/reserves"
+	"github.com/SoteriaTech/blockchain-functions/risk"
+	"github.com/SoteriaTech/blockchain-functions/screening"
 	"github.com/SoteriaTech/blockchain-functions/store"
 	"github.com/SoteriaTech/blockchain-functions/utils"
+	"github.com/SoteriaTech/blockchain-functions/webhook"
 )
 
 const jsonContentType = "application/json"
 
+// streamKeepAlive interval of the comments keeping idle event streams open through proxies
+const streamKeepAlive = 15 * time.Second
+
 // init function is ran automatically by GCP prior to the rest
 func init() {
 	env.InitEnvVars()
 	utils.InitErrorReporting(env.EnvVars.ProjectID)
 	store.InitFirestoreStore()
 	api.InitBlockInfoClient()
-	btc.InitBtcService(api.BlockInfo)
+	btc.InitBtcService(api.BlockInfo, broadcaster(), addressHistory())
+	btc.InitFeeService(feeEstimator())
+	auth.InitVerifier()
+	webhook.InitSender()
+	outbox.InitRelay(outboxPublisher())
+	price.InitOracle(priceOracle())
+	api.InitCoinbaseClient()
+	price.InitHistory(api.Coinbase)
+	if err := reserves.InitSigner(env.EnvVars.ReservesSigningKey); err != nil {
+		log.Fatalf("Invalid reserves signing key %v", err)
+	}
+	if err := screening.InitBlocklist(env.EnvVars.BlocklistPath); err != nil {
+		log.Fatalf("Failed to load blocklist %v", err)
+	}
+	if err := risk.InitRules(env.EnvVars.RiskRulesPath); err != nil {
+		log.Fatalf("Invalid risk rules %v", err)
+	}
 }
 
-/***********************************************
-*
-* HTTP functions
-*
-***********************************************/
-
-// SyncBtcBalance function sync the btc balance of a given user's account
-func SyncBtcBalance(w http.ResponseWriter, r *http.Request) {
-
-	data, errReq := utils.RequestData(r)
-	if errReq != nil {
-		utils.ErrorReport.LogAndPrintError(errReq)
-		utils.RespondJSONWithError(w, 400, errReq.Error())
+// broadcaster get the provider configured to broadcast transactions
+func broadcaster() btc.Broadcaster {
+	switch env.EnvVars.Broadcaster {
+	case env.EsploraProvider:
+		api.InitEsploraClient()
+		return api.Esplora
+	case env.BitcoindProvider:
+		api.InitBitcoindClient()
+		return api.Bitcoind
 	}
+	return api.BlockInfo
+}
 
-	btcAccount, err := functions.SyncBtcBalance(data["uid"])
-	if err != nil {
-		utils.ErrorReport.LogAndPrintError(err.Err)
-		utils.RespondJSONWithError(w, err.Code, err.Err.Error())
+// feeEstimator get the provider configured to estimate fees, if any
+func feeEstimator() btc.FeeEstimator {
+	switch env.EnvVars.FeeEstimator {
+	case env.EsploraProvider:
+		api.InitEsploraClient()
+		return api.Esplora
+	case env.BitcoindProvider:
+		api.InitBitcoindClient()
+		return api.Bitcoind
 	}
-	utils.RespondJSON(w, 200, btcAccount)
+	return nil
 }
 
-// ScanBtcBlock scan a bitcoin blockchain block and parse it
-func ScanBtcBlock(w http.ResponseWriter, r *http.Request) {
-	data, errReq := utils.RequestData(r)
-	if errReq != nil {
-		utils.RespondJSONWithError(w, 400, errReq.Error())
+// addressHistory get the provider configured to fetch addresses history, if any
+func addressHistory() btc.AddressHistory {
+	if env.EnvVars.HistoryProvider == env.EsploraProvider {
+		api.InitEsploraClient()
+		return api.Esplora
 	}
+	return nil
+}
 
-	height, errConv := strconv.Atoi(data["height"])
-	if errConv != nil {
-		utils.ErrorReport.LogAndPrintError(errConv)
-		utils.RespondJSONWithError(w, 400, "error height format is incorrect")
-		return
+// outboxPublisher get the publisher configured to relay the outbox
+func outboxPublisher() outbox.Publisher {
+	if env.EnvVars.OutboxPublisher == env.MemoryPublisher {
+		return &outbox.MemoryPublisher{}
 	}
 
-	accs, errAccs := store.Firestore.GetAllAccountAddresses()
-	if errAccs != nil {
-		utils.RespondJSONWithError(w, 500, errAccs.Error())
-		return
+	p, err := outbox.NewPubSubPublisher(env.EnvVars.ProjectID, env.EnvVars.Keypath, env.EnvVars.OutboxTopicPrefix)
+	if err != nil {
+		log.Fatalf("Failed to create pubsub client %v", err)
 	}
+	return p
+}
 
-	rsp, err := functions.ScanBtcBlock(height, accs)
-	if err != nil {
-		utils.ErrorReport.LogAndPrintError(err)
-		utils.RespondJSONWithError(w, 500, err.Error())
+// priceOracle get the median of the configured price sources
+func priceOracle() price.PriceSource {
+	var sources []price.PriceSource
+	for _, s := range env.EnvVars.PriceSources {
+		switch s {
+		case env.CoinbaseProvider:
+			api.InitCoinbaseClient()
+			sources = append(sources, api.Coinbase)
+		case env.KrakenProvider:
+			api.InitKrakenClient()
+			sources = append(sources, api.Kraken)
+		case env.BitstampProvider:
+			api.InitBitstampClient()
+			sources = append(sources, api.Bitstamp)
+		default:
+			log.Printf("unknown price source %s", s)
+		}
 	}
 
-	utils.RespondJSON(w, 200, rsp)
+	minSources := env.EnvVars.PriceMinSources
+	if minSources > len(sources) {
+		minSources = len(sources)
+	}
+	return price.NewMedian(env.EnvVars.PriceMaxAge, env.EnvVars.PriceMaxDeviation, minSources, sources...)
 }
 
-// ScanBtcHead scan this is a replica of the pub/sub to test on the local server
-func ScanBtcHead(w http.ResponseWriter, r *http.Request) {
-	chain := env.EnvVars.BtcChain
-	cs, err := store.Firestore.GetChainState(chain)
+/***********************************************
+*
+* HTTP functions
+*
+* Every HTTP function authenticates its caller with a Firebase ID token, decodes and validates its typed
+* request, and writes exactly one response through handle
+*
+***********************************************/
+
+// handler body of an HTTP function, returning the payload of the response or an error
+type handler func(t *auth.Token) (interface{}, *utils.ErrorService)
+
+// handle run an HTTP function: authorize the caller, decode its request into req and write the single response of h
+func handle(w http.ResponseWriter, r *http.Request, admin bool, req utils.Request, h handler) {
+	rsp, err := run(r, admin, req, h)
 	if err != nil {
-		utils.RespondJSONWithError(w, 500, err.Error())
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		utils.RespondError(w, err)
 		return
 	}
+	utils.RespondJSON(w, 200, rsp)
+}
 
-	headBlock, err := btc.BtcService.GetHeadInfo()
-	if err != nil {
-		utils.RespondJSONWithError(w, 500, err.Error())
-		return
+func run(r *http.Request, admin bool, req utils.Request, h handler) (rsp interface{}, err *utils.ErrorService) {
+	defer func() {
+		if p := recover(); p != nil {
+			rsp, err = nil, &utils.ErrorService{Code: 500, Err: fmt.Errorf("panic: %v", p)}
+		}
+	}()
+
+	t, errAuth := auth.Authorize(r, admin)
+	if errAuth != nil {
+		return nil, errAuth
+	}
+	if errReq := utils.DecodeRequest(r, req); errReq != nil {
+		return nil, errReq
 	}
+	return h(t)
+}
 
-	if cs.Height == headBlock.Height {
-		utils.RespondJSON(w, 200, cs)
+// SyncBtcBalance function sync the btc balance of the caller's account
+func SyncBtcBalance(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.SyncBtcBalance(auth.TargetUID(t, req.UID))
+	})
+}
+
+// RegisterBtcAccount function register the btc account of the caller with its address, or with an assigned one
+func RegisterBtcAccount(w http.ResponseWriter, r *http.Request) {
+	req := &functions.RegisterBtcAccountRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.RegisterBtcAccount(auth.TargetUID(t, req.UID), req.Address)
+	})
+}
+
+// CreateAddressChallenge function issue a message to sign to prove that the caller controls an address
+func CreateAddressChallenge(w http.ResponseWriter, r *http.Request) {
+	req := &functions.CreateAddressChallengeRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.CreateAddressChallenge(auth.TargetUID(t, req.UID), req.Address)
+	})
+}
+
+// VerifyBtcAddress function verify the signature of a challenge and mark its address as verified on the caller's account
+func VerifyBtcAddress(w http.ResponseWriter, r *http.Request) {
+	req := &functions.VerifyBtcAddressRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.VerifyBtcAddress(auth.TargetUID(t, req.UID), req.ID, req.Signature)
+	})
+}
+
+// BackfillBtcAccount function record the transactions of the caller's address made before its registration
+func BackfillBtcAccount(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.BackfillBtcAccount(auth.TargetUID(t, req.UID))
+	})
+}
+
+// GetBtcUtxos function get the utxo set of the caller's account and its drift with the provider balance
+func GetBtcUtxos(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		set, err := functions.GetBtcUtxos(auth.TargetUID(t, req.UID))
+		if err != nil {
+			return nil, err
+		}
+		if set.Drift != 0 {
+			log.Printf("utxo set of %s drifts from provider balance by %d satoshis", set.UID, set.Drift)
+		}
+		return set, nil
+	})
+}
+
+// StreamBtcBalance function stream the balance and transaction changes of the caller's account as Server-Sent Events,
+// resuming after the event of the Last-Event-ID header. Served by the long-running server only, as it holds the
+// connection open
+func StreamBtcBalance(w http.ResponseWriter, r *http.Request) {
+	t, errAuth := auth.Authorize(r, false)
+	if errAuth != nil {
+		utils.RespondError(w, errAuth)
 		return
 	}
-	accs, errAccs := store.Firestore.GetAllAccountAddresses()
-	if errAccs != nil {
-		utils.RespondJSONWithError(w, 500, errAccs.Error())
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.RespondError(w, &utils.ErrorService{Code: 500, Err: fmt.Errorf("streaming unsupported")})
 		return
 	}
-	currHeight := cs.Height
-	var blocks []int
-	for {
-		currHeight++
+	uid := auth.TargetUID(t, r.URL.Query().Get("uid"))
 
-		_, errScan := functions.ScanBtcBlock(currHeight, accs)
-		if errScan != nil {
-			utils.ErrorReport.LogAndPrintError(errScan)
-			utils.RespondJSONWithError(w, 500, errScan.Error())
-		}
-		blocks = append(blocks, currHeight)
-		if currHeight == headBlock.Height {
-			break
+	var after *store.OutboxEventSchema
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		e, err := functions.FindAccountEvent(uid, lastID)
+		if err != nil {
+			utils.RespondError(w, err)
+			return
 		}
+		after = e
 	}
 
-	errUpdate := store.Firestore.UpdateChainState(chain, headBlock)
-	if errUpdate != nil {
-		utils.RespondJSONWithError(w, 500, errUpdate.Error())
-		return
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events := make(chan *store.OutboxEventSchema)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- functions.ListenAccountEvents(ctx, uid, after, func(e *store.OutboxEventSchema) error {
+			select {
+			case events <- e:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e := <-events:
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Payload)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case err := <-errc:
+			// the client reconnects with the id of the last event it received
+			if err != nil {
+				utils.ErrorReport.LogAndPrintError(err)
+			}
+			return
+		}
+		flusher.Flush()
 	}
+}
+
+// ListBtcTransactions function list the transactions of the caller's account, latest first, with cursor pagination
+func ListBtcTransactions(w http.ResponseWriter, r *http.Request) {
+	req := &functions.ListBtcTransactionsRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		filter, err := req.Filter()
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 400, Err: err}
+		}
+		return functions.ListBtcTransactions(auth.TargetUID(t, req.UID), filter, req.Cursor, req.Limit)
+	})
+}
+
+// CreateBtcWithdrawal function request the withdrawal of an amount (in btc) from the caller's account to an address
+func CreateBtcWithdrawal(w http.ResponseWriter, r *http.Request) {
+	req := &functions.CreateBtcWithdrawalRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		feeRate := req.FeeRate
+		if feeRate == 0 {
+			estimate, err := functions.GetBtcFeeEstimate()
+			if err != nil {
+				return nil, err
+			}
+			feeRate = int64(math.Ceil(estimate.Normal))
+		}
+
+		amount := helpers.FromBtcToSatoshi(big.NewFloat(req.Amount)).Int64()
+		return functions.CreateBtcWithdrawal(t.UID, req.To, amount, feeRate)
+	})
+}
+
+// CreateInvoice function create an invoice of an amount (in btc) to the caller's account, paid to a dedicated address
+func CreateInvoice(w http.ResponseWriter, r *http.Request) {
+	req := &functions.CreateInvoiceRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		amount := helpers.FromBtcToSatoshi(big.NewFloat(req.Amount)).Int64()
+		return functions.CreateInvoice(t.UID, amount, req.Memo, req.TTL())
+	})
+}
+
+// GetInvoice function get an invoice of the caller's account
+func GetInvoice(w http.ResponseWriter, r *http.Request) {
+	req := &functions.InvoiceRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.GetInvoice(auth.TargetUID(t, req.UID), req.ID)
+	})
+}
+
+// ListInvoices function list the invoices of the caller's account
+func ListInvoices(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ListInvoices(auth.TargetUID(t, req.UID))
+	})
+}
+
+// GetBtcFeeEstimate function get the fast, normal and slow fee rates (sat/vB) estimated from recent blocks
+func GetBtcFeeEstimate(w http.ResponseWriter, r *http.Request) {
+	handle(w, r, false, &functions.EmptyRequest{}, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.GetBtcFeeEstimate()
+	})
+}
+
+// SubmitBtcWithdrawal function broadcast a withdrawal signed offline, given as a psbt or a raw transaction. Admin only
+func SubmitBtcWithdrawal(w http.ResponseWriter, r *http.Request) {
+	req := &functions.SubmitBtcWithdrawalRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.SubmitBtcWithdrawal(req.ID, req.Psbt, req.Tx)
+	})
+}
+
+// ListBtcWithdrawals function list the withdrawal requests of the caller's account. Admins may list every request
+func ListBtcWithdrawals(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		uid := t.UID
+		if auth.Verifier.IsAdmin(t) {
+			uid = req.UID
+		}
+		return functions.ListBtcWithdrawals(uid)
+	})
+}
+
+// ListScreeningAlerts function list the alerts raised on deposits from and withdrawals to blocklisted addresses. Admin only
+func ListScreeningAlerts(w http.ResponseWriter, r *http.Request) {
+	req := &functions.ScreeningAlertsRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ListScreeningAlerts(req.Status)
+	})
+}
+
+// FreezeBtcAccount function freeze an account, its deposits are queued for review and it can't withdraw. Admin only
+func FreezeBtcAccount(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountStatusRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.FreezeBtcAccount(req.UID, t.UID, req.Reason)
+	})
+}
+
+// UnfreezeBtcAccount function make a frozen account active again. Admin only
+func UnfreezeBtcAccount(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountStatusRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.UnfreezeBtcAccount(req.UID, t.UID, req.Reason)
+	})
+}
+
+// CloseBtcAccount function close an account for good. Admin only
+func CloseBtcAccount(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountStatusRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.CloseBtcAccount(req.UID, t.UID, req.Reason)
+	})
+}
+
+// ListBtcAccountAudit function list the audit trail of an account. Admin only
+func ListBtcAccountAudit(w http.ResponseWriter, r *http.Request) {
+	req := &functions.AccountRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ListBtcAccountAudit(req.UID)
+	})
+}
+
+// ListBtcDepositReviews function list the deposits waiting for a review. Admin only
+func ListBtcDepositReviews(w http.ResponseWriter, r *http.Request) {
+	handle(w, r, true, &functions.EmptyRequest{}, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ListBtcDepositReviews()
+	})
+}
+
+// ApproveBtcDeposit function approve a deposit in review on behalf of the caller. Admin only
+func ApproveBtcDeposit(w http.ResponseWriter, r *http.Request) {
+	req := &functions.DepositRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ApproveBtcDeposit(req.ID, t.UID, req.Reason)
+	})
+}
+
+// RejectBtcDeposit function reject a deposit in review on behalf of the caller, it is never credited. Admin only
+func RejectBtcDeposit(w http.ResponseWriter, r *http.Request) {
+	req := &functions.DepositRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.RejectBtcDeposit(req.ID, t.UID, req.Reason)
+	})
+}
+
+// ApproveBtcWithdrawal function approve a withdrawal request on behalf of the caller. Admin only
+func ApproveBtcWithdrawal(w http.ResponseWriter, r *http.Request) {
+	req := &functions.WithdrawalRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ApproveBtcWithdrawal(req.ID, t.UID)
+	})
+}
+
+// CancelBtcWithdrawal function cancel a withdrawal request of the caller that hasn't been signed yet. Admins may
+// cancel any request
+func CancelBtcWithdrawal(w http.ResponseWriter, r *http.Request) {
+	req := &functions.WithdrawalRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		uid := t.UID
+		if auth.Verifier.IsAdmin(t) {
+			uid = ""
+		}
+		return functions.CancelBtcWithdrawal(req.ID, uid, req.Reason)
+	})
+}
+
+// GetBtcRate function get the btc rate in a currency, now or at a given time
+func GetBtcRate(w http.ResponseWriter, r *http.Request) {
+	req := &functions.GetBtcRateRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		at, _ := req.At()
+		return functions.GetBtcRate(req.Currency, at)
+	})
+}
+
+// GetBalanceHistory function get the balance time series of the caller's account, hourly or daily
+func GetBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	req := &functions.GetBalanceHistoryRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		from, to, _ := req.Period()
+		return functions.GetBalanceHistory(auth.TargetUID(t, req.UID), req.Granularity, from, to)
+	})
+}
+
+// ListConvertRequests function list the conversion requests of the caller's account, latest first, with cursor pagination
+func ListConvertRequests(w http.ResponseWriter, r *http.Request) {
+	req := &functions.PageRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ListConvertRequests(auth.TargetUID(t, req.UID), req.Cursor, req.Limit)
+	})
+}
+
+// ProcessConvertRequests function process the pending conversion requests of every account. Admin only
+func ProcessConvertRequests(w http.ResponseWriter, r *http.Request) {
+	handle(w, r, true, &functions.EmptyRequest{}, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ProcessConvertRequests()
+	})
+}
+
+// RegisterWebhook function register an endpoint receiving deposit events, its signing secret is returned once. Admin only
+func RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	req := &functions.RegisterWebhookRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.RegisterWebhook(req.URL, req.Events)
+	})
+}
+
+// ListWebhooks function list the registered webhooks. Admin only
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	handle(w, r, true, &functions.EmptyRequest{}, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ListWebhooks()
+	})
+}
 
-	utils.RespondJSON(w, 200, blocks)
-	return
+// RotateWebhookSecret function replace the signing secret of a webhook, the new secret is returned once. Admin only
+func RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	req := &functions.IDRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.RotateWebhookSecret(req.ID)
+	})
+}
+
+// ReplayWebhookDelivery function deliver again an event to a webhook. Admin only
+func ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	req := &functions.IDRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ReplayWebhookDelivery(req.ID)
+	})
+}
+
+// RelayOutbox function publish the pending events of the outbox. Admin only
+func RelayOutbox(w http.ResponseWriter, r *http.Request) {
+	handle(w, r, true, &functions.EmptyRequest{}, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		n, err := functions.RelayOutbox()
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 502, Err: err}
+		}
+		return map[string]int{"published": n}, nil
+	})
+}
+
+// ReconcileBtcBalances function reconcile the stored btc balances with the transactions and the chain. Admin only
+func ReconcileBtcBalances(w http.ResponseWriter, r *http.Request) {
+	handle(w, r, true, &functions.EmptyRequest{}, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.ReconcileBtcBalances()
+	})
+}
+
+// GenerateReserveReport function generate a signed proof of reserves. Admin only
+func GenerateReserveReport(w http.ResponseWriter, r *http.Request) {
+	req := &functions.GenerateReserveReportRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.GenerateReserveReport(req.Height)
+	})
+}
+
+// GetReserveReport function get a proof of reserves, the latest one by default
+func GetReserveReport(w http.ResponseWriter, r *http.Request) {
+	req := &functions.ReserveReportRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.GetReserveReport(req.ID)
+	})
+}
+
+// GetReserveProof function get the inclusion proof of the caller's balance in a proof of reserves
+func GetReserveProof(w http.ResponseWriter, r *http.Request) {
+	req := &functions.ReserveProofRequest{}
+	handle(w, r, false, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		return functions.GetReserveProof(auth.TargetUID(t, req.UID), req.Report)
+	})
+}
+
+// ScanBtcBlock scan a bitcoin blockchain block and parse it. Admin only
+func ScanBtcBlock(w http.ResponseWriter, r *http.Request) {
+	req := &functions.ScanBtcBlockRequest{}
+	handle(w, r, true, req, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		accs, errAccs := store.Firestore.GetAllAccountAddresses()
+		if errAccs != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: errAccs}
+		}
+
+		rsp, err := functions.ScanBtcBlock(req.Height, accs)
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: err}
+		}
+		return rsp, nil
+	})
+}
+
+// ScanBtcHead scan this is a replica of the pub/sub to test on the local server. Admin only
+func ScanBtcHead(w http.ResponseWriter, r *http.Request) {
+	handle(w, r, true, &functions.EmptyRequest{}, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		chain := env.EnvVars.BtcChain
+		cs, err := store.Firestore.GetChainState(chain)
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: err}
+		}
+
+		headBlock, err := btc.BtcService.GetHeadInfo()
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 502, Err: err}
+		}
+
+		if _, errRetry := functions.RetryWebhookDeliveries(); errRetry != nil {
+			utils.ErrorReport.LogAndPrintError(errRetry)
+		}
+		if _, errMatch := functions.MatchMempoolInvoices(); errMatch != nil {
+			utils.ErrorReport.LogAndPrintError(errMatch)
+		}
+		if headBlock.Height < cs.Height || (headBlock.Height == cs.Height && cs.Hash != "" && headBlock.Hash != cs.Hash) {
+			fork, errRollback := functions.RollbackBtcChain(chain, headBlock.Height)
+			if errRollback != nil {
+				return nil, &utils.ErrorService{Code: 500, Err: errRollback}
+			}
+			cs.Height = fork
+		}
+		if cs.Height == headBlock.Height {
+			return cs, nil
+		}
+		accs, errAccs := store.Firestore.GetAllAccountAddresses()
+		if errAccs != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: errAccs}
+		}
+		currHeight := cs.Height
+		blocks := []int{}
+		for {
+			currHeight++
+
+			_, errScan := functions.ScanBtcBlock(currHeight, accs)
+			if errScan == functions.ErrBtcReorg {
+				if _, errRollback := functions.RollbackBtcChain(chain, currHeight-1); errRollback != nil {
+					return nil, &utils.ErrorService{Code: 500, Err: errRollback}
+				}
+				return blocks, nil
+			}
+			if errScan != nil {
+				return nil, &utils.ErrorService{Code: 500, Err: errScan}
+			}
+			blocks = append(blocks, currHeight)
+			if currHeight == headBlock.Height {
+				break
+			}
+		}
+
+		if errUpdate := store.Firestore.UpdateChainState(chain, headBlock); errUpdate != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: errUpdate}
+		}
+		if errSnap := functions.SnapshotBalances(headBlock); errSnap != nil {
+			utils.ErrorReport.LogAndPrintError(errSnap)
+		}
+		if _, errDeliver := functions.RetryWebhookDeliveries(); errDeliver != nil {
+			utils.ErrorReport.LogAndPrintError(errDeliver)
+		}
+		if _, errRelay := functions.RelayOutbox(); errRelay != nil {
+			utils.ErrorReport.LogAndPrintError(errRelay)
+		}
+
+		return blocks, nil
+	})
 }
 
 /***********************************************
@@ -149,19 +674,36 @@ func ScanBtcPubSub(ctx context.Context, m PubSubMessage) error {
 		return err
 	}
 
+	// failed webhook deliveries are retried along the scan
+	if _, errRetry := functions.RetryWebhookDeliveries(); errRetry != nil {
+		utils.ErrorReport.LogAndPrintError(errRetry)
+	}
+
+	// invoices are matched with the mempool even when no block was mined
+	if _, errMatch := functions.MatchMempoolInvoices(); errMatch != nil {
+		utils.ErrorReport.LogAndPrintError(errMatch)
+	}
+
 	headBlock, err := btc.BtcService.GetHeadInfo()
 	if err != nil {
 		utils.ErrorReport.LogAndPrintError(err)
 		return err
 	}
 
+	// a head lower than the scanned chain, or another block at its height, was reached through a reorg
+	if headBlock.Height < cs.Height || (headBlock.Height == cs.Height && cs.Hash != "" && headBlock.Hash != cs.Hash) {
+		fork, errRollback := functions.RollbackBtcChain(chain, headBlock.Height)
+		if errRollback != nil {
+			utils.ErrorReport.LogAndPrintError(errRollback)
+			return errRollback
+		}
+		cs.Height = fork
+	}
 	// if the head block hasn't changed we do nothing
 	if cs.Height == headBlock.Height {
 		return nil
 	}
 
-	//TODO : handle case if headBlock.Height < cs.Height (eg. reorg), if that's the case we may want to rollback some stuff
-
 	accs, errAccs := store.Firestore.GetAllAccountAddresses()
 	if errAccs != nil {
 		utils.ErrorReport.LogAndPrintError(errAccs)
@@ -175,6 +717,15 @@ func ScanBtcPubSub(ctx context.Context, m PubSubMessage) error {
 		currHeight++
 
 		_, errScan := functions.ScanBtcBlock(currHeight, accs)
+		// the blocks replaced by the reorg are rolled back, the next scan records the best chain
+		if errScan == functions.ErrBtcReorg {
+			if _, errRollback := functions.RollbackBtcChain(chain, currHeight-1); errRollback != nil {
+				utils.ErrorReport.LogAndPrintError(errRollback)
+				return errRollback
+			}
+			log.Printf("Reorg at block %d, blocks aggregated: %v", currHeight, blocks)
+			return nil
+		}
 		if errScan != nil {
 			utils.ErrorReport.LogAndPrintError(errScan)
 			// we stop right here if we get an error
@@ -192,6 +743,147 @@ func ScanBtcPubSub(ctx context.Context, m PubSubMessage) error {
 		utils.ErrorReport.LogAndPrintError(errUpdate)
 		return errUpdate
 	}
+
+	// a failed snapshot is taken again along the next block
+	if errSnap := functions.SnapshotBalances(headBlock); errSnap != nil {
+		utils.ErrorReport.LogAndPrintError(errSnap)
+	}
+
+	// the deliveries queued by the scan are attempted once it is done
+	if _, errDeliver := functions.RetryWebhookDeliveries(); errDeliver != nil {
+		utils.ErrorReport.LogAndPrintError(errDeliver)
+	}
+
+	// events left unpublished are relayed along the next scan or by RelayOutboxPubSub
+	if _, errRelay := functions.RelayOutbox(); errRelay != nil {
+		utils.ErrorReport.LogAndPrintError(errRelay)
+	}
 	log.Printf("Blocks  aggregated: %v", blocks)
 	return nil
 }
+
+// RelayOutboxPubSub publish the pending events of the outbox, triggered on a schedule so that events are relayed
+// even when no block is scanned
+func RelayOutboxPubSub(ctx context.Context, m PubSubMessage) error {
+	n, err := functions.RelayOutbox()
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err)
+		return err
+	}
+	log.Printf("Outbox relayed: %d events", n)
+	return nil
+}
+
+// ReconcileBtcPubSub reconcile the stored btc balances, triggered on a schedule
+func ReconcileBtcPubSub(ctx context.Context, m PubSubMessage) error {
+	run, err := functions.ReconcileBtcBalances()
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		return err.Err
+	}
+	log.Printf("Reconciliation %s: %d open, %d corrected, %d failed", run.ID, run.Open, run.Corrected, run.Failed)
+	return nil
+}
+
+/***********************************************
+*
+* Firestore functions
+*
+***********************************************/
+
+// FirestoreEvent is the payload of a Firestore event.
+// See the documentation for more details:
+// https://cloud.google.com/functions/docs/calling/cloud-firestore#event_structure
+type FirestoreEvent struct {
+	OldValue   FirestoreValue `json:"oldValue"`
+	Value      FirestoreValue `json:"value"`
+	UpdateMask struct {
+		FieldPaths []string `json:"fieldPaths"`
+	} `json:"updateMask"`
+}
+
+// FirestoreValue holds the document of a Firestore event
+type FirestoreValue struct {
+	CreateTime time.Time              `json:"createTime"`
+	Fields     map[string]interface{} `json:"fields"`
+	Name       string                 `json:"name"`
+	UpdateTime time.Time              `json:"updateTime"`
+}
+
+// ID id of the document, last segment of its name
+func (v *FirestoreValue) ID() string {
+	return v.Name[strings.LastIndex(v.Name, "/")+1:]
+}
+
+// Path segments of the path of the document, from its root collection
+func (v *FirestoreValue) Path() []string {
+	return strings.Split(v.Name[strings.Index(v.Name, "/documents/")+len("/documents/"):], "/")
+}
+
+// String value of a string field of the document, empty if it isn't set
+func (v *FirestoreValue) String(field string) string {
+	f, _ := v.Fields[field].(map[string]interface{})
+	s, _ := f["stringValue"].(string)
+	return s
+}
+
+// BtcAccountCreated index the address of a btc account when it is created and backfill its history
+// (providers/cloud.firestore/eventTypes/document.create on btc_accounts/{uid})
+func BtcAccountCreated(ctx context.Context, e FirestoreEvent) error {
+	return onBtcAccountWrite(e.Value.ID(), e.Value.String("address"), "")
+}
+
+// BtcAccountUpdated index the new address of a btc account when it changes and backfill its history
+// (providers/cloud.firestore/eventTypes/document.update on btc_accounts/{uid})
+func BtcAccountUpdated(ctx context.Context, e FirestoreEvent) error {
+	address, oldAddress := e.Value.String("address"), e.OldValue.String("address")
+	if address == oldAddress {
+		return nil
+	}
+	return onBtcAccountWrite(e.Value.ID(), address, oldAddress)
+}
+
+func onBtcAccountWrite(uid, address, oldAddress string) error {
+	if err := functions.IndexBtcAccount(uid, address, oldAddress); err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		// an invalid or duplicated address won't get any better by retrying
+		if err.Code < 500 {
+			return nil
+		}
+		return err.Err
+	}
+
+	b, err := functions.BackfillBtcAccount(uid)
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		return err.Err
+	}
+	log.Printf("Backfilled %d transactions of %s", b.Transactions, b.Address)
+	return nil
+}
+
+// ConvertRequestCreated process a conversion request when it is created
+// (providers/cloud.firestore/eventTypes/document.create on convert_history/{uid}/history/{id})
+func ConvertRequestCreated(ctx context.Context, e FirestoreEvent) error {
+	path := e.Value.Path()
+	if len(path) != 4 {
+		return fmt.Errorf("unexpected conversion request document %s", e.Value.Name)
+	}
+
+	// the app may write requests without a status, they are pending until processed
+	if errStatus := store.Firestore.BackfillConvertRequestStatus(path[1], path[3]); errStatus != nil {
+		utils.ErrorReport.LogAndPrintError(errStatus)
+		return errStatus
+	}
+
+	r, err := functions.ProcessConvertRequest(path[1], path[3])
+	if err != nil {
+		utils.ErrorReport.LogAndPrintError(err.Err)
+		if err.Code < 500 {
+			return nil
+		}
+		return err.Err
+	}
+	log.Printf("Conversion request %s of %s %s %s", r.ID, r.UID, r.Status, r.Reason)
+	return nil
+}
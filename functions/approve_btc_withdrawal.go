@@ -0,0 +1,48 @@
+package functions
+
+import (
+	"errors"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// errAlreadyApproved the approver already approved the withdrawal request
+var errAlreadyApproved = errors.New("withdrawal already approved by this approver")
+
+// ApproveBtcWithdrawal record the approval of a withdrawal request by an approver, the request is approved
+// once it has collected its required approvals
+func ApproveBtcWithdrawal(id, approver string) (*store.BtcWithdrawalSchema, *utils.ErrorService) {
+	w, errFind := store.Firestore.FindBtcWithdrawal(id)
+	if errFind != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errFind}
+	}
+	if errStatus := activeBtcAccount(w.UID); errStatus != nil {
+		return nil, errStatus
+	}
+	if approver == "" || approver == w.UID {
+		return nil, &utils.ErrorService{Code: 403, Err: errors.New("withdrawal cannot be approved by its requester")}
+	}
+
+	// concurrent approvals are serialized by the transaction, none is lost
+	w, err := store.Firestore.TransitionBtcWithdrawal(id, []string{store.WithdrawalRiskChecked}, func(w *store.BtcWithdrawalSchema) error {
+		for _, a := range w.Approvals {
+			if a == approver {
+				return errAlreadyApproved
+			}
+		}
+		w.Approvals = append(w.Approvals, approver)
+		if len(w.Approvals) >= w.RequiredApprovals {
+			w.Status = store.WithdrawalApproved
+		}
+		return nil
+	})
+	if err == errAlreadyApproved {
+		return nil, &utils.ErrorService{Code: 409, Err: err}
+	}
+	if err != nil {
+		return nil, transitionError(err, "approved")
+	}
+
+	return w, nil
+}
@@ -0,0 +1,229 @@
+package functions
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/risk"
+	"github.com/SoteriaTech/blockchain-functions/screening"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// BackfillBtcAccount record the transactions made to and from the address of a user's uid before it was registered,
+// up to the last scanned block, and reconcile its balance. Transactions already recorded are left untouched so
+// that it can be ran again
+func BackfillBtcAccount(uid string) (*store.BtcBackfillSchema, *utils.ErrorService) {
+	acc, errAcc := store.Firestore.FindBtcAccount(uid)
+	if errAcc != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errAcc}
+	}
+	// the balance of a frozen or closed account only changes through reviews
+	if !acc.Active() {
+		return nil, &utils.ErrorService{Code: 403, Err: fmt.Errorf("account is %s", acc.Status)}
+	}
+
+	b, errFind := store.Firestore.FindBtcBackfill(acc.Address)
+	if errFind != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errFind}
+	}
+	if b == nil {
+		b = &store.BtcBackfillSchema{UID: uid, Address: acc.Address, CreatedAt: time.Now()}
+	}
+	b.Status = store.BackfillRunning
+	b.Error = ""
+	b.UpdatedAt = time.Now()
+	if err := store.Firestore.SaveBtcBackfill(b); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	n, err := backfillBtcAddress(acc)
+	b.Transactions = n
+	b.Status = store.BackfillDone
+	b.UpdatedAt = time.Now()
+	if err != nil {
+		b.Status = store.BackfillFailed
+		b.Error = err.Err.Error()
+	}
+	if errSave := store.Firestore.SaveBtcBackfill(b); errSave != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errSave}
+	}
+
+	return b, err
+}
+
+// backfillBtcAddress record the history of the address of an account and return the number of transactions recorded
+func backfillBtcAddress(acc *store.BtcAccountSchema) (int, *utils.ErrorService) {
+	cs, errCs := store.Firestore.GetChainState(env.EnvVars.BtcChain)
+	if errCs != nil {
+		return 0, &utils.ErrorService{Code: 500, Err: errCs}
+	}
+
+	history, errHistory := btc.BtcService.GetAddressHistory(acc.Address)
+	if errHistory != nil {
+		return 0, &utils.ErrorService{Code: 502, Err: errHistory}
+	}
+
+	// the blocks after the chain state are left to the block scan
+	var txs []*btc.Transaction
+	for _, t := range history {
+		if t.BlockHeight <= cs.Height {
+			txs = append(txs, t)
+		}
+	}
+
+	// utxos are identified by the blockchain.info transaction index, which not every provider has
+	var indexed []*btc.Transaction
+	for _, t := range txs {
+		if t.TxIndex.Sign() != 0 {
+			indexed = append(indexed, t)
+		}
+	}
+	if err := UpdateBtcUtxos(indexed, []*store.BtcAccountSchema{acc}); err != nil {
+		return 0, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	// our own withdrawals are settled by ConfirmBtcWithdrawal
+	withdrawals := make(map[string]bool)
+	for _, t := range txs {
+		w, errW := store.Firestore.FindBtcWithdrawalByTxHash(t.Hash)
+		if errW != nil {
+			return 0, &utils.ErrorService{Code: 500, Err: errW}
+		}
+		withdrawals[t.Hash] = w != nil
+	}
+
+	// deposits are screened and scored like those of a scanned block, from the whole of their transactions
+	details, errDetails := backfillBtcDeposits(txs, withdrawals)
+	if errDetails != nil {
+		return 0, &utils.ErrorService{Code: 502, Err: errDetails}
+	}
+	flagged := ScreenBtcInputs(details)
+	facts := newBlockFacts(details)
+
+	n := 0
+	delta := 0.0
+	spends := make(map[string]*store.BtcTransactionSchema)
+	for _, t := range txs {
+		if withdrawals[t.Hash] {
+			continue
+		}
+
+		amount := helpers.FromSatoshiToBtc(new(big.Int).Abs(&t.Value))
+		if t.IsInput() {
+			// the inputs of a transaction spent from the address are recorded as a single withdrawal
+			if s, ok := spends[t.Hash]; ok {
+				s.Amount += amount
+				continue
+			}
+			spends[t.Hash] = &store.BtcTransactionSchema{
+				Amount:      amount,
+				TxHash:      t.Hash,
+				VoutIdx:     -1,
+				BlockHeight: t.BlockHeight,
+				Confirmed:   true,
+				Direction:   store.DirectionOut,
+				UID:         acc.UID,
+				Time:        time.Unix(int64(t.BlockTime), 0),
+			}
+			continue
+		}
+
+		// deposits of the last blocks are confirmed by the block scan, which credits them
+		confirmed := t.BlockHeight <= cs.Height-confirmations
+		deposit := &store.BtcTransactionSchema{
+			To:          t.Address,
+			TxHash:      t.Hash,
+			Amount:      amount,
+			BlockHeight: t.BlockHeight,
+			VoutIdx:     t.N,
+			Confirmed:   confirmed,
+			Direction:   store.DirectionIn,
+			UID:         acc.UID,
+			Time:        time.Unix(int64(t.BlockTime), 0),
+		}
+		if in := flagged[t.Hash]; in != nil {
+			deposit.Confirmed = false
+			quarantined, errQ := QuarantineBtcDeposit(deposit, in)
+			if errQ != nil {
+				return n, &utils.ErrorService{Code: 500, Err: errQ}
+			}
+			if quarantined {
+				n++
+			}
+			continue
+		}
+		senders, errScore := scoreBtcDeposit(deposit, facts)
+		if errScore != nil {
+			return n, &utils.ErrorService{Code: 500, Err: errScore}
+		}
+		// held deposits are confirmed by the block scan once their hold ends, reviewed ones by their review
+		if deposit.HoldUntil != 0 || deposit.Review != "" {
+			deposit.Confirmed = false
+		}
+		exists, errTx := helpers.FindOrCreateBtcTransaction(deposit)
+		if errTx != nil {
+			return n, &utils.ErrorService{Code: 500, Err: errTx}
+		}
+		if exists != nil {
+			continue
+		}
+		if err := store.Firestore.SaveSenders(acc.UID, senders); err != nil {
+			utils.ErrorReport.LogAndPrintError(err)
+		}
+		n++
+		if deposit.Confirmed {
+			delta += amount
+		}
+	}
+
+	for _, s := range spends {
+		exists, errTx := helpers.FindOrCreateBtcTransaction(s)
+		if errTx != nil {
+			return n, &utils.ErrorService{Code: 500, Err: errTx}
+		}
+		if exists != nil {
+			continue
+		}
+		n++
+		delta -= s.Amount
+	}
+
+	if delta != 0 {
+		if _, err := store.Firestore.CreditBtcBalance(acc.UID, delta, "backfill"); err != nil {
+			if err == store.ErrAccountNotActive {
+				return n, &utils.ErrorService{Code: 403, Err: err}
+			}
+			return n, &utils.ErrorService{Code: 500, Err: err}
+		}
+	}
+
+	return n, nil
+}
+
+// backfillBtcDeposits get every input and output of the transactions paying the address of a backfilled account,
+// withdrawals excluded. Nothing is fetched when there is neither a blocklist nor risk rules to apply
+func backfillBtcDeposits(txs []*btc.Transaction, withdrawals map[string]bool) ([]*btc.Transaction, error) {
+	if screening.Blocklist.Len() == 0 && len(risk.Rules.Rules) == 0 {
+		return nil, nil
+	}
+
+	var details []*btc.Transaction
+	fetched := make(map[string]bool)
+	for _, t := range txs {
+		if t.IsInput() || withdrawals[t.Hash] || fetched[t.Hash] {
+			continue
+		}
+		fetched[t.Hash] = true
+		detail, err := btc.BtcService.GetTransaction(t.Hash)
+		if err != nil {
+			return nil, err
+		}
+		details = append(details, detail...)
+	}
+	return details, nil
+}
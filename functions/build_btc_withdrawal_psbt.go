@@ -0,0 +1,110 @@
+package functions
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BtcWithdrawalPsbt unsigned withdrawal transaction to be signed offline
+type BtcWithdrawalPsbt struct {
+	UID     string                 `json:"uid"`
+	To      string                 `json:"to"`
+	Amount  int64                  `json:"amount"`
+	Fee     int64                  `json:"fee"`
+	FeeRate int64                  `json:"fee_rate"`
+	Change  int64                  `json:"change"`
+	Inputs  []*store.BtcUtxoSchema `json:"inputs"`
+	Psbt    string                 `json:"psbt"`
+}
+
+// BuildBtcWithdrawalPsbt select the utxos of a user's account to pay amount (in satoshis) to a destination
+// address at the given fee rate (sat/vB) and build the corresponding unsigned psbt
+func BuildBtcWithdrawalPsbt(uid, to string, amount, feeRate int64) (*BtcWithdrawalPsbt, *utils.ErrorService) {
+	if amount < btc.DustLimit {
+		return nil, &utils.ErrorService{Code: 400, Err: errors.New("amount is below the dust limit")}
+	}
+	if feeRate <= 0 {
+		return nil, &utils.ErrorService{Code: 400, Err: errors.New("fee rate must be positive")}
+	}
+
+	params := btc.ChainParams(env.EnvVars.BtcChain)
+	dest, errAddr := btc.DecodeAddress(to, params)
+	if errAddr != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: errAddr}
+	}
+	destScript, errScript := txscript.PayToAddrScript(dest)
+	if errScript != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: errScript}
+	}
+
+	btcAccount, errFind := store.Firestore.FindBtcAccount(uid)
+	if errFind != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errFind}
+	}
+	changeAddr, errChange := btc.DecodeAddress(btcAccount.Address, params)
+	if errChange != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errChange}
+	}
+	changeScript, errScript := txscript.PayToAddrScript(changeAddr)
+	if errScript != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errScript}
+	}
+
+	utxos, errUtxos := store.Firestore.FindBtcUtxos(uid)
+	if errUtxos != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errUtxos}
+	}
+	schemas := make(map[*btc.Utxo]*store.BtcUtxoSchema, len(utxos))
+	var coins []*btc.Utxo
+	for _, u := range utxos {
+		// outputs reserved by a pending withdrawal are checked again when this one is created
+		if u.Quarantined || u.ReservedBy != "" {
+			continue
+		}
+		c := &btc.Utxo{TxHash: u.TxHash, Vout: u.VoutIdx, Value: u.Value, Script: u.Script, ScriptType: u.ScriptType}
+		coins = append(coins, c)
+		schemas[c] = u
+	}
+
+	sel, errSel := btc.SelectCoins(coins, amount, feeRate, btc.ScriptType(hex.EncodeToString(destScript)), btc.ScriptType(hex.EncodeToString(changeScript)))
+	if errSel != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: errSel}
+	}
+
+	w := &BtcWithdrawalPsbt{UID: uid, To: to, Amount: amount, Fee: sel.Fee, FeeRate: feeRate, Change: sel.Change}
+	var inputs []*btc.PsbtInput
+	for _, c := range sel.Inputs {
+		in := &btc.PsbtInput{Utxo: c}
+		// non segwit inputs must carry their whole previous transaction
+		if c.ScriptType == btc.ScriptP2PKH || c.ScriptType == btc.ScriptP2SH {
+			prevTx, errPrev := btc.BtcService.GetRawTransaction(c.TxHash)
+			if errPrev != nil {
+				return nil, &utils.ErrorService{Code: 500, Err: errPrev}
+			}
+			in.PrevTx = prevTx
+		}
+		inputs = append(inputs, in)
+		w.Inputs = append(w.Inputs, schemas[c])
+	}
+
+	outputs := []*wire.TxOut{wire.NewTxOut(amount, destScript)}
+	if sel.Change > 0 {
+		outputs = append(outputs, wire.NewTxOut(sel.Change, changeScript))
+	}
+
+	psbt, errPsbt := btc.NewPsbt(inputs, outputs)
+	if errPsbt != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errPsbt}
+	}
+	w.Psbt = psbt
+
+	return w, nil
+}
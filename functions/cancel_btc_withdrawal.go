@@ -0,0 +1,33 @@
+package functions
+
+import (
+	"errors"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// CancelBtcWithdrawal cancel a withdrawal request that hasn't been signed yet and release its hold.
+// The request must belong to uid, unless uid is empty
+func CancelBtcWithdrawal(id, uid, reason string) (*store.BtcWithdrawalSchema, *utils.ErrorService) {
+	w, errFind := store.Firestore.FindBtcWithdrawal(id)
+	if errFind != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errFind}
+	}
+	if uid != "" && w.UID != uid {
+		return nil, &utils.ErrorService{Code: 403, Err: errors.New("withdrawal belongs to another account")}
+	}
+
+	// a request claimed by a submission is signed and can't be cancelled anymore
+	from := []string{store.WithdrawalRequested, store.WithdrawalRiskChecked, store.WithdrawalApproved}
+	w, err := store.Firestore.TransitionBtcWithdrawal(id, from, func(w *store.BtcWithdrawalSchema) error {
+		w.Status = store.WithdrawalCancelled
+		w.Reason = reason
+		return nil
+	})
+	if err != nil {
+		return nil, transitionError(err, "cancelled")
+	}
+
+	return w, nil
+}
@@ -0,0 +1,66 @@
+package functions
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// ConfirmBtcWithdrawal settle the withdrawal broadcast with a transaction mined at the given height, if any, txs
+// being the inputs and outputs of the mined block. The hold is released, the amount and fee are debited and the
+// withdrawal is recorded in btc_transactions. Withdrawals that failed when their broadcast was dropped are settled
+// all the same
+func ConfirmBtcWithdrawal(txHash string, height int, txs []*btc.Transaction) error {
+	w, err := store.Firestore.FindBtcWithdrawalByTxHash(txHash)
+	if err != nil || w == nil || (w.Status != store.WithdrawalBroadcast && w.Status != store.WithdrawalFailed) {
+		return err
+	}
+
+	// recorded as confirmed so that it is never credited by the deposit confirmation
+	t := &store.BtcTransactionSchema{
+		Amount:      helpers.FromSatoshiToBtc(big.NewInt(w.Amount)),
+		To:          w.To,
+		TxHash:      txHash,
+		VoutIdx:     withdrawalVout(w, txHash, txs),
+		BlockHeight: height,
+		Confirmed:   true,
+		Direction:   store.DirectionOut,
+		UID:         w.UID,
+		Time:        time.Now(),
+	}
+	if err := store.Firestore.CreateBtcTransaction(t); err != nil {
+		return err
+	}
+
+	// settled once, by the scan that moves the request out of broadcast
+	from := []string{store.WithdrawalBroadcast, store.WithdrawalFailed}
+	_, err = store.Firestore.TransitionBtcWithdrawal(w.ID, from, func(w *store.BtcWithdrawalSchema) error {
+		w.Status = store.WithdrawalConfirmed
+		w.BlockHeight = height
+		return nil
+	})
+	if _, ok := err.(*store.WithdrawalStatusError); ok {
+		return nil
+	}
+	return err
+}
+
+// withdrawalVout index of the output of the transaction txHash paying the withdrawal, -1 if none is found
+func withdrawalVout(w *store.BtcWithdrawalSchema, txHash string, txs []*btc.Transaction) int {
+	vout := -1
+	for _, t := range txs {
+		if t.Hash != txHash || t.IsInput() || t.Address != w.To {
+			continue
+		}
+		if t.Value.Int64() == w.Amount {
+			return t.N
+		}
+		if vout < 0 {
+			vout = t.N
+		}
+	}
+	return vout
+}
@@ -0,0 +1,110 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// CreateBtcWithdrawal request the withdrawal of amount satoshis from a user's account to a destination address.
+// The unsigned psbt is built right away so that the amount and the fee can be put on hold and its inputs reserved,
+// then the request is risk checked and waits for its approvals
+func CreateBtcWithdrawal(uid, to string, amount, feeRate int64) (*store.BtcWithdrawalSchema, *utils.ErrorService) {
+	if errStatus := activeBtcAccount(uid); errStatus != nil {
+		return nil, errStatus
+	}
+	psbt, errPsbt := BuildBtcWithdrawalPsbt(uid, to, amount, feeRate)
+	if errPsbt != nil {
+		return nil, errPsbt
+	}
+
+	required := 1
+	if amount >= env.EnvVars.ApprovalThreshold {
+		required = env.EnvVars.Approvers
+	}
+
+	var inputs []string
+	for _, u := range psbt.Inputs {
+		inputs = append(inputs, u.ID())
+	}
+
+	now := time.Now()
+	w := &store.BtcWithdrawalSchema{
+		UID:               uid,
+		To:                to,
+		Amount:            amount,
+		Fee:               psbt.Fee,
+		FeeRate:           psbt.FeeRate,
+		Hold:              helpers.FromSatoshiToBtc(big.NewInt(amount + psbt.Fee)),
+		Psbt:              psbt.Psbt,
+		Inputs:            inputs,
+		Status:            store.WithdrawalRequested,
+		RequiredApprovals: required,
+		Approvals:         []string{},
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	if err := store.Firestore.CreateBtcWithdrawal(w); err != nil {
+		switch err {
+		case store.ErrInsufficientBalance:
+			return nil, &utils.ErrorService{Code: 400, Err: err}
+		case store.ErrUtxoReserved:
+			return nil, &utils.ErrorService{Code: 409, Err: err}
+		}
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	if errRisk := riskCheckBtcWithdrawal(w); errRisk != nil {
+		failed, err := failBtcWithdrawal(w, errRisk.Error())
+		if err != nil {
+			return nil, transitionError(err, "failed")
+		}
+		return failed, nil
+	}
+
+	checked, err := store.Firestore.TransitionBtcWithdrawal(w.ID, []string{store.WithdrawalRequested}, func(w *store.BtcWithdrawalSchema) error {
+		w.Status = store.WithdrawalRiskChecked
+		return nil
+	})
+	if err != nil {
+		return nil, transitionError(err, "risk checked")
+	}
+
+	return checked, nil
+}
+
+// riskCheckBtcWithdrawal check a withdrawal request before it can be approved
+func riskCheckBtcWithdrawal(w *store.BtcWithdrawalSchema) error {
+	btcAccount, err := store.Firestore.FindBtcAccount(w.UID)
+	if err != nil {
+		return err
+	}
+	if btcAccount.Address == w.To {
+		return errors.New("withdrawal to the account's own address")
+	}
+	return screenBtcWithdrawal(w)
+}
+
+// failBtcWithdrawal mark a withdrawal request as failed and release its hold, provided it still has its status
+func failBtcWithdrawal(w *store.BtcWithdrawalSchema, reason string) (*store.BtcWithdrawalSchema, error) {
+	return store.Firestore.TransitionBtcWithdrawal(w.ID, []string{w.Status}, func(w *store.BtcWithdrawalSchema) error {
+		w.Status = store.WithdrawalFailed
+		w.Reason = reason
+		return nil
+	})
+}
+
+// transitionError error of a change of a withdrawal request that couldn't be done
+func transitionError(err error, done string) *utils.ErrorService {
+	if e, ok := err.(*store.WithdrawalStatusError); ok {
+		return &utils.ErrorService{Code: 409, Err: fmt.Errorf("withdrawal is %s and cannot be %s", e.Status, done)}
+	}
+	return &utils.ErrorService{Code: 500, Err: err}
+}
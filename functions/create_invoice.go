@@ -0,0 +1,78 @@
+package functions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// CreateInvoice create an invoice of amount satoshis to a user's uid, paid to an address assigned from the derivation
+// pool and expiring after ttl
+func CreateInvoice(uid string, amount int64, memo string, ttl time.Duration) (*store.InvoiceSchema, *utils.ErrorService) {
+	if env.EnvVars.BtcXpub == "" {
+		return nil, &utils.ErrorService{Code: 400, Err: errors.New("no derivation pool is configured")}
+	}
+	// payments are credited to the account of the user
+	if _, err := store.Firestore.FindBtcAccount(uid); err != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: err}
+	}
+
+	index, errIndex := store.Firestore.NextDerivationIndex(env.EnvVars.BtcChain)
+	if errIndex != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errIndex}
+	}
+	address, errDerive := btc.DeriveAddress(env.EnvVars.BtcXpub, uint32(index), btc.ChainParams(env.EnvVars.BtcChain))
+	if errDerive != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errDerive}
+	}
+
+	now := time.Now()
+	i := &store.InvoiceSchema{
+		UID:       uid,
+		Address:   address,
+		Amount:    amount,
+		Memo:      memo,
+		URI:       btc.PaymentURI(address, amount, memo),
+		Status:    store.InvoiceOpen,
+		Outputs:   map[string]int64{},
+		Mempool:   map[string]int64{},
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		UpdatedAt: now,
+	}
+	if err := store.Firestore.CreateInvoice(i); err != nil {
+		if err == store.ErrAddressTaken {
+			return nil, &utils.ErrorService{Code: 409, Err: err}
+		}
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return i, nil
+}
+
+// GetInvoice get an invoice of a user's uid
+func GetInvoice(uid, id string) (*store.InvoiceSchema, *utils.ErrorService) {
+	i, err := store.Firestore.FindInvoice(id)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if i == nil || i.UID != uid {
+		return nil, &utils.ErrorService{Code: 404, Err: errors.New("unknown invoice " + id)}
+	}
+	return i, nil
+}
+
+// ListInvoices list the invoices of a user's uid
+func ListInvoices(uid string) ([]*store.InvoiceSchema, *utils.ErrorService) {
+	is, err := store.Firestore.FindInvoices(uid)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if is == nil {
+		is = []*store.InvoiceSchema{}
+	}
+	return is, nil
+}
@@ -0,0 +1,114 @@
+package functions
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+	"github.com/SoteriaTech/blockchain-functions/webhook"
+)
+
+// WebhookEvent body of the requests sent to webhooks
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// DepositEvent data of the deposit events
+type DepositEvent struct {
+	ID          string  `json:"id"`
+	UID         string  `json:"uid"`
+	TxHash      string  `json:"tx_hash"`
+	VoutIdx     int     `json:"vout_idx"`
+	Address     string  `json:"address"`
+	AmountBtc   float64 `json:"amount_btc"`
+	AmountSat   int64   `json:"amount_sat"`
+	BlockHeight int     `json:"block_height"`
+	Confirmed   bool    `json:"confirmed"`
+}
+
+// EmitDepositEvent emit an event of the given type about a deposit to the webhooks subscribed to it
+func EmitDepositEvent(eventType string, t *store.BtcTransactionSchema) error {
+	d := &DepositEvent{
+		ID:          btcTransactionID(t),
+		UID:         t.UID,
+		TxHash:      t.TxHash,
+		VoutIdx:     t.VoutIdx,
+		Address:     t.To,
+		AmountBtc:   t.Amount,
+		AmountSat:   helpers.FromBtcToSatoshi(big.NewFloat(t.Amount)).Int64(),
+		BlockHeight: t.BlockHeight,
+		Confirmed:   t.Confirmed,
+	}
+	// a deposit may be detected again after a reorg reversed it
+	eventID := eventType + ":" + d.ID
+	if eventType != store.DepositConfirmed {
+		eventID += ":" + strconv.Itoa(t.BlockHeight)
+	}
+	return EmitWebhookEvent(eventType, eventID, d)
+}
+
+// btcTransactionID document id of a btc transaction
+func btcTransactionID(t *store.BtcTransactionSchema) string {
+	return t.TxHash + strconv.Itoa(t.VoutIdx)
+}
+
+// EmitWebhookEvent queue the delivery of an event to every webhook subscribed to its type, attempted by
+// RetryWebhookDeliveries. The event id is the idempotency key of the event, emitting it again has no effect
+func EmitWebhookEvent(eventType, eventID string, data interface{}) error {
+	ws, err := store.Firestore.FindWebhooks(eventType)
+	if err != nil || len(ws) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(&WebhookEvent{ID: eventID, Type: eventType, CreatedAt: time.Now(), Data: data})
+	if err != nil {
+		return err
+	}
+
+	for _, w := range ws {
+		d := &store.WebhookDeliverySchema{
+			WebhookID:     w.ID,
+			EventID:       eventID,
+			Type:          eventType,
+			Payload:       string(payload),
+			Status:        store.DeliveryPending,
+			NextAttemptAt: time.Now(),
+			CreatedAt:     time.Now(),
+		}
+		if _, err := store.Firestore.CreateWebhookDelivery(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliverWebhook attempt the delivery of an event to a webhook and record the outcome: failed deliveries are
+// attempted again after a backoff, or become dead-letters after too many attempts
+func deliverWebhook(d *store.WebhookDeliverySchema, w *store.WebhookSchema) error {
+	d.Attempts++
+	errSend := webhook.Webhooks.Send(w.URL, w.Secret, d.Type, d.EventID, []byte(d.Payload))
+	switch {
+	case errSend == nil:
+		d.Status = store.DeliveryDelivered
+		d.DeliveredAt = time.Now()
+		d.LastError = ""
+	case d.Attempts >= env.EnvVars.WebhookMaxAttempts:
+		d.Status = store.DeliveryDead
+		d.LastError = errSend.Error()
+		utils.ErrorReport.LogAndPrintError(errSend)
+	default:
+		d.NextAttemptAt = time.Now().Add(webhook.Backoff(env.EnvVars.WebhookBackoff, d.Attempts))
+		d.LastError = errSend.Error()
+	}
+
+	return store.Firestore.UpdateWebhookDelivery(d)
+}
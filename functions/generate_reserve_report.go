@@ -0,0 +1,174 @@
+package functions
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/reserves"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// GenerateReserveReport generate a signed proof of reserves at the last scanned block, given as height or 0.
+// Liabilities are the current btc balances of the accounts, committed to by a merkle sum tree whose inclusion proofs
+// are stored along the report. Assets are the balances of the account addresses and of the reserve addresses at the
+// block. Liabilities aren't known at past blocks, so reports are only generated at the last one
+func GenerateReserveReport(height int) (*store.ReserveReportSchema, *utils.ErrorService) {
+	if reserves.Signer == nil {
+		return nil, &utils.ErrorService{Code: 500, Err: reserves.ErrNoSigner}
+	}
+	cs, errCs := store.Firestore.GetChainState(env.EnvVars.BtcChain)
+	if errCs != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errCs}
+	}
+	if height == 0 {
+		height = cs.Height
+	}
+	if height != cs.Height {
+		return nil, &utils.ErrorService{Code: 400, Err: fmt.Errorf("height must be the last scanned block %d", cs.Height)}
+	}
+	block, errBlock := btc.BtcService.FetchBlock(height)
+	if errBlock != nil {
+		return nil, &utils.ErrorService{Code: 502, Err: errBlock}
+	}
+
+	balances, errBal := store.Firestore.FindBtcBalances()
+	if errBal != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errBal}
+	}
+	liabilities := make(map[string]int64, len(balances))
+	for uid, bal := range balances {
+		liabilities[uid] = satoshis(bal)
+	}
+	tree, errTree := reserves.NewTree(liabilities)
+	if errTree != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errTree}
+	}
+
+	addresses, errAddr := reserveAddresses()
+	if errAddr != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errAddr}
+	}
+	assets := int64(0)
+	for _, a := range addresses {
+		bal, err := addressBalanceAt(a, height)
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 502, Err: err}
+		}
+		assets += bal
+	}
+
+	root := tree.Root()
+	r := &store.ReserveReportSchema{
+		Height:      height,
+		BlockHash:   block.Hash,
+		Root:        hex.EncodeToString(root.Hash),
+		Liabilities: root.Sum,
+		Assets:      assets,
+		Accounts:    len(tree.Leaves),
+		Addresses:   len(addresses),
+		// the statement signs the time to the second
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+	pub, sig, errSign := reserves.Sign(r.Statement())
+	if errSign != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errSign}
+	}
+	r.PublicKey = pub
+	r.Signature = sig
+
+	proofs := make([]*store.ReserveProofSchema, len(tree.Leaves))
+	for i, l := range tree.Leaves {
+		proofs[i] = &store.ReserveProofSchema{
+			UID:     l.UID,
+			Nonce:   l.Nonce,
+			Balance: l.Balance,
+			Leaf:    hex.EncodeToString(l.Hash()),
+			Path:    tree.Proof(i),
+		}
+	}
+	if err := store.Firestore.CreateReserveReport(r, proofs); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return r, nil
+}
+
+// reserveAddresses addresses holding the reserves: those of the accounts and the configured reserve addresses
+func reserveAddresses() ([]string, error) {
+	accs, err := store.Firestore.GetAllAccountAddresses()
+	if err != nil {
+		return nil, err
+	}
+	invoices, err := store.Firestore.GetAllInvoiceAddresses()
+	if err != nil {
+		return nil, err
+	}
+	accs = append(accs, invoices...)
+
+	seen := make(map[string]bool)
+	var addresses []string
+	for _, a := range accs {
+		if a.Address != "" && !seen[a.Address] {
+			seen[a.Address] = true
+			addresses = append(addresses, a.Address)
+		}
+	}
+	for _, a := range env.EnvVars.ReserveAddresses {
+		if !seen[a] {
+			seen[a] = true
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses, nil
+}
+
+// addressBalanceAt balance in satoshis of an address once the block of the given height was mined
+func addressBalanceAt(address string, height int) (int64, error) {
+	history, err := btc.BtcService.GetAddressHistory(address)
+	if err != nil {
+		return 0, err
+	}
+	bal := new(big.Int)
+	for _, t := range history {
+		// inputs spent from the address have a negative value
+		if t.BlockHeight <= height {
+			bal.Add(bal, &t.Value)
+		}
+	}
+	return bal.Int64(), nil
+}
+
+// GetReserveReport get a proof of reserves, the latest one if id is empty
+func GetReserveReport(id string) (*store.ReserveReportSchema, *utils.ErrorService) {
+	r, err := store.Firestore.FindReserveReport(id)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if r == nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errors.New("no proof of reserves")}
+	}
+	return r, nil
+}
+
+// GetReserveProof get the inclusion proof of the balance of a user's uid in a proof of reserves, the latest one if
+// report is empty
+func GetReserveProof(uid, report string) (*store.ReserveProofSchema, *utils.ErrorService) {
+	r, errReport := GetReserveReport(report)
+	if errReport != nil {
+		return nil, errReport
+	}
+	p, err := store.Firestore.FindReserveProof(r.ID, uid)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if p == nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errors.New("account not included in proof of reserves " + r.ID)}
+	}
+	p.Report = r
+	return p, nil
+}
@@ -0,0 +1,70 @@
+package functions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// Granularities of the balance history
+const (
+	Hourly = "hourly"
+	Daily  = "daily"
+)
+
+// maxBalancePoints maximum number of points of a balance history
+const maxBalancePoints = 1000
+
+// BalancePoint balance of an account at the end of a period
+type BalancePoint struct {
+	Time   time.Time          `json:"time"`
+	Height int                `json:"height"`
+	BTC    float64            `json:"BTC"`
+	Values map[string]float64 `json:"values"`
+}
+
+// BalanceHistory balance time series of an account
+type BalanceHistory struct {
+	UID         string          `json:"uid"`
+	Granularity string          `json:"granularity"`
+	Points      []*BalancePoint `json:"points"`
+}
+
+// GetBalanceHistory get the balance of a user's account at the end of every hour or day between from and to
+// (excluded). Periods without snapshot carry the balance of the previous one, taken before from if need be, periods
+// before the first snapshot of the account are left out
+func GetBalanceHistory(uid, granularity string, from, to time.Time) (*BalanceHistory, *utils.ErrorService) {
+	step := time.Hour
+	if granularity == Daily {
+		step = 24 * time.Hour
+	}
+	from, to = from.UTC().Truncate(step), to.UTC().Truncate(step).Add(step)
+	if n := int(to.Sub(from) / step); n > maxBalancePoints {
+		return nil, &utils.ErrorService{Code: 400, Err: fmt.Errorf("the history is limited to %d points, got %d", maxBalancePoints, n)}
+	}
+
+	snaps, err := store.Firestore.FindBalanceSnapshots(uid, from, to)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	h := &BalanceHistory{UID: uid, Granularity: granularity, Points: []*BalancePoint{}}
+	var last *store.BalanceSnapshotSchema
+	for start := from; start.Before(to); start = start.Add(step) {
+		end := start.Add(step)
+		for len(snaps) > 0 && snaps[0].Time.Before(end) {
+			last, snaps = snaps[0], snaps[1:]
+		}
+		if last == nil {
+			continue
+		}
+		if last.Values == nil {
+			last.Values = map[string]float64{}
+		}
+		h.Points = append(h.Points, &BalancePoint{Time: start, Height: last.Height, BTC: last.BTC, Values: last.Values})
+	}
+
+	return h, nil
+}
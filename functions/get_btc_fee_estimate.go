@@ -0,0 +1,70 @@
+package functions
+
+import (
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// feeQuantiles number of quantiles kept from the fee rates of each scanned block
+const feeQuantiles = 20
+
+// SaveBtcFeeStats save the fee rates paid in a scanned block
+func SaveBtcFeeStats(block *btc.Block) error {
+	rates := btc.BlockFeeRates(block)
+	if len(rates) == 0 {
+		return nil
+	}
+
+	return store.Firestore.SaveBtcFeeStats(&store.BtcFeeStatsSchema{
+		Height:    block.Height,
+		TxCount:   len(rates),
+		Quantiles: btc.Quantiles(rates, feeQuantiles),
+	})
+}
+
+// GetBtcFeeEstimate get the fast, normal and slow fee rates (sat/vB) estimated from the latest scanned blocks.
+// Estimates are cached in the store until a new block is scanned
+func GetBtcFeeEstimate() (*store.BtcFeeEstimateSchema, *utils.ErrorService) {
+	stats, errStats := store.Firestore.FindLatestBtcFeeStats(env.EnvVars.FeeBlocks)
+	if errStats != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errStats}
+	}
+	var height int
+	if len(stats) > 0 {
+		height = stats[0].Height
+	}
+
+	cached, errCache := store.Firestore.FindBtcFeeEstimate(env.EnvVars.BtcChain)
+	if errCache != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errCache}
+	}
+	if cached != nil && cached.Height == height {
+		return cached, nil
+	}
+
+	var quantiles [][]float64
+	for _, s := range stats {
+		quantiles = append(quantiles, s.Quantiles)
+	}
+	rates, errEstimate := btc.Fees.Estimate(quantiles)
+	if errEstimate != nil {
+		return nil, &utils.ErrorService{Code: 502, Err: errEstimate}
+	}
+
+	e := &store.BtcFeeEstimateSchema{
+		Fast:        rates.Fast,
+		Normal:      rates.Normal,
+		Slow:        rates.Slow,
+		Height:      height,
+		LastUpdated: time.Now(),
+	}
+	if errSave := store.Firestore.SaveBtcFeeEstimate(env.EnvVars.BtcChain, e); errSave != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errSave}
+	}
+
+	return e, nil
+}
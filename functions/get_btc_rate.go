@@ -0,0 +1,60 @@
+package functions
+
+import (
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/price"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// rateMaxGap maximum time between a recorded rate and the time it values, past rates are fetched beyond. The
+// history source gives daily rates
+const rateMaxGap = 24 * time.Hour
+
+// recentBlockAge age under which a block is valued at the current rates
+const recentBlockAge = time.Hour
+
+// GetBtcRate get the btc rate in a currency at a given time, or the current rate if t is zero. Past rates are taken
+// from the recorded rates, or fetched from the history source and recorded
+func GetBtcRate(currency string, t time.Time) (*price.Rate, *utils.ErrorService) {
+	if t.IsZero() {
+		r, err := price.GetRate(BTC, currency)
+		if err != nil {
+			return nil, &utils.ErrorService{Code: 502, Err: err}
+		}
+		return r, nil
+	}
+
+	r, err := store.Firestore.FindRateAt(BTC, currency, t)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if r != nil && t.Sub(r.Time) <= rateMaxGap {
+		return r, nil
+	}
+
+	r, err = price.GetHistoricalRate(BTC, currency, t)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 502, Err: err}
+	}
+	if err := store.Firestore.SaveRate(r); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return r, nil
+}
+
+// SaveBtcRates record the current btc rates of the configured currencies
+func SaveBtcRates() error {
+	for _, c := range env.EnvVars.PriceCurrencies {
+		r, err := price.GetRate(BTC, c)
+		if err != nil {
+			return err
+		}
+		if err := store.Firestore.SaveRate(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package functions
+
+import (
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// BtcUtxo unspent output of an account with its current confirmation depth
+type BtcUtxo struct {
+	*store.BtcUtxoSchema
+	Confirmations int `json:"confirmations"`
+}
+
+// BtcUtxoSet utxo set of an account, its computed balance and the drift with the provider balance of its address and
+// the ones of its invoices
+type BtcUtxoSet struct {
+	UID             string     `json:"uid"`
+	Address         string     `json:"address"`
+	Height          int        `json:"height"`
+	Utxos           []*BtcUtxo `json:"utxos"`
+	Balance         int64      `json:"balance"`
+	ProviderBalance int64      `json:"provider_balance"`
+	Drift           int64      `json:"drift"`
+}
+
+// GetBtcUtxos get the utxo set of a user's account from its uid
+func GetBtcUtxos(uid string) (*BtcUtxoSet, *utils.ErrorService) {
+	btcAccount, errFind := store.Firestore.FindBtcAccount(uid)
+	if errFind != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errFind}
+	}
+
+	cs, errState := store.Firestore.GetChainState(env.EnvVars.BtcChain)
+	if errState != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errState}
+	}
+
+	utxos, errUtxos := store.Firestore.FindBtcUtxos(uid)
+	if errUtxos != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errUtxos}
+	}
+
+	set := &BtcUtxoSet{UID: uid, Address: btcAccount.Address, Height: cs.Height, Utxos: []*BtcUtxo{}}
+	for _, u := range utxos {
+		set.Utxos = append(set.Utxos, &BtcUtxo{BtcUtxoSchema: u, Confirmations: cs.Height - u.BlockHeight + 1})
+		set.Balance += u.Value
+	}
+
+	// the utxo set includes the outputs paying the invoices of the account
+	addresses, errAddresses := accountAddresses(btcAccount)
+	if errAddresses != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errAddresses}
+	}
+	for _, a := range addresses {
+		providerBalance, errBalance := btc.BtcService.GetAccountBalance(a)
+		if errBalance != nil {
+			return nil, &utils.ErrorService{Code: 502, Err: errBalance}
+		}
+		set.ProviderBalance += providerBalance.Int64()
+	}
+	set.Drift = set.Balance - set.ProviderBalance
+
+	return set, nil
+}
@@ -0,0 +1,31 @@
+package functions
+
+import (
+	"errors"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// IndexBtcAccount validate the address of the btc account of a user's uid and index it in place of its previous
+// address, if any
+func IndexBtcAccount(uid, address, oldAddress string) *utils.ErrorService {
+	if _, err := btc.DecodeAddress(address, btc.ChainParams(env.EnvVars.BtcChain)); err != nil {
+		return &utils.ErrorService{Code: 400, Err: err}
+	}
+
+	owner, err := store.Firestore.FindIndexedBtcAddress(address)
+	if err != nil {
+		return &utils.ErrorService{Code: 500, Err: err}
+	}
+	if owner != "" && owner != uid {
+		return &utils.ErrorService{Code: 409, Err: errors.New("address " + address + " is already registered by " + owner)}
+	}
+
+	if err := store.Firestore.IndexBtcAddress(uid, address, oldAddress); err != nil {
+		return &utils.ErrorService{Code: 500, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package functions
+
+import (
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/risk"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// Status filters of the transaction history
+const (
+	StatusConfirmed = "confirmed"
+	StatusPending   = "pending"
+)
+
+// BtcTransactionFilter filters of the transaction history, zero values don't filter
+type BtcTransactionFilter struct {
+	Status    string
+	Direction string
+	From      time.Time
+	To        time.Time
+}
+
+// BtcTransaction transaction of the history of an account
+type BtcTransaction struct {
+	ID            string    `json:"id"`
+	TxHash        string    `json:"tx_hash"`
+	VoutIdx       int       `json:"vout_idx"`
+	Direction     string    `json:"direction"`
+	Address       string    `json:"address"`
+	BlockHeight   int       `json:"block_height"`
+	Time          time.Time `json:"time"`
+	Confirmed     bool      `json:"confirmed"`
+	Confirmations int       `json:"confirmations"`
+	AmountSat     int64     `json:"amount_sat"`
+	AmountBtc     float64   `json:"amount_btc"`
+	UID           string    `json:"uid,omitempty"`
+	// Risk outcome of the deposit rules, with the height its hold ends at and its review
+	Risk         *risk.Outcome `json:"risk,omitempty"`
+	HoldUntil    int           `json:"hold_until,omitempty"`
+	Review       string        `json:"review,omitempty"`
+	ReviewedBy   string        `json:"reviewed_by,omitempty"`
+	ReviewReason string        `json:"review_reason,omitempty"`
+	Quarantined  bool          `json:"quarantined,omitempty"`
+}
+
+// BtcTransactionPage page of the transaction history, NextCursor is empty on the last page
+type BtcTransactionPage struct {
+	Transactions []*BtcTransaction `json:"transactions"`
+	NextCursor   string            `json:"next_cursor"`
+}
+
+// ListBtcTransactions list the transactions of a user's account, latest first, matching the filter.
+// The page starts after the given cursor if any
+func ListBtcTransactions(uid string, filter *BtcTransactionFilter, cursor string, limit int) (*BtcTransactionPage, *utils.ErrorService) {
+	after, errCursor := decodeBtcTransactionCursor(cursor)
+	if errCursor != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: errCursor}
+	}
+
+	btcAccount, errFind := store.Firestore.FindBtcAccount(uid)
+	if errFind != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errFind}
+	}
+
+	// deposits are made to the account address and to the addresses of its invoices
+	addresses, errAddrs := accountAddresses(btcAccount)
+	if errAddrs != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errAddrs}
+	}
+
+	cs, errState := store.Firestore.GetChainState(env.EnvVars.BtcChain)
+	if errState != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errState}
+	}
+
+	page := &BtcTransactionPage{Transactions: []*BtcTransaction{}}
+	for {
+		var batch []*store.BtcTransactionSchema
+		exhausted := true
+		if filter.Direction != store.DirectionOut {
+			// firestore "in" filters take at most 10 values
+			for i := 0; i < len(addresses); i += 10 {
+				end := i + 10
+				if end > len(addresses) {
+					end = len(addresses)
+				}
+				deposits, err := store.Firestore.FindBtcTransactionsByAddresses(addresses[i:end], after, limit)
+				if err != nil {
+					return nil, &utils.ErrorService{Code: 500, Err: err}
+				}
+				batch = append(batch, deposits...)
+				exhausted = exhausted && len(deposits) < limit
+			}
+		}
+		if filter.Direction != store.DirectionIn {
+			withdrawals, err := store.Firestore.FindOutgoingBtcTransactions(uid, after, limit)
+			if err != nil {
+				return nil, &utils.ErrorService{Code: 500, Err: err}
+			}
+			batch = append(batch, withdrawals...)
+			exhausted = exhausted && len(withdrawals) < limit
+		}
+
+		// the union of the queries is only ordered up to limit transactions
+		sort.Slice(batch, func(i, j int) bool {
+			if batch[i].BlockHeight != batch[j].BlockHeight {
+				return batch[i].BlockHeight > batch[j].BlockHeight
+			}
+			return batch[i].ID > batch[j].ID
+		})
+		if len(batch) > limit {
+			batch = batch[:limit]
+			exhausted = false
+		}
+
+		for _, t := range batch {
+			after = &store.BtcTransactionCursor{BlockHeight: t.BlockHeight, ID: t.ID}
+			if !filter.matches(t) {
+				continue
+			}
+			page.Transactions = append(page.Transactions, newBtcTransaction(t, cs.Height))
+			if len(page.Transactions) == limit {
+				page.NextCursor = encodeBtcTransactionCursor(after)
+				return page, nil
+			}
+		}
+
+		if exhausted || len(batch) == 0 {
+			return page, nil
+		}
+	}
+}
+
+func (f *BtcTransactionFilter) matches(t *store.BtcTransactionSchema) bool {
+	switch {
+	case f.Status == StatusConfirmed && !t.Confirmed,
+		f.Status == StatusPending && t.Confirmed,
+		f.Direction != "" && direction(t) != f.Direction,
+		!f.From.IsZero() && t.Time.Before(f.From),
+		!f.To.IsZero() && !t.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// direction direction of a transaction, transactions recorded before withdrawals existed are deposits
+func direction(t *store.BtcTransactionSchema) string {
+	if t.Direction == "" {
+		return store.DirectionIn
+	}
+	return t.Direction
+}
+
+func newBtcTransaction(t *store.BtcTransactionSchema, height int) *BtcTransaction {
+	return &BtcTransaction{
+		ID:            t.ID,
+		TxHash:        t.TxHash,
+		VoutIdx:       t.VoutIdx,
+		Direction:     direction(t),
+		Address:       t.To,
+		BlockHeight:   t.BlockHeight,
+		Time:          t.Time,
+		Confirmed:     t.Confirmed,
+		Confirmations: height - t.BlockHeight + 1,
+		AmountSat:     helpers.FromBtcToSatoshi(big.NewFloat(t.Amount)).Int64(),
+		AmountBtc:     t.Amount,
+		UID:           t.UID,
+		Risk:          t.Risk,
+		HoldUntil:     t.HoldUntil,
+		Review:        t.Review,
+		ReviewedBy:    t.ReviewedBy,
+		ReviewReason:  t.ReviewReason,
+		Quarantined:   t.Quarantined,
+	}
+}
+
+func encodeBtcTransactionCursor(c *store.BtcTransactionCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(c.BlockHeight) + ":" + c.ID))
+}
+
+func decodeBtcTransactionCursor(cursor string) (*store.BtcTransactionCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("invalid cursor")
+	}
+	height, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &store.BtcTransactionCursor{BlockHeight: height, ID: parts[1]}, nil
+}
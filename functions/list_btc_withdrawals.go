@@ -0,0 +1,18 @@
+package functions
+
+import (
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// ListBtcWithdrawals list the withdrawal requests of a user's account, or of every account if uid is empty
+func ListBtcWithdrawals(uid string) ([]*store.BtcWithdrawalSchema, *utils.ErrorService) {
+	ws, err := store.Firestore.FindBtcWithdrawals(uid)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if ws == nil {
+		ws = []*store.BtcWithdrawalSchema{}
+	}
+	return ws, nil
+}
@@ -0,0 +1,66 @@
+package functions
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// ConvertRequestPage page of the conversion history, NextCursor is empty on the last page
+type ConvertRequestPage struct {
+	Requests   []*store.ConvertRequestSchema `json:"requests"`
+	NextCursor string                        `json:"next_cursor"`
+}
+
+// ListConvertRequests list the conversion requests of a user's account, latest first. The page starts after the
+// given cursor if any
+func ListConvertRequests(uid, cursor string, limit int) (*ConvertRequestPage, *utils.ErrorService) {
+	after, errCursor := decodeConvertRequestCursor(cursor)
+	if errCursor != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: errCursor}
+	}
+
+	// one more request is fetched to know whether there is a next page
+	rs, err := store.Firestore.FindConvertRequests(uid, after, limit+1)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	page := &ConvertRequestPage{Requests: []*store.ConvertRequestSchema{}}
+	if len(rs) > limit {
+		rs = rs[:limit]
+		last := rs[limit-1]
+		page.NextCursor = encodeConvertRequestCursor(&store.ConvertRequestCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	page.Requests = append(page.Requests, rs...)
+
+	return page, nil
+}
+
+func encodeConvertRequestCursor(c *store.ConvertRequestCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID))
+}
+
+func decodeConvertRequestCursor(cursor string) (*store.ConvertRequestCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &store.ConvertRequestCursor{CreatedAt: time.Unix(0, nanos), ID: parts[1]}, nil
+}
@@ -0,0 +1,39 @@
+package functions
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// accountEvents types of the outbox events streamed to the account they concern
+var accountEvents = map[string]bool{
+	store.EventDepositDetected:  true,
+	store.EventDepositConfirmed: true,
+	store.EventBalanceChanged:   true,
+}
+
+// FindAccountEvent find an event of a user's uid, from which its stream is resumed
+func FindAccountEvent(uid, id string) (*store.OutboxEventSchema, *utils.ErrorService) {
+	e, err := store.Firestore.FindOutboxEvent(id)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if e == nil || e.Key != uid || !accountEvents[e.Type] {
+		return nil, &utils.ErrorService{Code: 404, Err: errors.New("unknown event " + id)}
+	}
+	return e, nil
+}
+
+// ListenAccountEvents call fn with the balance and transaction events of a user's uid as the scanner produces them,
+// starting after the event after, or from now if it is nil. It returns once ctx is done or fn fails
+func ListenAccountEvents(ctx context.Context, uid string, after *store.OutboxEventSchema, fn func(*store.OutboxEventSchema) error) error {
+	return store.Firestore.ListenAccountEvents(ctx, uid, after, func(e *store.OutboxEventSchema) error {
+		if !accountEvents[e.Type] {
+			return nil
+		}
+		return fn(e)
+	})
+}
@@ -0,0 +1,104 @@
+package functions
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// RecordInvoicePayments record the outputs of a scanned block paid to invoice addresses, and update the status of
+// their invoices
+func RecordInvoicePayments(txs []*btc.Transaction, invoices []*store.BtcAccountSchema) error {
+	addresses := make(map[string]bool, len(invoices))
+	for _, a := range invoices {
+		addresses[a.Address] = true
+	}
+
+	for _, t := range txs {
+		if t.IsInput() || !addresses[t.Address] {
+			continue
+		}
+		i, err := store.Firestore.FindInvoiceByAddress(t.Address)
+		if err != nil {
+			return err
+		}
+		if i == nil {
+			continue
+		}
+
+		id := t.Hash + strconv.Itoa(t.N)
+		value := t.Value.Int64()
+		if _, err := store.Firestore.UpdateInvoice(i.ID, func(i *store.InvoiceSchema) error {
+			if i.Outputs == nil {
+				i.Outputs = make(map[string]int64)
+			}
+			i.Outputs[id] = value
+			delete(i.Mempool, id)
+			i.Settle(time.Now())
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReverseInvoicePayment remove a deposit dropped by a reorg from the outputs of the invoice it paid, if any
+func ReverseInvoicePayment(t *store.BtcTransactionSchema) error {
+	i, err := store.Firestore.FindInvoiceByAddress(t.To)
+	if err != nil || i == nil {
+		return err
+	}
+	if _, ok := i.Outputs[t.ID]; !ok {
+		return nil
+	}
+	_, err = store.Firestore.UpdateInvoice(i.ID, func(i *store.InvoiceSchema) error {
+		delete(i.Outputs, t.ID)
+		i.Settle(time.Now())
+		return nil
+	})
+	return err
+}
+
+// MatchMempoolInvoices match the outputs waiting in the mempool with the active invoices, and expire the invoices
+// that received nothing in time. Returns the number of invoices whose status changed
+func MatchMempoolInvoices() (int, error) {
+	invoices, err := store.Firestore.FindActiveInvoices()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, i := range invoices {
+		txs, err := btc.BtcService.GetAddressMempool(i.Address)
+		if err != nil {
+			// the next scan matches it again
+			utils.ErrorReport.LogAndPrintError(err)
+			continue
+		}
+		mempool := make(map[string]int64)
+		for _, t := range txs {
+			if !t.IsInput() && t.Address == i.Address {
+				mempool[t.Hash+strconv.Itoa(t.N)] = t.Value.Int64()
+			}
+		}
+
+		status := i.Status
+		updated, err := store.Firestore.UpdateInvoice(i.ID, func(i *store.InvoiceSchema) error {
+			// outputs that left the mempool were either mined or replaced
+			i.Mempool = mempool
+			i.Settle(time.Now())
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		if updated.Status != status {
+			n++
+		}
+	}
+	return n, nil
+}
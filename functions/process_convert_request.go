@@ -0,0 +1,113 @@
+package functions
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/price"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// BTC currency code of bitcoin balances
+const BTC = "BTC"
+
+// ProcessConvertRequest process the pending conversion request id of a user's uid: it is executed at the market rate
+// if it is within the slippage bounds of the quoted rate, the account is active and the balance is sufficient, and
+// rejected otherwise
+func ProcessConvertRequest(uid, id string) (*store.ConvertRequestSchema, *utils.ErrorService) {
+	r, err := store.Firestore.FindConvertRequest(uid, id)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: err}
+	}
+	if r.Status != store.ConvertPending {
+		return nil, &utils.ErrorService{Code: 409, Err: store.ErrConvertProcessed}
+	}
+
+	rate, reason := convertRate(r)
+	if reason != "" {
+		r, err = store.Firestore.RejectConvertRequest(uid, id, reason)
+	} else {
+		r, err = store.Firestore.ConvertBalance(uid, id, rate, roundAmount(r.To, r.Amount*rate))
+	}
+	if err == store.ErrConvertProcessed {
+		return nil, &utils.ErrorService{Code: 409, Err: err}
+	}
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	return r, nil
+}
+
+// ProcessConvertRequests process the pending conversion requests of every account, including those missed by
+// ConvertRequestCreated
+func ProcessConvertRequests() ([]*store.ConvertRequestSchema, *utils.ErrorService) {
+	pending, err := store.Firestore.FindPendingConvertRequests()
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	processed := []*store.ConvertRequestSchema{}
+	for _, p := range pending {
+		r, errProcess := ProcessConvertRequest(p.UID, p.ID)
+		if errProcess != nil {
+			// requests processed concurrently are skipped
+			if errProcess.Code == 409 {
+				continue
+			}
+			return processed, errProcess
+		}
+		processed = append(processed, r)
+	}
+
+	return processed, nil
+}
+
+// convertRate get the market rate of a conversion request, or the reason to reject it
+func convertRate(r *store.ConvertRequestSchema) (float64, string) {
+	if r.Amount <= 0 {
+		return 0, "amount must be positive"
+	}
+	if r.Rate <= 0 {
+		return 0, "quoted rate must be positive"
+	}
+
+	var rate float64
+	switch {
+	case r.From == BTC && r.To != BTC:
+		rt, err := price.GetRate(BTC, r.To)
+		if err != nil {
+			return 0, err.Error()
+		}
+		rate = rt.Value
+	case r.To == BTC && r.From != BTC:
+		rt, err := price.GetRate(BTC, r.From)
+		if err != nil {
+			return 0, err.Error()
+		}
+		rate = 1 / rt.Value
+	default:
+		return 0, fmt.Sprintf("unsupported conversion from %s to %s", r.From, r.To)
+	}
+
+	slippage := r.Slippage
+	if slippage <= 0 || slippage > env.EnvVars.ConvertMaxSlippage {
+		slippage = env.EnvVars.ConvertMaxSlippage
+	}
+	if math.Abs(rate-r.Rate)/r.Rate > slippage {
+		return 0, fmt.Sprintf("market rate %g is beyond %g%% of the quoted rate %g", rate, slippage*100, r.Rate)
+	}
+
+	return rate, ""
+}
+
+// roundAmount round an amount to the smallest unit of its currency
+func roundAmount(currency string, amount float64) float64 {
+	unit := 1e2
+	if currency == BTC {
+		unit = 1e8
+	}
+	return math.Floor(amount*unit) / unit
+}
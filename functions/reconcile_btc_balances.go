@@ -0,0 +1,256 @@
+package functions
+
+import (
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// reconcilePage number of transactions read at once to sum the ledger of an account
+const reconcilePage = 500
+
+// ReconcileBtcBalances compare for every account its stored btc balance, the sum of its confirmed transactions and
+// its balance on chain, and report the accounts that disagree. Stored balances off by at most the tolerance are
+// corrected with a ledger adjustment, the others are left open for review. Balances of accounts with withdrawals
+// signed or broadcast but not settled yet are never corrected, the chain may or may not reflect them
+func ReconcileBtcBalances() (*store.ReconciliationSchema, *utils.ErrorService) {
+	accs, errAccs := store.Firestore.GetAllAccountAddresses()
+	if errAccs != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: errAccs}
+	}
+
+	run := &store.ReconciliationSchema{
+		Accounts:      len(accs),
+		Discrepancies: []*store.BalanceDiscrepancySchema{},
+		CreatedAt:     time.Now(),
+	}
+	if err := store.Firestore.CreateReconciliation(run); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	for _, acc := range accs {
+		d, err := reconcileBtcAccount(run.ID, acc)
+		if err != nil {
+			run.Failed++
+			utils.ErrorReport.LogAndPrintError(err)
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		if d.Status == store.DiscrepancyCorrected {
+			run.Corrected++
+		} else {
+			run.Open++
+		}
+		run.Discrepancies = append(run.Discrepancies, d)
+	}
+
+	if err := store.Firestore.UpdateReconciliation(run); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return run, nil
+}
+
+// reconcileBtcAccount reconcile the balances of an account, nil if they agree
+func reconcileBtcAccount(run string, acc *store.BtcAccountSchema) (*store.BalanceDiscrepancySchema, error) {
+	stored, err := store.Firestore.FindBtcBalance(acc.UID)
+	if err != nil {
+		return nil, err
+	}
+	ledger, pending, inFlight, err := btcLedger(acc)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := convertedBtc(acc.UID)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := accountAddresses(acc)
+	if err != nil {
+		return nil, err
+	}
+	balance := new(big.Int)
+	for _, a := range addresses {
+		b, errBalance := btc.BtcService.GetAccountBalance(a)
+		if errBalance != nil {
+			return nil, errBalance
+		}
+		balance.Add(balance, b)
+	}
+
+	// amounts are compared in satoshis, float sums of btc are not exact
+	chain := satoshis(helpers.FromSatoshiToBtc(balance)) - satoshis(pending)
+	diff := chain + satoshis(converted) - satoshis(stored)
+	if diff == 0 && satoshis(ledger) == chain {
+		return nil, nil
+	}
+
+	d := &store.BalanceDiscrepancySchema{
+		Run:       run,
+		UID:       acc.UID,
+		Address:   acc.Address,
+		Stored:    stored,
+		Ledger:    ledger,
+		Chain:     toBtc(chain),
+		Pending:   pending,
+		Converted: converted,
+		InFlight:  inFlight,
+		Status:    store.DiscrepancyOpen,
+		CreatedAt: time.Now(),
+	}
+	if err := store.Firestore.SaveBalanceDiscrepancy(d); err != nil {
+		return nil, err
+	}
+
+	tolerance := satoshis(env.EnvVars.ReconcileTolerance)
+	if diff == 0 || tolerance == 0 || diff > tolerance || -diff > tolerance || inFlight > 0 {
+		return d, nil
+	}
+	a := &store.LedgerAdjustmentSchema{
+		UID:         acc.UID,
+		Amount:      toBtc(diff),
+		Before:      stored,
+		After:       toBtc(satoshis(stored) + diff),
+		Reason:      "reconciliation",
+		Discrepancy: d.ID,
+		CreatedAt:   time.Now(),
+	}
+	// a balance updated meanwhile is reconciled by the next run
+	if err := store.Firestore.AdjustBtcBalance(a); err != nil {
+		if err == store.ErrBalanceChanged {
+			return d, nil
+		}
+		return nil, err
+	}
+
+	d.Status = store.DiscrepancyCorrected
+	d.Adjustment = a.ID
+	if err := store.Firestore.SaveBalanceDiscrepancy(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// btcLedger sum the confirmed transactions of an account, withdrawals including their fee, its deposits not
+// confirmed yet and the holds of its withdrawals signed or broadcast but not settled
+func btcLedger(acc *store.BtcAccountSchema) (ledger, pending, inFlight float64, err error) {
+	addresses, err := accountAddresses(acc)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	ws, err := store.Firestore.FindBtcWithdrawals(acc.UID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	fees := make(map[string]int64)
+	for _, w := range ws {
+		switch w.Status {
+		case store.WithdrawalConfirmed:
+			fees[w.TxHash] = w.Fee
+		case store.WithdrawalSigned, store.WithdrawalBroadcast:
+			inFlight += w.Hold
+		}
+	}
+
+	// firestore "in" filters take at most 10 values
+	for i := 0; i < len(addresses); i += 10 {
+		end := i + 10
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+		chunk := addresses[i:end]
+		deposits, errDeposits := allBtcTransactions(func(after *store.BtcTransactionCursor) ([]*store.BtcTransactionSchema, error) {
+			return store.Firestore.FindBtcTransactionsByAddresses(chunk, after, reconcilePage)
+		})
+		if errDeposits != nil {
+			return 0, 0, 0, errDeposits
+		}
+		for _, t := range deposits {
+			switch {
+			case t.Direction == store.DirectionOut:
+			case t.Confirmed:
+				ledger += t.Amount
+			default:
+				pending += t.Amount
+			}
+		}
+	}
+
+	outs, err := allBtcTransactions(func(after *store.BtcTransactionCursor) ([]*store.BtcTransactionSchema, error) {
+		return store.Firestore.FindOutgoingBtcTransactions(acc.UID, after, reconcilePage)
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, t := range outs {
+		ledger -= t.Amount + helpers.FromSatoshiToBtc(big.NewInt(fees[t.TxHash]))
+	}
+
+	return ledger, pending, inFlight, nil
+}
+
+// accountAddresses addresses receiving the deposits of an account, its own and the ones of its invoices
+func accountAddresses(acc *store.BtcAccountSchema) ([]string, error) {
+	invoices, err := store.Firestore.FindInvoices(acc.UID)
+	if err != nil {
+		return nil, err
+	}
+	addresses := []string{acc.Address}
+	for _, i := range invoices {
+		addresses = append(addresses, i.Address)
+	}
+	return addresses, nil
+}
+
+// allBtcTransactions read every page of a transaction history
+func allBtcTransactions(find func(after *store.BtcTransactionCursor) ([]*store.BtcTransactionSchema, error)) ([]*store.BtcTransactionSchema, error) {
+	var all []*store.BtcTransactionSchema
+	var after *store.BtcTransactionCursor
+	for {
+		txs, err := find(after)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, txs...)
+		if len(txs) < reconcilePage {
+			return all, nil
+		}
+		last := txs[len(txs)-1]
+		after = &store.BtcTransactionCursor{BlockHeight: last.BlockHeight, ID: last.ID}
+	}
+}
+
+// convertedBtc net amount of btc converted to by a user's uid, negative if it converted more from btc
+func convertedBtc(uid string) (float64, error) {
+	rs, err := store.Firestore.FindCompletedConvertRequests(uid)
+	if err != nil {
+		return 0, err
+	}
+	converted := 0.0
+	for _, r := range rs {
+		if r.From == BTC {
+			converted -= r.Amount
+		}
+		if r.To == BTC {
+			converted += r.Received
+		}
+	}
+	return converted, nil
+}
+
+// satoshis round an amount of btc to satoshis
+func satoshis(amount float64) int64 {
+	return int64(math.Round(amount * 1e8))
+}
+
+// toBtc convert satoshis to btc
+func toBtc(sat int64) float64 {
+	return helpers.FromSatoshiToBtc(big.NewInt(sat))
+}
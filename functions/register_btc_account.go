@@ -0,0 +1,54 @@
+package functions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// RegisterBtcAccount register the btc account of a user's uid with the given address, or with an address assigned
+// from the derivation pool if none is given, and request the backfill of the address history
+func RegisterBtcAccount(uid, address string) (*store.BtcAccountSchema, *utils.ErrorService) {
+	params := btc.ChainParams(env.EnvVars.BtcChain)
+	if address == "" {
+		if env.EnvVars.BtcXpub == "" {
+			return nil, &utils.ErrorService{Code: 400, Err: errors.New("an address is required, no derivation pool is configured")}
+		}
+		index, errIndex := store.Firestore.NextDerivationIndex(env.EnvVars.BtcChain)
+		if errIndex != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: errIndex}
+		}
+		derived, errDerive := btc.DeriveAddress(env.EnvVars.BtcXpub, uint32(index), params)
+		if errDerive != nil {
+			return nil, &utils.ErrorService{Code: 500, Err: errDerive}
+		}
+		address = derived
+	} else if _, errAddr := btc.DecodeAddress(address, params); errAddr != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: errAddr}
+	}
+
+	if err := store.Firestore.CreateBtcAccount(uid, address); err != nil {
+		if err == store.ErrAccountExists || err == store.ErrAddressTaken {
+			return nil, &utils.ErrorService{Code: 409, Err: err}
+		}
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	now := time.Now()
+	b := &store.BtcBackfillSchema{
+		UID:       uid,
+		Address:   address,
+		Status:    store.BackfillPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.Firestore.SaveBtcBackfill(b); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	return &store.BtcAccountSchema{UID: uid, Address: address}, nil
+}
@@ -0,0 +1,67 @@
+package functions
+
+import (
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+	"github.com/SoteriaTech/blockchain-functions/webhook"
+)
+
+// RegisterWebhook register an endpoint receiving the events of the given types. Its signing secret is only returned
+// at registration and rotation
+func RegisterWebhook(url string, events []string) (*store.WebhookSchema, *utils.ErrorService) {
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	now := time.Now()
+	w := &store.WebhookSchema{
+		URL:       url,
+		Secret:    secret,
+		Events:    events,
+		Active:    true,
+		CreatedAt: now,
+		RotatedAt: now,
+	}
+	if err := store.Firestore.CreateWebhook(w); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	return w, nil
+}
+
+// ListWebhooks list the registered webhooks, without their secret
+func ListWebhooks() ([]*store.WebhookSchema, *utils.ErrorService) {
+	ws, err := store.Firestore.FindWebhooks("")
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	for _, w := range ws {
+		w.Secret = ""
+	}
+	if ws == nil {
+		ws = []*store.WebhookSchema{}
+	}
+	return ws, nil
+}
+
+// RotateWebhookSecret replace the signing secret of a webhook, events are signed with the new secret right away
+func RotateWebhookSecret(id string) (*store.WebhookSchema, *utils.ErrorService) {
+	w, err := store.Firestore.FindWebhook(id)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: err}
+	}
+
+	if w.Secret, err = webhook.NewSecret(); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	w.RotatedAt = time.Now()
+	if err := store.Firestore.UpdateWebhook(w); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	return w, nil
+}
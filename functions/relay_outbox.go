@@ -0,0 +1,47 @@
+package functions
+
+import (
+	"github.com/SoteriaTech/blockchain-functions/outbox"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// outboxBatch maximum number of events relayed at once
+const outboxBatch = 100
+
+// outboxStore store of the events of the outbox
+type outboxStore interface {
+	FindUnpublishedEvents(limit int) ([]*store.OutboxEventSchema, error)
+	MarkEventPublished(id string) error
+}
+
+// RelayOutbox publish the events of the outbox in order and return how many were published. Relaying stops at the
+// first failure so that no event is published before an older one. Delivery is at-least-once: an event that
+// couldn't be marked as published is published again by the next relay
+func RelayOutbox() (int, error) {
+	return relayOutbox(store.Firestore, outbox.Relay)
+}
+
+func relayOutbox(s outboxStore, p outbox.Publisher) (int, error) {
+	n := 0
+	for {
+		es, err := s.FindUnpublishedEvents(outboxBatch)
+		if err != nil {
+			return n, err
+		}
+
+		for _, e := range es {
+			attrs := map[string]string{"event_id": e.ID, "type": e.Type}
+			if err := p.Publish(e.Type, e.Key, []byte(e.Payload), attrs); err != nil {
+				return n, err
+			}
+			if err := s.MarkEventPublished(e.ID); err != nil {
+				return n, err
+			}
+			n++
+		}
+
+		if len(es) < outboxBatch {
+			return n, nil
+		}
+	}
+}
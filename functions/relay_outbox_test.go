@@ -0,0 +1,153 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/outbox"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// memoryOutbox outbox kept in memory in order of creation, failing to mark the events of failMark as published
+type memoryOutbox struct {
+	events   []*store.OutboxEventSchema
+	failMark map[string]bool
+}
+
+func newMemoryOutbox(n int) *memoryOutbox {
+	o := &memoryOutbox{failMark: map[string]bool{}}
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		o.events = append(o.events, &store.OutboxEventSchema{
+			ID:        "event-" + strconv.Itoa(i),
+			Type:      store.EventBalanceChanged,
+			Key:       "user-" + strconv.Itoa(i%3),
+			Payload:   fmt.Sprintf(`{"seq":%d}`, i),
+			Seq:       i,
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	return o
+}
+
+func (o *memoryOutbox) FindUnpublishedEvents(limit int) ([]*store.OutboxEventSchema, error) {
+	var es []*store.OutboxEventSchema
+	for _, e := range o.events {
+		if !e.Published && len(es) < limit {
+			es = append(es, e)
+		}
+	}
+	return es, nil
+}
+
+func (o *memoryOutbox) MarkEventPublished(id string) error {
+	if o.failMark[id] {
+		return errors.New("deadline exceeded")
+	}
+	for _, e := range o.events {
+		if e.ID == id {
+			e.Published = true
+		}
+	}
+	return nil
+}
+
+// failingPublisher memory publisher failing to publish the events of fail
+type failingPublisher struct {
+	outbox.MemoryPublisher
+	fail map[string]bool
+}
+
+func (p *failingPublisher) Publish(topic, orderingKey string, data []byte, attrs map[string]string) error {
+	if p.fail[attrs["event_id"]] {
+		return errors.New("unavailable")
+	}
+	return p.MemoryPublisher.Publish(topic, orderingKey, data, attrs)
+}
+
+// published ids of the published events, in order
+func published(p *outbox.MemoryPublisher) []string {
+	var ids []string
+	for _, m := range p.Messages {
+		ids = append(ids, m.Attributes["event_id"])
+	}
+	return ids
+}
+
+func assertIDs(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("published %v, want %v", got, want)
+	}
+}
+
+func TestRelayOutboxOrder(t *testing.T) {
+	// more events than a batch, across several ordering keys
+	o := newMemoryOutbox(2*outboxBatch + 5)
+	p := &outbox.MemoryPublisher{}
+
+	n, err := relayOutbox(o, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(o.events) || len(p.Messages) != len(o.events) {
+		t.Fatalf("relayed %d events and published %d, want %d", n, len(p.Messages), len(o.events))
+	}
+	for i, m := range p.Messages {
+		e := o.events[i]
+		if m.Attributes["event_id"] != e.ID || m.Topic != e.Type || m.OrderingKey != e.Key || string(m.Data) != e.Payload {
+			t.Fatalf("message %d is %+v, want event %+v", i, m, e)
+		}
+		if !e.Published {
+			t.Fatalf("%s isn't marked as published", e.ID)
+		}
+	}
+
+	// published events aren't relayed again
+	if n, err := relayOutbox(o, p); err != nil || n != 0 {
+		t.Fatalf("relayed %d events again (%v)", n, err)
+	}
+}
+
+func TestRelayOutboxStopsOnFailure(t *testing.T) {
+	o := newMemoryOutbox(4)
+	p := &failingPublisher{fail: map[string]bool{"event-1": true}}
+
+	n, err := relayOutbox(o, p)
+	if err == nil || n != 1 {
+		t.Fatalf("relayed %d events (%v), want to stop after the first one", n, err)
+	}
+	// no event is published after one that failed
+	assertIDs(t, published(&p.MemoryPublisher), "event-0")
+	if o.events[1].Published || o.events[2].Published {
+		t.Fatal("events after the failure marked as published")
+	}
+
+	p.fail = nil
+	if n, err := relayOutbox(o, p); err != nil || n != 3 {
+		t.Fatalf("relayed %d events (%v), want the 3 left", n, err)
+	}
+	assertIDs(t, published(&p.MemoryPublisher), "event-0", "event-1", "event-2", "event-3")
+}
+
+func TestRelayOutboxRepublishesUnmarked(t *testing.T) {
+	o := newMemoryOutbox(3)
+	o.failMark["event-1"] = true
+	p := &outbox.MemoryPublisher{}
+
+	n, err := relayOutbox(o, p)
+	if err == nil || n != 1 {
+		t.Fatalf("relayed %d events (%v), want to stop when marking event-1 fails", n, err)
+	}
+	assertIDs(t, published(p), "event-0", "event-1")
+
+	// the event is published again, with the same id for subscribers to deduplicate it
+	delete(o.failMark, "event-1")
+	if n, err := relayOutbox(o, p); err != nil || n != 2 {
+		t.Fatalf("relayed %d events (%v), want 2", n, err)
+	}
+	assertIDs(t, published(p), "event-0", "event-1", "event-1", "event-2")
+}
@@ -0,0 +1,36 @@
+package functions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// ReplayWebhookDelivery deliver again an event to a webhook, whether it was delivered or became a dead-letter. The
+// event keeps its id so that the endpoint may recognize it
+func ReplayWebhookDelivery(id string) (*store.WebhookDeliverySchema, *utils.ErrorService) {
+	d, err := store.Firestore.FindWebhookDelivery(id)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: err}
+	}
+
+	w, err := store.Firestore.FindWebhook(d.WebhookID)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: err}
+	}
+	if !w.Active {
+		return nil, &utils.ErrorService{Code: 409, Err: errors.New("webhook is inactive")}
+	}
+
+	// a replay gets the full number of attempts again
+	d.Status = store.DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Now()
+	if err := deliverWebhook(d, w); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	return d, nil
+}
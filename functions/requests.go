@@ -0,0 +1,472 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+const (
+	// MaxBlockHeight upper bound of the block heights accepted by requests
+	MaxBlockHeight = 10000000
+	// DefaultPageSize size of the pages of paginated requests that don't give a limit
+	DefaultPageSize = 20
+	// MaxPageSize maximum size of the pages of paginated requests
+	MaxPageSize = 100
+)
+
+// EmptyRequest request of the functions that take no parameters
+type EmptyRequest struct{}
+
+// Validate validate the request
+func (r *EmptyRequest) Validate() error {
+	return nil
+}
+
+// AccountRequest request of the functions acting on an account. Only admins may give another uid than their own
+type AccountRequest struct {
+	UID string `json:"uid"`
+}
+
+// Validate validate the request
+func (r *AccountRequest) Validate() error {
+	return nil
+}
+
+// AccountStatusRequest request of the functions changing the status of an account
+type AccountStatusRequest struct {
+	UID    string `json:"uid"`
+	Reason string `json:"reason"`
+}
+
+// Validate validate the request
+func (r *AccountStatusRequest) Validate() error {
+	if r.UID == "" {
+		return errors.New("uid is required")
+	}
+	if strings.TrimSpace(r.Reason) == "" {
+		return errors.New("reason is required")
+	}
+	return nil
+}
+
+// ScanBtcBlockRequest request of ScanBtcBlock
+type ScanBtcBlockRequest struct {
+	Height int `json:"height,string"`
+}
+
+// Validate validate the request
+func (r *ScanBtcBlockRequest) Validate() error {
+	if r.Height <= 0 || r.Height > MaxBlockHeight {
+		return fmt.Errorf("height must be between 1 and %d", MaxBlockHeight)
+	}
+	return nil
+}
+
+// CreateBtcWithdrawalRequest request of CreateBtcWithdrawal. Amount is in btc and FeeRate in sat/vB,
+// the normal fee estimate is used if FeeRate is 0
+type CreateBtcWithdrawalRequest struct {
+	To      string  `json:"to"`
+	Amount  float64 `json:"amount,string"`
+	FeeRate int64   `json:"fee_rate,string,omitempty"`
+}
+
+// Validate validate the request
+func (r *CreateBtcWithdrawalRequest) Validate() error {
+	if r.To == "" {
+		return errors.New("to is required")
+	}
+	if _, err := btc.DecodeAddress(r.To, btc.ChainParams(env.EnvVars.BtcChain)); err != nil {
+		return err
+	}
+	if r.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if r.FeeRate < 0 || r.FeeRate > btc.MaxFeeRate {
+		return fmt.Errorf("fee_rate must be between 0 and %d", btc.MaxFeeRate)
+	}
+	return nil
+}
+
+// WithdrawalRequest request of the functions acting on a withdrawal request
+type WithdrawalRequest struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Validate validate the request
+func (r *WithdrawalRequest) Validate() error {
+	if r.ID == "" {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// DepositRequest request of the functions reviewing a deposit
+type DepositRequest struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Validate validate the request
+func (r *DepositRequest) Validate() error {
+	if r.ID == "" {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// SubmitBtcWithdrawalRequest request of SubmitBtcWithdrawal, the signed transaction is given either as a psbt or raw
+type SubmitBtcWithdrawalRequest struct {
+	ID   string `json:"id"`
+	Psbt string `json:"psbt,omitempty"`
+	Tx   string `json:"tx,omitempty"`
+}
+
+// Validate validate the request
+func (r *SubmitBtcWithdrawalRequest) Validate() error {
+	if r.ID == "" {
+		return errors.New("id is required")
+	}
+	if (r.Psbt == "") == (r.Tx == "") {
+		return errors.New("exactly one of psbt and tx is required")
+	}
+	return nil
+}
+
+// ListBtcTransactionsRequest request of ListBtcTransactions. From and To are RFC 3339 dates bounding the
+// transactions time, To being excluded
+type ListBtcTransactionsRequest struct {
+	UID       string `json:"uid"`
+	Cursor    string `json:"cursor,omitempty"`
+	Limit     int    `json:"limit,string,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+}
+
+// Validate validate the request
+func (r *ListBtcTransactionsRequest) Validate() error {
+	if r.Limit == 0 {
+		r.Limit = DefaultPageSize
+	}
+	if r.Limit < 0 || r.Limit > MaxPageSize {
+		return fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+	}
+	switch r.Status {
+	case "", StatusConfirmed, StatusPending:
+	default:
+		return fmt.Errorf("status must be %s or %s", StatusConfirmed, StatusPending)
+	}
+	switch r.Direction {
+	case "", store.DirectionIn, store.DirectionOut:
+	default:
+		return fmt.Errorf("direction must be %s or %s", store.DirectionIn, store.DirectionOut)
+	}
+	if _, err := r.Filter(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Filter get the transaction filter of the request
+func (r *ListBtcTransactionsRequest) Filter() (*BtcTransactionFilter, error) {
+	f := &BtcTransactionFilter{Status: r.Status, Direction: r.Direction}
+	var err error
+	if r.From != "" {
+		if f.From, err = time.Parse(time.RFC3339, r.From); err != nil {
+			return nil, errors.New("from must be an RFC 3339 date")
+		}
+	}
+	if r.To != "" {
+		if f.To, err = time.Parse(time.RFC3339, r.To); err != nil {
+			return nil, errors.New("to must be an RFC 3339 date")
+		}
+	}
+	return f, nil
+}
+
+// RegisterBtcAccountRequest request of RegisterBtcAccount, an address is assigned from the derivation pool if
+// Address is empty
+type RegisterBtcAccountRequest struct {
+	UID     string `json:"uid"`
+	Address string `json:"address,omitempty"`
+}
+
+// Validate validate the request
+func (r *RegisterBtcAccountRequest) Validate() error {
+	if r.Address == "" {
+		return nil
+	}
+	_, err := btc.DecodeAddress(r.Address, btc.ChainParams(env.EnvVars.BtcChain))
+	return err
+}
+
+// PageRequest request of the paginated history of an account
+type PageRequest struct {
+	UID    string `json:"uid"`
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,string,omitempty"`
+}
+
+// Validate validate the request
+func (r *PageRequest) Validate() error {
+	if r.Limit == 0 {
+		r.Limit = DefaultPageSize
+	}
+	if r.Limit < 0 || r.Limit > MaxPageSize {
+		return fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+	}
+	return nil
+}
+
+// GetBtcRateRequest request of GetBtcRate. Time is an RFC 3339 date, the current rate is returned if it is empty
+type GetBtcRateRequest struct {
+	Currency string `json:"currency"`
+	Time     string `json:"time,omitempty"`
+}
+
+// Validate validate the request
+func (r *GetBtcRateRequest) Validate() error {
+	if len(r.Currency) != 3 || strings.ToUpper(r.Currency) != r.Currency {
+		return errors.New("currency must be an uppercase ISO 4217 code")
+	}
+	if _, err := r.At(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// At time of the requested rate, zero for the current rate
+func (r *GetBtcRateRequest) At() (time.Time, error) {
+	if r.Time == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, r.Time)
+	if err != nil {
+		return t, errors.New("time must be an RFC 3339 date")
+	}
+	return t, nil
+}
+
+// GetBalanceHistoryRequest request of GetBalanceHistory. From and To are RFC 3339 dates, To being excluded, the
+// history ends now and covers 7 days hourly or 90 days daily by default
+type GetBalanceHistoryRequest struct {
+	UID         string `json:"uid"`
+	Granularity string `json:"granularity,omitempty"`
+	From        string `json:"from,omitempty"`
+	To          string `json:"to,omitempty"`
+}
+
+// Validate validate the request
+func (r *GetBalanceHistoryRequest) Validate() error {
+	switch r.Granularity {
+	case "":
+		r.Granularity = Hourly
+	case Hourly, Daily:
+	default:
+		return fmt.Errorf("granularity must be %s or %s", Hourly, Daily)
+	}
+	from, to, err := r.Period()
+	if err != nil {
+		return err
+	}
+	if !from.Before(to) {
+		return errors.New("from must be before to")
+	}
+	return nil
+}
+
+// Period bounds of the requested history
+func (r *GetBalanceHistoryRequest) Period() (from, to time.Time, err error) {
+	to = time.Now()
+	if r.To != "" {
+		if to, err = time.Parse(time.RFC3339, r.To); err != nil {
+			return from, to, errors.New("to must be an RFC 3339 date")
+		}
+	}
+	from = to.AddDate(0, 0, -7)
+	if r.Granularity == Daily {
+		from = to.AddDate(0, 0, -90)
+	}
+	if r.From != "" {
+		if from, err = time.Parse(time.RFC3339, r.From); err != nil {
+			return from, to, errors.New("from must be an RFC 3339 date")
+		}
+	}
+	return from, to, nil
+}
+
+// IDRequest request of the functions acting on a single document
+type IDRequest struct {
+	ID string `json:"id"`
+}
+
+// Validate validate the request
+func (r *IDRequest) Validate() error {
+	if r.ID == "" {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// RegisterWebhookRequest request of RegisterWebhook, the endpoint receives every deposit event if Events is empty
+type RegisterWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+// Validate validate the request
+func (r *RegisterWebhookRequest) Validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || !u.IsAbs() || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) url")
+	}
+	if len(r.Events) == 0 {
+		r.Events = []string{store.DepositDetected, store.DepositConfirmed, store.DepositReversed}
+	}
+	for _, e := range r.Events {
+		switch e {
+		case store.DepositDetected, store.DepositConfirmed, store.DepositReversed:
+		default:
+			return fmt.Errorf("unknown event type %s", e)
+		}
+	}
+	return nil
+}
+
+// GenerateReserveReportRequest request of GenerateReserveReport, Height is the last scanned block or 0
+type GenerateReserveReportRequest struct {
+	Height int `json:"height,string,omitempty"`
+}
+
+// Validate validate the request
+func (r *GenerateReserveReportRequest) Validate() error {
+	if r.Height < 0 || r.Height > MaxBlockHeight {
+		return fmt.Errorf("height must be between 0 and %d", MaxBlockHeight)
+	}
+	return nil
+}
+
+// ReserveReportRequest request of the functions reading a proof of reserves, the latest one if ID is empty
+type ReserveReportRequest struct {
+	ID string `json:"id,omitempty"`
+}
+
+// Validate validate the request
+func (r *ReserveReportRequest) Validate() error {
+	return nil
+}
+
+// ReserveProofRequest request of GetReserveProof. Only admins may give another uid than their own
+type ReserveProofRequest struct {
+	UID    string `json:"uid"`
+	Report string `json:"report,omitempty"`
+}
+
+// Validate validate the request
+func (r *ReserveProofRequest) Validate() error {
+	return nil
+}
+
+// CreateAddressChallengeRequest request of CreateAddressChallenge. Only admins may give another uid than their own
+type CreateAddressChallengeRequest struct {
+	UID     string `json:"uid"`
+	Address string `json:"address"`
+}
+
+// Validate validate the request
+func (r *CreateAddressChallengeRequest) Validate() error {
+	_, err := btc.AddressScript(r.Address, btc.ChainParams(env.EnvVars.BtcChain))
+	return err
+}
+
+// VerifyBtcAddressRequest request of VerifyBtcAddress, Signature is base64 encoded
+type VerifyBtcAddressRequest struct {
+	UID       string `json:"uid"`
+	ID        string `json:"id"`
+	Signature string `json:"signature"`
+}
+
+// Validate validate the request
+func (r *VerifyBtcAddressRequest) Validate() error {
+	if r.ID == "" {
+		return errors.New("id is required")
+	}
+	if r.Signature == "" {
+		return errors.New("signature is required")
+	}
+	return nil
+}
+
+const (
+	// DefaultInvoiceTTL time after which invoices that don't give one expire
+	DefaultInvoiceTTL = time.Hour
+	// MaxInvoiceTTL maximum time an invoice can wait for its payment
+	MaxInvoiceTTL = 30 * 24 * time.Hour
+	// MaxMemoLength maximum length of the memo of an invoice
+	MaxMemoLength = 200
+)
+
+// CreateInvoiceRequest request of CreateInvoice. Amount is in btc and ExpiresIn in seconds
+type CreateInvoiceRequest struct {
+	Amount    float64 `json:"amount,string"`
+	Memo      string  `json:"memo,omitempty"`
+	ExpiresIn int64   `json:"expires_in,string,omitempty"`
+}
+
+// Validate validate the request
+func (r *CreateInvoiceRequest) Validate() error {
+	if r.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if len(r.Memo) > MaxMemoLength {
+		return fmt.Errorf("memo must be at most %d characters", MaxMemoLength)
+	}
+	if r.ExpiresIn < 0 || r.ExpiresIn > int64(MaxInvoiceTTL/time.Second) {
+		return fmt.Errorf("expires_in must be between 0 and %d seconds", int64(MaxInvoiceTTL/time.Second))
+	}
+	return nil
+}
+
+// TTL time after which the invoice expires
+func (r *CreateInvoiceRequest) TTL() time.Duration {
+	if r.ExpiresIn == 0 {
+		return DefaultInvoiceTTL
+	}
+	return time.Duration(r.ExpiresIn) * time.Second
+}
+
+// InvoiceRequest request of the functions acting on an invoice. Only admins may give another uid than their own
+type InvoiceRequest struct {
+	UID string `json:"uid"`
+	ID  string `json:"id"`
+}
+
+// Validate validate the request
+func (r *InvoiceRequest) Validate() error {
+	if r.ID == "" {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// ScreeningAlertsRequest request of ListScreeningAlerts
+type ScreeningAlertsRequest struct {
+	Status string `json:"status"`
+}
+
+// Validate validate the request
+func (r *ScreeningAlertsRequest) Validate() error {
+	if r.Status != "" && r.Status != store.AlertOpen {
+		return fmt.Errorf("unknown status %s", r.Status)
+	}
+	return nil
+}
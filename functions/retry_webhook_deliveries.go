@@ -0,0 +1,38 @@
+package functions
+
+import (
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// RetryWebhookDeliveries attempt the queued deliveries and again the failed ones whose backoff is over, and return
+// how many were attempted. Deliveries to inactive or deleted webhooks are left pending
+func RetryWebhookDeliveries() (int, error) {
+	ds, err := store.Firestore.FindDueWebhookDeliveries(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	ws := make(map[string]*store.WebhookSchema)
+	n := 0
+	for _, d := range ds {
+		w, ok := ws[d.WebhookID]
+		if !ok {
+			if w, err = store.Firestore.FindWebhook(d.WebhookID); err != nil {
+				w = nil
+			}
+			ws[d.WebhookID] = w
+		}
+		if w == nil || !w.Active {
+			continue
+		}
+
+		if err := deliverWebhook(d, w); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
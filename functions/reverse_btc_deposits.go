@@ -0,0 +1,61 @@
+package functions
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// ReverseBtcDeposits drop the unconfirmed deposits recorded above the given height, after a reorg replaced their
+// blocks. They are recorded again if the new blocks include them. Deposits already credited are left in place and
+// raise an alert for review
+func ReverseBtcDeposits(height int) error {
+	txs, err := store.Firestore.FindUnconfirmedBtcTransactionsAbove(height)
+	if err != nil {
+		return err
+	}
+
+	// the deposit is deleted last, so that a failed reversal is retried by the next rollback
+	for _, t := range txs {
+		if !t.Quarantined {
+			if err := ReverseInvoicePayment(t); err != nil {
+				return err
+			}
+			if err := EmitDepositEvent(store.DepositReversed, t); err != nil {
+				utils.ErrorReport.LogAndPrintError(err)
+			}
+		}
+		if err := store.Firestore.DeleteBtcTransaction(t.ID); err != nil {
+			return err
+		}
+	}
+
+	credited, err := store.Firestore.FindConfirmedBtcDepositsAbove(height)
+	if err != nil {
+		return err
+	}
+	for _, t := range credited {
+		a := &store.ScreeningAlertSchema{
+			ID:        "reorg-" + t.ID,
+			Kind:      store.ReorgedDeposit,
+			UID:       t.UID,
+			Address:   t.To,
+			Source:    "reorg",
+			Amount:    helpers.FromBtcToSatoshi(big.NewFloat(t.Amount)).Int64(),
+			TxHash:    t.TxHash,
+			VoutIdx:   t.VoutIdx,
+			Status:    store.AlertOpen,
+			CreatedAt: time.Now(),
+		}
+		if err := store.Firestore.CreateScreeningAlert(a); err != nil {
+			return err
+		}
+		utils.ErrorReport.LogAndPrintError(fmt.Errorf("deposit %s:%d to %s credited in block %d replaced by a reorg", t.TxHash, t.VoutIdx, t.UID, t.BlockHeight))
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package functions
+
+import (
+	"errors"
+
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// ListBtcDepositReviews list the deposits waiting for a review, oldest first
+func ListBtcDepositReviews() ([]*BtcTransaction, *utils.ErrorService) {
+	txs, err := store.Firestore.FindBtcTransactionsInReview()
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	cs, err := store.Firestore.GetChainState(env.EnvVars.BtcChain)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	reviews := make([]*BtcTransaction, len(txs))
+	for i, t := range txs {
+		reviews[i] = newBtcTransaction(t, cs.Height)
+	}
+	return reviews, nil
+}
+
+// ApproveBtcDeposit approve a deposit in review on behalf of a reviewer, it is credited by the scan once confirmed
+func ApproveBtcDeposit(id, reviewer, reason string) (*BtcTransaction, *utils.ErrorService) {
+	return reviewBtcDeposit(id, store.ReviewApproved, reviewer, reason)
+}
+
+// RejectBtcDeposit reject a deposit in review on behalf of a reviewer, it is never credited
+func RejectBtcDeposit(id, reviewer, reason string) (*BtcTransaction, *utils.ErrorService) {
+	return reviewBtcDeposit(id, store.ReviewRejected, reviewer, reason)
+}
+
+func reviewBtcDeposit(id, review, reviewer, reason string) (*BtcTransaction, *utils.ErrorService) {
+	t, err := store.Firestore.FindBtcTransaction(id)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if t == nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errors.New("unknown deposit " + id)}
+	}
+	// deposits of an account that is not active would be queued again
+	if review == store.ReviewApproved {
+		if errStatus := activeBtcAccount(t.UID); errStatus != nil {
+			return nil, errStatus
+		}
+	}
+
+	t, err = store.Firestore.ReviewBtcDeposit(id, review, reviewer, reason, confirmations)
+	if err == store.ErrNotInReview {
+		return nil, &utils.ErrorService{Code: 409, Err: err}
+	}
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	cs, err := store.Firestore.GetChainState(env.EnvVars.BtcChain)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return newBtcTransaction(t, cs.Height), nil
+}
@@ -0,0 +1,64 @@
+package functions
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// maxReorgDepth number of scanned blocks compared with the best chain when looking for the fork point of a reorg
+const maxReorgDepth = 100
+
+// ErrBtcReorg the block scanned doesn't extend the last scanned block, a reorg replaced it
+var ErrBtcReorg = errors.New("block doesn't extend the scanned chain")
+
+// FindBtcForkPoint height of the last scanned block still in the best chain, looking down from the given height.
+// Blocks scanned before their hash was recorded are assumed to be in the best chain
+func FindBtcForkPoint(height int) (int, error) {
+	for h := height; h > height-maxReorgDepth; h-- {
+		scanned, err := store.Firestore.FindBtcBlock(h)
+		if err != nil {
+			return 0, err
+		}
+		if scanned == nil {
+			return h, nil
+		}
+		block, err := btc.BtcService.FetchBlock(h)
+		if err != nil {
+			return 0, err
+		}
+		if block.Hash == scanned.Hash {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("no fork point found within %d blocks of %d", maxReorgDepth, height)
+}
+
+// RollbackBtcChain roll the scanned chain back to the fork point of a reorg found from the given height: the
+// deposits and utxos of the replaced blocks are dropped and the chain state is set to the fork point, from which
+// the next scan records the blocks of the best chain. Returns the fork point
+func RollbackBtcChain(chain string, height int) (int, error) {
+	fork, err := FindBtcForkPoint(height)
+	if err != nil {
+		return 0, err
+	}
+	if err := ReverseBtcDeposits(fork); err != nil {
+		return 0, err
+	}
+	if err := store.Firestore.RollbackBtcUtxos(fork); err != nil {
+		return 0, err
+	}
+	if err := store.Firestore.DeleteBtcBlocksAbove(fork); err != nil {
+		return 0, err
+	}
+
+	head := &btc.HeadBlock{Height: fork}
+	if scanned, err := store.Firestore.FindBtcBlock(fork); err != nil {
+		return 0, err
+	} else if scanned != nil {
+		head.Hash = scanned.Hash
+	}
+	return fork, store.Firestore.UpdateChainState(chain, head)
+}
@@ -1,17 +1,46 @@
 package functions
 
 import (
+	"time"
+
 	"github.com/SoteriaTech/blockchain-functions/btc"
 	"github.com/SoteriaTech/blockchain-functions/helpers"
 	"github.com/SoteriaTech/blockchain-functions/store"
 	"github.com/SoteriaTech/blockchain-functions/utils"
 )
 
-// ScanBtcBlock scan a btc block for transactions
+// confirmations number of blocks after which the block scan confirms a transaction
+const confirmations = 3
+
+// ScanBtcBlock scan a btc block for transactions, ErrBtcReorg is returned before anything is recorded when the block
+// doesn't extend the last scanned block
 func ScanBtcBlock(height int, accs []*store.BtcAccountSchema) ([]*store.BtcAccountSchema, error) {
+	block, txs, err := btc.BtcService.ScanBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := store.Firestore.FindBtcBlock(height - 1)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil && parent.Hash != block.PrevBlock {
+		return nil, ErrBtcReorg
+	}
 
 	// get transactions from 3 blocks earlier from store
-	prevTxs, _ := store.Firestore.FindTransactionsFromBlockHeight(height - 3)
+	prevTxs, _ := store.Firestore.FindTransactionsFromBlockHeight(height - confirmations)
+	// quarantined deposits are never credited, held and reviewed ones wait for their hold to end
+	var dueTxs []*store.BtcTransactionSchema
+	for _, t := range prevTxs {
+		if !t.Quarantined && t.HoldUntil == 0 && t.Review == "" {
+			dueTxs = append(dueTxs, t)
+		}
+	}
+	heldTxs, errHeld := store.Firestore.FindHeldBtcTransactions(height)
+	if errHeld != nil {
+		utils.ErrorReport.LogAndPrintError(errHeld)
+	}
+	prevTxs = append(dueTxs, heldTxs...)
 	if len(prevTxs) > 0 {
 		var tbc []string
 		for _, t := range prevTxs {
@@ -20,21 +49,82 @@ func ScanBtcBlock(height int, accs []*store.BtcAccountSchema) ([]*store.BtcAccou
 		hashes, _ := btc.BtcService.ConfirmTransactions(tbc)
 		if len(hashes) > 0 {
 			cTxs := helpers.FilterTransactionsByHash(prevTxs, hashes)
-			if err := helpers.ConfirmBtcTransactions(cTxs); err != nil {
+			if credited, err := helpers.ConfirmBtcTransactions(cTxs); err != nil {
 				utils.ErrorReport.LogAndPrintError(err)
+			} else {
+				for _, t := range credited {
+					t.Confirmed = true
+					if err := EmitDepositEvent(store.DepositConfirmed, t); err != nil {
+						utils.ErrorReport.LogAndPrintError(err)
+					}
+				}
 			}
 		}
 	}
 
-	txs, err := btc.BtcService.ScanBlock(height)
+	if err := SaveBtcFeeStats(block); err != nil {
+		utils.ErrorReport.LogAndPrintError(err)
+	}
+
+	// current rates only value recent blocks, older ones are valued from the history source
+	if time.Since(time.Unix(int64(block.Time), 0)) < recentBlockAge {
+		if err := SaveBtcRates(); err != nil {
+			utils.ErrorReport.LogAndPrintError(err)
+		}
+	}
+
+	// invoice addresses receive deposits to the account of their user
+	invoices, err := store.Firestore.GetAllInvoiceAddresses()
+	if err != nil {
+		return nil, err
+	}
+	accs = append(invoices, accs...)
+
+	if err := UpdateBtcUtxos(txs, accs); err != nil {
+		return nil, err
+	}
+
+	mined, err := UpdateBtcBroadcasts(height, txs)
 	if err != nil {
 		return nil, err
 	}
 
-	walletTxs := helpers.FilterTransactionsByAccountAddress(txs, accs)
+	// the change outputs of our own withdrawals are not deposits, their other outputs may pay our addresses
+	var deposits []*btc.Transaction
+	for _, t := range txs {
+		if change, ok := mined[t.Hash]; ok && !t.IsInput() && t.Address == change {
+			continue
+		}
+		deposits = append(deposits, t)
+	}
+
+	// deposits spending from blocklisted addresses are quarantined, they don't pay invoices
+	flagged := ScreenBtcInputs(deposits)
+	var payments []*btc.Transaction
+	for _, t := range deposits {
+		if flagged[t.Hash] == nil {
+			payments = append(payments, t)
+		}
+	}
+	if err := RecordInvoicePayments(payments, invoices); err != nil {
+		return nil, err
+	}
+
+	facts := newBlockFacts(deposits)
+	walletTxs := helpers.FilterTransactionsByAccountAddress(deposits, accs)
 	var uaccs []*store.BtcAccountSchema
-	for uid, t := range walletTxs {
+	for _, t := range walletTxs {
 		t.Confirmed = false
+		if in := flagged[t.TxHash]; in != nil {
+			if _, errQ := QuarantineBtcDeposit(t, in); errQ != nil {
+				return nil, errQ
+			}
+			continue
+		}
+		senders, errScore := scoreBtcDeposit(t, facts)
+		if errScore != nil {
+			return nil, errScore
+		}
 		exists, errTx := helpers.FindOrCreateBtcTransaction(t)
 		if errTx != nil {
 			return nil, errTx
@@ -42,7 +132,18 @@ func ScanBtcBlock(height int, accs []*store.BtcAccountSchema) ([]*store.BtcAccou
 		if exists != nil {
 			continue
 		}
-		uaccs = append(uaccs, &store.BtcAccountSchema{UID: uid, Address: t.To, Balance: t.Amount})
+		if err := store.Firestore.SaveSenders(t.UID, senders); err != nil {
+			utils.ErrorReport.LogAndPrintError(err)
+		}
+		if err := EmitDepositEvent(store.DepositDetected, t); err != nil {
+			utils.ErrorReport.LogAndPrintError(err)
+		}
+		uaccs = append(uaccs, &store.BtcAccountSchema{UID: t.UID, Address: t.To, Balance: t.Amount})
+	}
+
+	b := &store.BtcBlockSchema{Height: height, Hash: block.Hash, PrevHash: block.PrevBlock, ScannedAt: time.Now()}
+	if err := store.Firestore.SaveBtcBlock(b); err != nil {
+		return nil, err
 	}
 
 	return uaccs, nil
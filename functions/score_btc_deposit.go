@@ -0,0 +1,91 @@
+package functions
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/risk"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// velocityWindow period over which velocity rules sum the deposits of a user
+const velocityWindow = 24 * time.Hour
+
+// blockFacts what the risk rules know of the transactions of a scanned block, by transaction hash
+type blockFacts struct {
+	senders      map[string][]string
+	equalOutputs map[string]int
+	rbf          map[string]bool
+}
+
+// newBlockFacts gather the senders, the largest number of outputs of a same value and the replace-by-fee signaling
+// of the transactions of a scanned block
+func newBlockFacts(txs []*btc.Transaction) *blockFacts {
+	f := &blockFacts{
+		senders:      make(map[string][]string),
+		equalOutputs: make(map[string]int),
+		rbf:          make(map[string]bool),
+	}
+	values := make(map[string]map[int64]int)
+	seen := make(map[string]bool)
+	for _, t := range txs {
+		if t.IsInput() {
+			if t.SignalsRBF() {
+				f.rbf[t.Hash] = true
+			}
+			if t.Address != "" && !seen[t.Hash+t.Address] {
+				seen[t.Hash+t.Address] = true
+				f.senders[t.Hash] = append(f.senders[t.Hash], t.Address)
+			}
+			continue
+		}
+		if values[t.Hash] == nil {
+			values[t.Hash] = make(map[int64]int)
+		}
+		v := t.Value.Int64()
+		values[t.Hash][v]++
+		if values[t.Hash][v] > f.equalOutputs[t.Hash] {
+			f.equalOutputs[t.Hash] = values[t.Hash][v]
+		}
+	}
+	return f
+}
+
+// scoreBtcDeposit evaluate the risk rules on a deposit detected in a scanned block, and set its outcome along what
+// its confirmation waits for. Returns the senders its user never received from, nothing if no rule is configured
+func scoreBtcDeposit(t *store.BtcTransactionSchema, facts *blockFacts) ([]*store.SenderSchema, error) {
+	if len(risk.Rules.Rules) == 0 {
+		return nil, nil
+	}
+
+	velocity, err := store.Firestore.SumBtcDeposits(t.UID, t.Time.Add(-velocityWindow), t.Time)
+	if err != nil {
+		return nil, err
+	}
+	unseen, err := store.Firestore.FindNewSenders(t.UID, facts.senders[t.TxHash])
+	if err != nil {
+		return nil, err
+	}
+
+	t.Risk = risk.Rules.Evaluate(&risk.Deposit{
+		Amount:       helpers.FromBtcToSatoshi(big.NewFloat(t.Amount)).Int64(),
+		Velocity:     helpers.FromBtcToSatoshi(big.NewFloat(velocity)).Int64(),
+		NewSender:    len(unseen) > 0,
+		EqualOutputs: facts.equalOutputs[t.TxHash],
+		RBF:          facts.rbf[t.TxHash],
+	})
+	switch t.Risk.Action {
+	case risk.ActionHold:
+		t.HoldUntil = t.BlockHeight + confirmations + t.Risk.Confirmations
+	case risk.ActionReview:
+		t.Review = store.ReviewPending
+	}
+
+	senders := make([]*store.SenderSchema, len(unseen))
+	for i, a := range unseen {
+		senders[i] = &store.SenderSchema{Address: a, TxHash: t.TxHash, FirstSeen: t.Time}
+	}
+	return senders, nil
+}
@@ -0,0 +1,94 @@
+package functions
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/helpers"
+	"github.com/SoteriaTech/blockchain-functions/screening"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// screenedInput blocklisted address spending an input of a transaction
+type screenedInput struct {
+	Address string
+	Source  string
+}
+
+// ScreenBtcInputs screen the input addresses of the transactions of a scanned block, keyed by the hash of the
+// transactions spending from a blocklisted address
+func ScreenBtcInputs(txs []*btc.Transaction) map[string]*screenedInput {
+	flagged := make(map[string]*screenedInput)
+	if screening.Blocklist.Len() == 0 {
+		return flagged
+	}
+	for _, t := range txs {
+		if !t.IsInput() || flagged[t.Hash] != nil {
+			continue
+		}
+		if source, ok := screening.Blocklist.Contains(t.Address); ok {
+			flagged[t.Hash] = &screenedInput{Address: t.Address, Source: source}
+		}
+	}
+	return flagged
+}
+
+// QuarantineBtcDeposit record a deposit sent from a blocklisted address without crediting it, and raise an alert
+// for review. Returns whether it was newly quarantined
+func QuarantineBtcDeposit(t *store.BtcTransactionSchema, in *screenedInput) (bool, error) {
+	a := &store.ScreeningAlertSchema{
+		Kind:      store.ScreenedDeposit,
+		UID:       t.UID,
+		Address:   in.Address,
+		Source:    in.Source,
+		Amount:    helpers.FromBtcToSatoshi(big.NewFloat(t.Amount)).Int64(),
+		TxHash:    t.TxHash,
+		VoutIdx:   t.VoutIdx,
+		Status:    store.AlertOpen,
+		CreatedAt: time.Now(),
+	}
+	exists, err := store.Firestore.QuarantineBtcDeposit(t, a)
+	if err != nil || exists != nil {
+		return false, err
+	}
+	utils.ErrorReport.LogAndPrintError(fmt.Errorf("deposit %s:%d to %s quarantined, sent from %s listed by %s", t.TxHash, t.VoutIdx, t.UID, in.Address, in.Source))
+	return true, nil
+}
+
+// screenBtcWithdrawal raise an alert and fail the check of a withdrawal to a blocklisted address
+func screenBtcWithdrawal(w *store.BtcWithdrawalSchema) error {
+	source, ok := screening.Blocklist.Contains(w.To)
+	if !ok {
+		return nil
+	}
+	a := &store.ScreeningAlertSchema{
+		ID:         w.ID,
+		Kind:       store.ScreenedWithdrawal,
+		UID:        w.UID,
+		Address:    w.To,
+		Source:     source,
+		Amount:     w.Amount,
+		Withdrawal: w.ID,
+		Status:     store.AlertOpen,
+		CreatedAt:  time.Now(),
+	}
+	if err := store.Firestore.CreateScreeningAlert(a); err != nil {
+		return err
+	}
+	return fmt.Errorf("withdrawal to an address listed by %s", source)
+}
+
+// ListScreeningAlerts list the screening alerts of a status, all of them if status is empty
+func ListScreeningAlerts(status string) ([]*store.ScreeningAlertSchema, *utils.ErrorService) {
+	as, err := store.Firestore.FindScreeningAlerts(status)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if as == nil {
+		as = []*store.ScreeningAlertSchema{}
+	}
+	return as, nil
+}
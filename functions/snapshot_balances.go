@@ -0,0 +1,47 @@
+package functions
+
+import (
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// SnapshotBalances record the balance of every account at the given head block, valued at the recorded rates of the
+// configured currencies. Currencies without rate are left out of the values
+func SnapshotBalances(head *btc.HeadBlock) error {
+	balances, err := store.Firestore.FindBtcBalances()
+	if err != nil {
+		return err
+	}
+
+	t := time.Unix(int64(head.Time), 0)
+	rates := make(map[string]float64)
+	for _, c := range env.EnvVars.PriceCurrencies {
+		r, errRate := GetBtcRate(c, t)
+		if errRate != nil {
+			utils.ErrorReport.LogAndPrintError(errRate.Err)
+			continue
+		}
+		rates[c] = r.Value
+	}
+
+	snaps := make([]*store.BalanceSnapshotSchema, 0, len(balances))
+	for uid, bal := range balances {
+		values := make(map[string]float64, len(rates))
+		for c, rate := range rates {
+			values[c] = roundAmount(c, bal*rate)
+		}
+		snaps = append(snaps, &store.BalanceSnapshotSchema{
+			UID:    uid,
+			Height: head.Height,
+			Time:   t,
+			BTC:    bal,
+			Values: values,
+		})
+	}
+
+	return store.Firestore.SaveBalanceSnapshots(snaps)
+}
@@ -0,0 +1,169 @@
+package functions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SubmitBtcWithdrawal broadcast an approved withdrawal signed offline, given either as a signed psbt or as a raw
+// transaction. The transaction is checked against the request and our utxo view before being broadcast and is
+// then tracked until it is mined
+func SubmitBtcWithdrawal(id, psbt, rawTx string) (*store.BtcWithdrawalSchema, *utils.ErrorService) {
+	w, errFind := store.Firestore.FindBtcWithdrawal(id)
+	if errFind != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: errFind}
+	}
+	if w.Status != store.WithdrawalApproved {
+		return nil, &utils.ErrorService{Code: 409, Err: fmt.Errorf("withdrawal is %s and cannot be submitted", w.Status)}
+	}
+	if errStatus := activeBtcAccount(w.UID); errStatus != nil {
+		return nil, errStatus
+	}
+
+	var tx *wire.MsgTx
+	var err error
+	switch {
+	case psbt != "":
+		tx, err = btc.ExtractPsbtTransaction(psbt)
+	case rawTx != "":
+		tx, err = btc.DecodeRawTransaction(rawTx)
+	default:
+		err = errors.New("either a signed psbt or a raw transaction is required")
+	}
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: err}
+	}
+
+	fee, errCheck := checkBtcWithdrawalTransaction(w, tx)
+	if errCheck != nil {
+		return nil, errCheck
+	}
+
+	encoded, errEncode := btc.EncodeRawTransaction(tx)
+	if errEncode != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: errEncode}
+	}
+
+	// signing claims the request: it can't be cancelled nor submitted again while it is broadcast
+	w, err = store.Firestore.TransitionBtcWithdrawal(id, []string{store.WithdrawalApproved}, func(w *store.BtcWithdrawalSchema) error {
+		w.Status = store.WithdrawalSigned
+		w.TxHash = tx.TxHash().String()
+		w.Fee = fee
+		return nil
+	})
+	if err != nil {
+		return nil, transitionError(err, "submitted")
+	}
+
+	hash, errBroadcast := btc.BtcService.Broadcast(tx)
+	if errBroadcast != nil {
+		if _, err := failBtcWithdrawal(w, errBroadcast.Error()); err != nil {
+			return nil, transitionError(err, "failed")
+		}
+		return nil, &utils.ErrorService{Code: 502, Err: errBroadcast}
+	}
+
+	b := &store.BtcBroadcastSchema{
+		UID:         w.UID,
+		TxHash:      hash,
+		RawTx:       encoded,
+		Fee:         fee,
+		Status:      store.BroadcastPending,
+		BroadcastAt: time.Now(),
+	}
+	// the broadcast is tracked along the change, so that the withdrawal is settled or timed out
+	w, err = store.Firestore.BroadcastBtcWithdrawal(id, b)
+	if err != nil {
+		return nil, transitionError(err, "broadcast")
+	}
+
+	return w, nil
+}
+
+// checkBtcWithdrawalTransaction check that a signed transaction is the one of the withdrawal psbt: it spends the
+// unspent outputs reserved for the request, pays the withdrawal and sends anything else back to the requester's
+// address, with a sensible fee covered by the hold
+func checkBtcWithdrawalTransaction(w *store.BtcWithdrawalSchema, tx *wire.MsgTx) (int64, *utils.ErrorService) {
+	params := btc.ChainParams(env.EnvVars.BtcChain)
+	dest, errAddr := btc.DecodeAddress(w.To, params)
+	if errAddr != nil {
+		return 0, &utils.ErrorService{Code: 500, Err: errAddr}
+	}
+	destScript, errScript := txscript.PayToAddrScript(dest)
+	if errScript != nil {
+		return 0, &utils.ErrorService{Code: 500, Err: errScript}
+	}
+	btcAccount, errFind := store.Firestore.FindBtcAccount(w.UID)
+	if errFind != nil {
+		return 0, &utils.ErrorService{Code: 500, Err: errFind}
+	}
+	changeAddr, errChange := btc.DecodeAddress(btcAccount.Address, params)
+	if errChange != nil {
+		return 0, &utils.ErrorService{Code: 500, Err: errChange}
+	}
+	changeScript, errScript := txscript.PayToAddrScript(changeAddr)
+	if errScript != nil {
+		return 0, &utils.ErrorService{Code: 500, Err: errScript}
+	}
+
+	pays := false
+	for _, out := range tx.TxOut {
+		switch {
+		case !pays && out.Value == w.Amount && bytes.Equal(out.PkScript, destScript):
+			pays = true
+		case !bytes.Equal(out.PkScript, changeScript):
+			return 0, &utils.ErrorService{Code: 400, Err: errors.New("transaction pays an output other than the withdrawal and its change")}
+		}
+	}
+	if !pays {
+		return 0, &utils.ErrorService{Code: 400, Err: errors.New("transaction doesn't pay the withdrawal amount to its destination")}
+	}
+
+	unsigned, errPsbt := btc.PsbtUnsignedTransaction(w.Psbt)
+	if errPsbt != nil {
+		return 0, &utils.ErrorService{Code: 500, Err: errPsbt}
+	}
+	outpoints := make(map[wire.OutPoint]bool, len(unsigned.TxIn))
+	for _, in := range unsigned.TxIn {
+		outpoints[in.PreviousOutPoint] = true
+	}
+	if len(tx.TxIn) != len(outpoints) {
+		return 0, &utils.ErrorService{Code: 400, Err: fmt.Errorf("transaction spends %d inputs, the withdrawal psbt %d", len(tx.TxIn), len(outpoints))}
+	}
+
+	var inputValue int64
+	for _, in := range tx.TxIn {
+		if !outpoints[in.PreviousOutPoint] {
+			return 0, &utils.ErrorService{Code: 400, Err: fmt.Errorf("input %s is not an input of the withdrawal psbt", in.PreviousOutPoint)}
+		}
+		delete(outpoints, in.PreviousOutPoint)
+		u, errUtxo := store.Firestore.FindBtcUtxoByOutpoint(in.PreviousOutPoint.Hash.String(), int(in.PreviousOutPoint.Index))
+		if errUtxo != nil {
+			return 0, &utils.ErrorService{Code: 500, Err: errUtxo}
+		}
+		if u == nil || u.Spent || u.UID != w.UID || u.ReservedBy != w.ID {
+			return 0, &utils.ErrorService{Code: 400, Err: fmt.Errorf("input %s is not an unspent output reserved for the withdrawal", in.PreviousOutPoint)}
+		}
+		inputValue += u.Value
+	}
+
+	fee, errFee := btc.CheckFee(tx, inputValue)
+	if errFee != nil {
+		return 0, &utils.ErrorService{Code: 400, Err: errFee}
+	}
+	if fee > w.Fee {
+		return 0, &utils.ErrorService{Code: 400, Err: fmt.Errorf("fee of %d satoshis exceeds the %d satoshis on hold", fee, w.Fee)}
+	}
+
+	return fee, nil
+}
@@ -1,6 +1,7 @@
 package functions
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/SoteriaTech/blockchain-functions/btc"
@@ -15,6 +16,9 @@ func SyncBtcBalance(uid string) (*store.BtcAccountSchema, *utils.ErrorService) {
 	if errFind != nil {
 		return nil, &utils.ErrorService{Code: 404, Err: errFind}
 	}
+	if !btcAccount.Active() {
+		return nil, &utils.ErrorService{Code: 403, Err: fmt.Errorf("account is %s", btcAccount.Status)}
+	}
 	newBalance, errBalance := btc.BtcService.GetAccountBalance(btcAccount.Address)
 	if errBalance != nil {
 		return nil, &utils.ErrorService{Code: 400, Err: errBalance}
@@ -0,0 +1,71 @@
+package functions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// FreezeBtcAccount freeze an account on behalf of an admin: its deposits are queued for review instead of being
+// credited, and it can't withdraw
+func FreezeBtcAccount(uid, actor, reason string) (*store.BtcAccountSchema, *utils.ErrorService) {
+	return updateBtcAccountStatus(uid, store.AccountFrozen, store.AuditFreeze, actor, reason)
+}
+
+// UnfreezeBtcAccount make a frozen account active again on behalf of an admin. The deposits queued while it was
+// frozen stay in review
+func UnfreezeBtcAccount(uid, actor, reason string) (*store.BtcAccountSchema, *utils.ErrorService) {
+	return updateBtcAccountStatus(uid, store.AccountActive, store.AuditUnfreeze, actor, reason)
+}
+
+// CloseBtcAccount close an account for good on behalf of an admin
+func CloseBtcAccount(uid, actor, reason string) (*store.BtcAccountSchema, *utils.ErrorService) {
+	return updateBtcAccountStatus(uid, store.AccountClosed, store.AuditClose, actor, reason)
+}
+
+func updateBtcAccountStatus(uid, status, action, actor, reason string) (*store.BtcAccountSchema, *utils.ErrorService) {
+	if _, err := store.Firestore.FindBtcAccount(uid); err != nil {
+		return nil, &utils.ErrorService{Code: 404, Err: err}
+	}
+	acc, err := store.Firestore.UpdateBtcAccountStatus(&store.AccountAuditSchema{
+		UID:       uid,
+		Action:    action,
+		Status:    status,
+		Reason:    reason,
+		Actor:     actor,
+		CreatedAt: time.Now(),
+	})
+	if err == store.ErrAccountClosed || err == store.ErrStatusUnchanged {
+		return nil, &utils.ErrorService{Code: 409, Err: err}
+	}
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return acc, nil
+}
+
+// ListBtcAccountAudit list the audit trail of an account, latest first
+func ListBtcAccountAudit(uid string) ([]*store.AccountAuditSchema, *utils.ErrorService) {
+	as, err := store.Firestore.FindAccountAudit(uid)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if as == nil {
+		as = []*store.AccountAuditSchema{}
+	}
+	return as, nil
+}
+
+// activeBtcAccount check that the account of a user's uid is active
+func activeBtcAccount(uid string) *utils.ErrorService {
+	acc, err := store.Firestore.FindBtcAccount(uid)
+	if err != nil {
+		return &utils.ErrorService{Code: 404, Err: err}
+	}
+	if !acc.Active() {
+		return &utils.ErrorService{Code: 403, Err: fmt.Errorf("account is %s", acc.Status)}
+	}
+	return nil
+}
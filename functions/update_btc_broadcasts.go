@@ -0,0 +1,69 @@
+package functions
+
+import (
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// UpdateBtcBroadcasts mark the broadcast transactions found in a scanned block as mined, settle the
+// corresponding withdrawals and return the change address of the mined transactions, by hash. Transactions still
+// pending after the broadcast timeout, evicted from the mempools or never mined, are dropped and their withdrawals fail
+func UpdateBtcBroadcasts(height int, txs []*btc.Transaction) (map[string]string, error) {
+	mined := make(map[string]string)
+	pending, err := store.Firestore.FindPendingBtcBroadcasts()
+	if err != nil || len(pending) == 0 {
+		return mined, err
+	}
+
+	hashes := make(map[string]bool, len(txs))
+	for _, t := range txs {
+		hashes[t.Hash] = true
+	}
+
+	for _, b := range pending {
+		if !hashes[b.TxHash] {
+			if b.Status == store.BroadcastPending && time.Since(b.BroadcastAt) > env.EnvVars.BroadcastTimeout {
+				if err := dropBtcBroadcast(b); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		// withdrawals send their change back to the address of their account
+		acc, err := store.Firestore.FindBtcAccount(b.UID)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Firestore.UpdateBtcBroadcastMined(b.TxHash, height); err != nil {
+			return nil, err
+		}
+		if err := ConfirmBtcWithdrawal(b.TxHash, height, txs); err != nil {
+			return nil, err
+		}
+		mined[b.TxHash] = acc.Address
+	}
+
+	return mined, nil
+}
+
+// dropBtcBroadcast mark a broadcast transaction as dropped and fail its withdrawal, releasing its hold
+func dropBtcBroadcast(b *store.BtcBroadcastSchema) error {
+	w, err := store.Firestore.FindBtcWithdrawalByTxHash(b.TxHash)
+	if err != nil {
+		return err
+	}
+	if w != nil {
+		_, err = store.Firestore.TransitionBtcWithdrawal(w.ID, []string{store.WithdrawalBroadcast}, func(w *store.BtcWithdrawalSchema) error {
+			w.Status = store.WithdrawalFailed
+			w.Reason = "transaction dropped, not mined after " + env.EnvVars.BroadcastTimeout.String()
+			return nil
+		})
+		if _, ok := err.(*store.WithdrawalStatusError); err != nil && !ok {
+			return err
+		}
+	}
+	return store.Firestore.UpdateBtcBroadcastDropped(b.TxHash)
+}
@@ -0,0 +1,45 @@
+package functions
+
+import (
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/store"
+)
+
+// UpdateBtcUtxos update the utxo set of the accounts from the outputs created and the inputs spent in a scanned block
+func UpdateBtcUtxos(txs []*btc.Transaction, accs []*store.BtcAccountSchema) error {
+	f := make(map[string]string, len(accs))
+	for _, a := range accs {
+		f[a.Address] = a.UID
+	}
+
+	for _, t := range txs {
+		uid, ok := f[t.Address]
+		if !ok {
+			continue
+		}
+
+		if t.IsInput() {
+			if err := store.Firestore.SpendBtcUtxo(store.UtxoID(t.TxIndex.String(), t.N), t.BlockHeight, t.Hash); err != nil {
+				return err
+			}
+			continue
+		}
+
+		u := &store.BtcUtxoSchema{
+			UID:         uid,
+			Address:     t.Address,
+			TxHash:      t.Hash,
+			TxIndex:     t.TxIndex.String(),
+			VoutIdx:     t.N,
+			Value:       t.Value.Int64(),
+			Script:      t.Script,
+			ScriptType:  btc.ScriptType(t.Script),
+			BlockHeight: t.BlockHeight,
+		}
+		if err := store.Firestore.SaveBtcUtxo(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package functions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/btc"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+// challengeTTL time given to sign the message of an address challenge
+const challengeTTL = 15 * time.Minute
+
+// CreateAddressChallenge issue the message a user's uid must sign with the key of an address to prove it controls it
+func CreateAddressChallenge(uid, address string) (*store.AddressChallengeSchema, *utils.ErrorService) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+
+	now := time.Now()
+	c := &store.AddressChallengeSchema{
+		UID:       uid,
+		Address:   address,
+		Nonce:     hex.EncodeToString(nonce),
+		CreatedAt: now,
+		ExpiresAt: now.Add(challengeTTL),
+	}
+	c.Message = fmt.Sprintf("Soteria address verification\nAddress: %s\nAccount: %s\nNonce: %s\nExpires: %s",
+		c.Address, c.UID, c.Nonce, c.ExpiresAt.UTC().Format(time.RFC3339))
+	if err := store.Firestore.CreateAddressChallenge(c); err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return c, nil
+}
+
+// VerifyBtcAddress verify the signature of the message of a challenge of a user's uid, legacy for P2PKH addresses
+// and BIP-322 simple for segwit and taproot ones, and mark its address as verified on the account
+func VerifyBtcAddress(uid, id, signature string) (*store.VerifiedAddressSchema, *utils.ErrorService) {
+	c, err := store.Firestore.FindAddressChallenge(id)
+	if err != nil {
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	if c == nil || c.UID != uid {
+		return nil, &utils.ErrorService{Code: 404, Err: errors.New("unknown challenge " + id)}
+	}
+	if c.Verified {
+		return nil, &utils.ErrorService{Code: 409, Err: store.ErrChallengeUsed}
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return nil, &utils.ErrorService{Code: 410, Err: errors.New("challenge expired")}
+	}
+
+	format, errSig := btc.VerifyMessage(c.Address, c.Message, signature, btc.ChainParams(env.EnvVars.BtcChain))
+	if errSig != nil {
+		return nil, &utils.ErrorService{Code: 400, Err: errSig}
+	}
+
+	v := &store.VerifiedAddressSchema{Address: c.Address, Format: format, Challenge: c.ID, VerifiedAt: time.Now()}
+	if err := store.Firestore.VerifyBtcAddress(c, v); err != nil {
+		if err == store.ErrChallengeUsed {
+			return nil, &utils.ErrorService{Code: 409, Err: err}
+		}
+		return nil, &utils.ErrorService{Code: 500, Err: err}
+	}
+	return v, nil
+}
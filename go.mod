@@ -5,9 +5,12 @@ go 1.16
 require (
 	cloud.google.com/go v0.81.0
 	cloud.google.com/go/firestore v1.5.0
+	cloud.google.com/go/pubsub v1.10.3
 	github.com/GoogleCloudPlatform/functions-framework-go v1.2.0
 	github.com/blockcypher/gobcy v2.0.1+incompatible
-	github.com/btcsuite/btcd v0.21.0-beta // indirect
+	github.com/btcsuite/btcd v0.21.0-beta
+	github.com/btcsuite/btcutil v1.0.2
+	github.com/btcsuite/btcutil/psbt v1.0.2
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/google/uuid v1.2.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
@@ -15,7 +18,6 @@ require (
 	golang.org/x/mod v0.4.2 // indirect
 	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
 	golang.org/x/text v0.3.6 // indirect
-	google.golang.org/api v0.44.0
-	google.golang.org/genproto v0.0.0-20210406143921-e86de6bf7a46 // indirect
+	google.golang.org/api v0.45.0
 	google.golang.org/grpc v1.37.0
 )
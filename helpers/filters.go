@@ -1,11 +1,15 @@
 package helpers
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/SoteriaTech/blockchain-functions/btc"
 	"github.com/SoteriaTech/blockchain-functions/store"
 )
 
-// FilterTransactionsByAccountAddress filter a list of transactions by a list of btc addresses
+// FilterTransactionsByAccountAddress filter the outputs of a list of transactions by a list of btc addresses, keyed
+// by transaction id as an account may receive several outputs in a block
 func FilterTransactionsByAccountAddress(txs []*btc.Transaction, accs []*store.BtcAccountSchema) map[string]*store.BtcTransactionSchema {
 	f := make(map[string]store.BtcAccountSchema, len(accs))
 	out := make(map[string]*store.BtcTransactionSchema)
@@ -13,6 +17,10 @@ func FilterTransactionsByAccountAddress(txs []*btc.Transaction, accs []*store.Bt
 		f[a.Address] = *a
 	}
 	for _, t := range txs {
+		// spent inputs are not deposits
+		if t.IsInput() {
+			continue
+		}
 		if acc, ok := f[t.Address]; ok {
 			tx := &store.BtcTransactionSchema{
 				To:          t.Address,
@@ -20,25 +28,28 @@ func FilterTransactionsByAccountAddress(txs []*btc.Transaction, accs []*store.Bt
 				Amount:      FromSatoshiToBtc(&t.Value),
 				BlockHeight: t.BlockHeight,
 				VoutIdx:     t.N,
+				Direction:   store.DirectionIn,
+				UID:         acc.UID,
+				Time:        time.Unix(int64(t.BlockTime), 0),
 			}
 
-			out[acc.UID] = tx
+			out[t.Hash+strconv.Itoa(t.N)] = tx
 		}
 	}
 	return out
 }
 
-// FilterTransactionsByHash filter transactions by a slice of hashes
+// FilterTransactionsByHash filter transactions by a slice of hashes, keeping every output of a transaction
 func FilterTransactionsByHash(txs []*store.BtcTransactionSchema, hashes []string) (out []*store.BtcTransactionSchema) {
-	f := make(map[string]*store.BtcTransactionSchema, len(txs))
+	f := make(map[string]bool, len(hashes))
 
-	for _, t := range txs {
-		f[t.TxHash] = t
+	for _, h := range hashes {
+		f[h] = true
 	}
 
-	for _, h := range hashes {
-		if _, ok := f[h]; ok {
-			out = append(out, f[h])
+	for _, t := range txs {
+		if f[t.TxHash] {
+			out = append(out, t)
 		}
 	}
 	return
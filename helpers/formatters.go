@@ -11,6 +11,8 @@ func FromSatoshiToBtc(i *big.Int) (f float64) {
 
 // FromBtcToSatoshi convert a value in btc (float) to a value in satoshi (int)
 func FromBtcToSatoshi(f *big.Float) *big.Int {
-	i, _ := f.Mul(f, big.NewFloat(10e9)).Int64()
+	sat := new(big.Float).Mul(f, big.NewFloat(1e8))
+	// round to the nearest satoshi, float values like 0.29 btc are not exact
+	i, _ := sat.Add(sat, big.NewFloat(0.5)).Int64()
 	return big.NewInt(i)
 }
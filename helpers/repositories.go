@@ -1,22 +1,16 @@
 package helpers
 
 import (
-	"log"
+	"fmt"
 	"math/big"
-	"strconv"
 
 	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
 )
 
 // FindOrCreateBtcTransaction find a btc transaction and returns it, or create it if not exist and returns nothing
 func FindOrCreateBtcTransaction(t *store.BtcTransactionSchema) (tx *store.BtcTransactionSchema, err error) {
-	tx, err = store.Firestore.FindBtcTransaction(t.TxHash + strconv.Itoa(t.VoutIdx))
-	if err != nil || tx != nil {
-		return
-	}
-
-	err = store.Firestore.CreateBtcTransaction(t)
-	return
+	return store.Firestore.FindOrCreateBtcTransaction(t)
 }
 
 // UpdateAccountBtcBalance update the btc balance of a user UID by a given amount
@@ -35,22 +29,27 @@ func UpdateAccountBtcBalance(uid string, amount *big.Float) (*big.Float, error)
 	return big.NewFloat(updatedBalance), nil
 }
 
-// ConfirmBtcTransactions confirm transactions and update corresponding balances
-func ConfirmBtcTransactions(txs []*store.BtcTransactionSchema) (err error) {
-	if err = store.Firestore.UpdateTransactionsConfirmation(txs); err != nil {
-		log.Fatal(err)
-		return
-	}
-
+// ConfirmBtcTransactions confirm transactions and update corresponding balances, returns the transactions credited.
+// Transactions that can't be confirmed are reported and left for the next scan
+func ConfirmBtcTransactions(txs []*store.BtcTransactionSchema) (credited []*store.BtcTransactionSchema, err error) {
 	for _, t := range txs {
-		a, err := store.Firestore.FindAccountByAddress(t.To)
+		uid := t.UID
+		// deposits recorded before withdrawals existed have no uid
+		if uid == "" {
+			a, err := store.Firestore.FindAccountByAddress(t.To)
+			if err != nil {
+				utils.ErrorReport.LogAndPrintError(fmt.Errorf("deposit %s:%d to %s: %v", t.TxHash, t.VoutIdx, t.To, err))
+				continue
+			}
+			uid = a.UID
+		}
+		ok, err := store.Firestore.ConfirmBtcDeposit(t, uid)
 		if err != nil {
-			log.Fatal(err)
+			utils.ErrorReport.LogAndPrintError(fmt.Errorf("deposit %s:%d to %s: %v", t.TxHash, t.VoutIdx, t.To, err))
 			continue
 		}
-		if _, err = UpdateAccountBtcBalance(a.UID, big.NewFloat(t.Amount)); err != nil {
-			log.Fatal(err)
-			continue
+		if ok {
+			credited = append(credited, t)
 		}
 	}
 
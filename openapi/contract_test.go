@@ -0,0 +1,467 @@
+package openapi
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/auth"
+	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/functions"
+	"github.com/SoteriaTech/blockchain-functions/price"
+	"github.com/SoteriaTech/blockchain-functions/reserves"
+	"github.com/SoteriaTech/blockchain-functions/risk"
+	"github.com/SoteriaTech/blockchain-functions/store"
+	"github.com/SoteriaTech/blockchain-functions/utils"
+)
+
+const testKid = "contract-key"
+
+var signingKey *rsa.PrivateKey
+
+// TestMain verify the ID tokens of the tests against a local JWKS serving signingKey
+func TestMain(m *testing.M) {
+	var err error
+	if signingKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	set := map[string][]map[string]string{"keys": {{
+		"kid": testKid,
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(signingKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(signingKey.E)).Bytes()),
+	}}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+
+	os.Setenv("GCP_PROJECT", env.DEVELOP)
+	os.Setenv("AUTH_JWKS_URL", srv.URL)
+	env.InitEnvVars()
+	auth.InitVerifier()
+
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
+// idToken sign an ID token of the uid for the project, with the given role claim
+func idToken(t *testing.T, uid, role string) string {
+	t.Helper()
+	now := time.Now()
+	claims := &auth.Token{
+		UID:      uid,
+		Role:     role,
+		Issuer:   "https://securetoken.google.com/" + env.EnvVars.ProjectID,
+		Audience: env.EnvVars.ProjectID,
+		Expires:  now.Add(time.Hour).Unix(),
+		IssuedAt: now.Unix(),
+	}
+	h, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": testKid, "typ": "JWT"})
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, signingKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+type handler func(t *auth.Token) (interface{}, *utils.ErrorService)
+
+// serve serve a request the way the HTTP functions of the root package do: authorize the caller, decode and validate
+// the body into req, then respond with the result of h or its error envelope
+func serve(w http.ResponseWriter, r *http.Request, admin bool, req utils.Request, h handler) {
+	rsp, err := func() (rsp interface{}, err *utils.ErrorService) {
+		defer func() {
+			if p := recover(); p != nil {
+				rsp, err = nil, &utils.ErrorService{Code: 500, Err: fmt.Errorf("panic: %v", p)}
+			}
+		}()
+		t, errAuth := auth.Authorize(r, admin)
+		if errAuth != nil {
+			return nil, errAuth
+		}
+		if errReq := utils.DecodeRequest(r, req); errReq != nil {
+			return nil, errReq
+		}
+		return h(t)
+	}()
+	if err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+	utils.RespondJSON(w, 200, rsp)
+}
+
+// contract an HTTP function as registered by the root package: its request, whether it is admin only, a valid body
+// and a response of the type it returns, with every optional field set
+type contract struct {
+	path  string
+	admin bool
+	req   func() utils.Request
+	body  string
+	rsp   interface{}
+}
+
+var (
+	now     = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	address = "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"
+	txHash  = strings.Repeat("ab", 32)
+)
+
+func account() *store.BtcAccountSchema {
+	return &store.BtcAccountSchema{UID: "user-1", Address: address, Balance: 0.5, Status: store.AccountFrozen}
+}
+
+func transaction() *functions.BtcTransaction {
+	return &functions.BtcTransaction{
+		ID: "tx-1", TxHash: txHash, VoutIdx: 1, Direction: store.DirectionIn, Address: address, BlockHeight: 1900000,
+		Time: now, Confirmed: true, Confirmations: 3, AmountSat: 1000, AmountBtc: 0.00001, UID: "user-1",
+		Risk:      &risk.Outcome{Score: 40, Rules: []string{"large"}, Action: risk.ActionReview, Confirmations: 6},
+		HoldUntil: 1900006, Review: store.ReviewApproved, ReviewedBy: "admin-1", ReviewReason: "known sender",
+		Quarantined: true,
+	}
+}
+
+func withdrawal() *store.BtcWithdrawalSchema {
+	return &store.BtcWithdrawalSchema{
+		ID: "w-1", UID: "user-1", To: address, Amount: 10000, Fee: 500, FeeRate: 5, Hold: 0.000105, Psbt: "cHNidP8=", Inputs: []string{"ti-1:0"},
+		Status: store.WithdrawalBroadcast, RequiredApprovals: 2, Approvals: []string{"admin-1"}, TxHash: txHash,
+		BlockHeight: 1900000, Reason: "dropped", CreatedAt: now, UpdatedAt: now,
+	}
+}
+
+func invoice() *store.InvoiceSchema {
+	return &store.InvoiceSchema{
+		ID: "inv-1", UID: "user-1", Address: address, Amount: 10000, Memo: "order 42", URI: "bitcoin:" + address,
+		Status: store.InvoiceUnderpaid, Received: 5000, Pending: 5000, CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+		UpdatedAt: now,
+	}
+}
+
+func webhook() *store.WebhookSchema {
+	return &store.WebhookSchema{
+		ID: "wh-1", URL: "https://example.com/hook", Secret: "whsec", Events: []string{store.DepositDetected},
+		Active: true, CreatedAt: now, RotatedAt: now,
+	}
+}
+
+func report() *store.ReserveReportSchema {
+	return &store.ReserveReportSchema{
+		ID: "r-1", Height: 1900000, BlockHash: txHash, Root: txHash, Liabilities: 100, Assets: 120, Accounts: 2,
+		Addresses: 3, PublicKey: "pk", Signature: "sig", CreatedAt: now,
+	}
+}
+
+func convertRequest() *store.ConvertRequestSchema {
+	return &store.ConvertRequestSchema{
+		ID: "c-1", UID: "user-1", From: "BTC", To: "USD", Amount: 0.1, Rate: 50000, Slippage: 0.01,
+		Status: store.ConvertCompleted, Reason: "filled", ExecutedRate: 50100, Received: 5010, CreatedAt: now,
+		ProcessedAt: now,
+	}
+}
+
+func contracts() []contract {
+	empty := func() utils.Request { return &functions.EmptyRequest{} }
+	accountReq := func() utils.Request { return &functions.AccountRequest{} }
+	statusReq := func() utils.Request { return &functions.AccountStatusRequest{} }
+	withdrawalReq := func() utils.Request { return &functions.WithdrawalRequest{} }
+	depositReq := func() utils.Request { return &functions.DepositRequest{} }
+	idReq := func() utils.Request { return &functions.IDRequest{} }
+
+	return []contract{
+		{"/SyncBtcBalance", false, accountReq, `{"uid":"user-1"}`, account()},
+		{"/RegisterBtcAccount", false, func() utils.Request { return &functions.RegisterBtcAccountRequest{} },
+			`{"uid":"user-1","address":"` + address + `"}`, account()},
+		{"/CreateAddressChallenge", false, func() utils.Request { return &functions.CreateAddressChallengeRequest{} },
+			`{"address":"` + address + `"}`, &store.AddressChallengeSchema{
+				ID: "ch-1", UID: "user-1", Address: address, Nonce: "n", Message: "sign me", Verified: true,
+				CreatedAt: now, ExpiresAt: now.Add(time.Hour), VerifiedAt: now,
+			}},
+		{"/VerifyBtcAddress", false, func() utils.Request { return &functions.VerifyBtcAddressRequest{} },
+			`{"id":"ch-1","signature":"c2ln"}`, &store.VerifiedAddressSchema{
+				Address: address, Format: "bip322", Challenge: "ch-1", VerifiedAt: now,
+			}},
+		{"/BackfillBtcAccount", false, accountReq, `{}`, &store.BtcBackfillSchema{
+			UID: "user-1", Address: address, Status: store.BackfillFailed, Transactions: 3, Error: "provider down",
+			CreatedAt: now, UpdatedAt: now,
+		}},
+		{"/GetBtcUtxos", false, accountReq, `{}`, &functions.BtcUtxoSet{
+			UID: "user-1", Address: address, Height: 1900000, Balance: 1000, ProviderBalance: 900, Drift: 100,
+			Utxos: []*functions.BtcUtxo{{BtcUtxoSchema: &store.BtcUtxoSchema{
+				UID: "user-1", Address: address, TxHash: txHash, TxIndex: "1", VoutIdx: 0, Value: 1000, Script: "0014",
+				ScriptType: "p2wpkh", BlockHeight: 1900000, Spent: true, SpentHeight: 1900001, SpentTxHash: txHash,
+				Quarantined: true, ReservedBy: "w-1",
+			}, Confirmations: 2}},
+		}},
+		{"/ListBtcTransactions", false, func() utils.Request { return &functions.ListBtcTransactionsRequest{} },
+			`{"limit":"10","status":"confirmed","direction":"in"}`, &functions.BtcTransactionPage{
+				Transactions: []*functions.BtcTransaction{transaction()}, NextCursor: "next",
+			}},
+		{"/CreateBtcWithdrawal", false, func() utils.Request { return &functions.CreateBtcWithdrawalRequest{} },
+			`{"to":"` + address + `","amount":"0.001","fee_rate":"5"}`, withdrawal()},
+		{"/SubmitBtcWithdrawal", true, func() utils.Request { return &functions.SubmitBtcWithdrawalRequest{} },
+			`{"id":"w-1","tx":"0200"}`, withdrawal()},
+		{"/ListBtcWithdrawals", false, accountReq, `{}`, []*store.BtcWithdrawalSchema{withdrawal()}},
+		{"/ListScreeningAlerts", true, func() utils.Request { return &functions.ScreeningAlertsRequest{} }, `{}`,
+			[]*store.ScreeningAlertSchema{{
+				ID: "a-1", Kind: store.ScreenedDeposit, UID: "user-1", Address: address, Source: "ofac", Amount: 1000,
+				TxHash: txHash, VoutIdx: 1, Withdrawal: "w-1", Status: store.AlertOpen, CreatedAt: now,
+			}}},
+		{"/FreezeBtcAccount", true, statusReq, `{"uid":"user-1","reason":"fraud"}`, account()},
+		{"/UnfreezeBtcAccount", true, statusReq, `{"uid":"user-1","reason":"cleared"}`, account()},
+		{"/CloseBtcAccount", true, statusReq, `{"uid":"user-1","reason":"request"}`, account()},
+		{"/ListBtcAccountAudit", true, accountReq, `{"uid":"user-1"}`, []*store.AccountAuditSchema{{
+			ID: "au-1", UID: "user-1", Action: store.AuditDepositReview, Status: store.AccountFrozen, Reason: "fraud",
+			Actor: "admin-1", Deposit: "tx-1", CreatedAt: now,
+		}}},
+		{"/ListBtcDepositReviews", true, empty, ``, []*functions.BtcTransaction{transaction()}},
+		{"/ApproveBtcDeposit", true, depositReq, `{"id":"tx-1","reason":"ok"}`, transaction()},
+		{"/RejectBtcDeposit", true, depositReq, `{"id":"tx-1"}`, transaction()},
+		{"/ApproveBtcWithdrawal", true, withdrawalReq, `{"id":"w-1"}`, withdrawal()},
+		{"/CancelBtcWithdrawal", false, withdrawalReq, `{"id":"w-1","reason":"mistake"}`, withdrawal()},
+		{"/CreateInvoice", false, func() utils.Request { return &functions.CreateInvoiceRequest{} },
+			`{"amount":"0.0001","memo":"order 42"}`, invoice()},
+		{"/GetInvoice", false, func() utils.Request { return &functions.InvoiceRequest{} }, `{"id":"inv-1"}`, invoice()},
+		{"/ListInvoices", false, accountReq, `{}`, []*store.InvoiceSchema{invoice()}},
+		{"/GetBtcFeeEstimate", false, empty, ``, &store.BtcFeeEstimateSchema{
+			Fast: 20, Normal: 10, Slow: 1.5, Height: 1900000, LastUpdated: now,
+		}},
+		{"/GetBalanceHistory", false, func() utils.Request { return &functions.GetBalanceHistoryRequest{} },
+			`{"granularity":"daily","from":"2021-02-01T00:00:00Z","to":"2021-03-01T00:00:00Z"}`,
+			&functions.BalanceHistory{UID: "user-1", Granularity: functions.Daily, Points: []*functions.BalancePoint{{
+				Time: now, Height: 1900000, BTC: 0.5, Values: map[string]float64{"USD": 25000},
+			}}}},
+		{"/ReconcileBtcBalances", true, empty, ``, &store.ReconciliationSchema{
+			ID: "run-1", Accounts: 2, Open: 1, Corrected: 0, Failed: 1, CreatedAt: now,
+			Discrepancies: []*store.BalanceDiscrepancySchema{{
+				ID: "d-1", Run: "run-1", UID: "user-1", Address: address, Stored: 1, Ledger: 0.9, Chain: 0.9,
+				Pending: 0.1, Converted: 0.05, InFlight: 0.2, Status: store.DiscrepancyCorrected, Adjustment: "adj-1",
+				CreatedAt: now,
+			}},
+		}},
+		{"/GenerateReserveReport", true, func() utils.Request { return &functions.GenerateReserveReportRequest{} },
+			`{"height":"1900000"}`, report()},
+		{"/GetReserveReport", false, func() utils.Request { return &functions.ReserveReportRequest{} },
+			`{"id":"r-1"}`, report()},
+		{"/GetReserveProof", false, func() utils.Request { return &functions.ReserveProofRequest{} },
+			`{"report":"r-1"}`, &store.ReserveProofSchema{
+				UID: "user-1", Nonce: "n", Balance: 100, Leaf: txHash, Report: report(),
+				Path: []*reserves.Step{{Hash: txHash, Sum: 20, Left: true}},
+			}},
+		{"/GetBtcRate", false, func() utils.Request { return &functions.GetBtcRateRequest{} },
+			`{"currency":"USD","time":"2021-03-01T12:00:00Z"}`, &price.Rate{
+				Base: "BTC", Quote: "USD", Value: 50000, Time: now,
+			}},
+		{"/ListConvertRequests", false, func() utils.Request { return &functions.PageRequest{} },
+			`{"cursor":"","limit":"20"}`, &functions.ConvertRequestPage{
+				Requests: []*store.ConvertRequestSchema{convertRequest()}, NextCursor: "next",
+			}},
+		{"/ProcessConvertRequests", true, empty, ``, []*store.ConvertRequestSchema{convertRequest()}},
+		{"/RegisterWebhook", true, func() utils.Request { return &functions.RegisterWebhookRequest{} },
+			`{"url":"https://example.com/hook","events":["deposit.detected"]}`, webhook()},
+		{"/ListWebhooks", true, empty, ``, []*store.WebhookSchema{webhook()}},
+		{"/RotateWebhookSecret", true, idReq, `{"id":"wh-1"}`, webhook()},
+		{"/ReplayWebhookDelivery", true, idReq, `{"id":"dl-1"}`, &store.WebhookDeliverySchema{
+			ID: "dl-1", WebhookID: "wh-1", EventID: "ev-1", Type: store.DepositConfirmed, Payload: "{}",
+			Status: store.DeliveryDead, Attempts: 8, NextAttemptAt: now, LastError: "timeout", CreatedAt: now,
+			DeliveredAt: now,
+		}},
+		{"/RelayOutbox", true, empty, ``, map[string]int{"published": 3}},
+		{"/ScanBtcBlock", true, func() utils.Request { return &functions.ScanBtcBlockRequest{} },
+			`{"height":"1900000"}`, []*store.BtcAccountSchema{account()}},
+		{"/test", true, empty, ``, &store.ChainStateSchema{
+			Hash: txHash, Time: 1614600000, LastUpdated: now, BlockIndex: 1, Height: 1900000, TxIndexes: []int{1, 2},
+		}},
+	}
+}
+
+// call post body to the contract, served by h, with the given bearer token
+func call(c contract, token, body string, h handler) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(body))
+	r.Header.Set("content-type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	serve(w, r, c.admin, c.req(), h)
+	return w
+}
+
+func caller(t *testing.T, c contract) string {
+	if c.admin {
+		return idToken(t, "admin-1", env.EnvVars.AuthAdminRole)
+	}
+	return idToken(t, "user-1", "")
+}
+
+// TestContractsCoverServer check that every function the local server validates is covered by the contracts
+func TestContractsCoverServer(t *testing.T) {
+	src, err := ioutil.ReadFile("../cmd/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	covered := map[string]bool{}
+	for _, c := range contracts() {
+		if !Documented(c.path) {
+			t.Errorf("%s is missing from the specification", c.path)
+		}
+		covered[c.path] = true
+	}
+	registered := regexp.MustCompile(`"(/\w+)":\s+functions\.\w+,`).FindAllStringSubmatch(string(src), -1)
+	if len(registered) == 0 {
+		t.Fatal("no function found in cmd/main.go")
+	}
+	for _, m := range registered {
+		if _, event := map[string]bool{"/BtcAccountCreated": true, "/BtcAccountUpdated": true, "/ConvertRequestCreated": true}[m[1]]; event {
+			continue
+		}
+		if !covered[m[1]] {
+			t.Errorf("%s has no contract", m[1])
+		}
+	}
+}
+
+func TestContractRequests(t *testing.T) {
+	for _, c := range contracts() {
+		t.Run(c.path, func(t *testing.T) {
+			if c.body == "" {
+				if lookup(spec, "paths", c.path, "post", "requestBody") != nil {
+					t.Fatal("documented request body of a function taking none")
+				}
+				return
+			}
+			schema := lookup(spec, "paths", c.path, "post", "requestBody", "content", "application/json", "schema")
+			if schema == nil {
+				t.Fatal("no request body in the specification")
+			}
+			var v interface{}
+			if err := json.Unmarshal([]byte(c.body), &v); err != nil {
+				t.Fatal(err)
+			}
+			if err := validate(schema, v, "$"); err != nil {
+				t.Fatalf("request body out of the specification: %v", err)
+			}
+		})
+	}
+}
+
+func TestContractResponses(t *testing.T) {
+	for _, c := range contracts() {
+		t.Run(c.path, func(t *testing.T) {
+			w := call(c, caller(t, c), c.body, func(t *auth.Token) (interface{}, *utils.ErrorService) {
+				return c.rsp, nil
+			})
+			if w.Code != 200 {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if err := ValidateResponse(c.path, w.Code, w.Body.Bytes()); err != nil {
+				t.Fatalf("response out of the specification: %v\n%s", err, w.Body)
+			}
+		})
+	}
+}
+
+func TestContractErrors(t *testing.T) {
+	failing := func(code int) handler {
+		return func(t *auth.Token) (interface{}, *utils.ErrorService) {
+			return nil, &utils.ErrorService{Code: code, Err: errors.New("failed")}
+		}
+	}
+	panicking := func(t *auth.Token) (interface{}, *utils.ErrorService) {
+		panic("nil store")
+	}
+
+	for _, c := range contracts() {
+		t.Run(c.path, func(t *testing.T) {
+			tests := []struct {
+				name  string
+				token string
+				body  string
+				h     handler
+				code  int
+				want  string
+			}{
+				{"no token", "", c.body, failing(500), 401, utils.CodeUnauthenticated},
+				{"invalid token", "not-a-token", c.body, failing(500), 401, utils.CodeUnauthenticated},
+				{"malformed body", caller(t, c), "{", failing(500), 400, utils.CodeInvalidArgument},
+				{"not found", caller(t, c), c.body, failing(404), 404, utils.CodeNotFound},
+				{"conflict", caller(t, c), c.body, failing(409), 409, utils.CodeConflict},
+				{"provider error", caller(t, c), c.body, failing(502), 502, utils.CodeProviderError},
+				{"panic", caller(t, c), c.body, panicking, 500, utils.CodeInternal},
+			}
+			if c.admin {
+				tests = append(tests, struct {
+					name  string
+					token string
+					body  string
+					h     handler
+					code  int
+					want  string
+				}{"user on admin function", idToken(t, "user-1", ""), c.body, failing(500), 403, utils.CodePermissionDenied})
+			}
+			for _, tt := range tests {
+				w := call(c, tt.token, tt.body, tt.h)
+				if w.Code != tt.code {
+					t.Fatalf("%s: status %d, want %d: %s", tt.name, w.Code, tt.code, w.Body)
+				}
+				if err := ValidateResponse(c.path, w.Code, w.Body.Bytes()); err != nil {
+					t.Fatalf("%s: error out of the specification: %v\n%s", tt.name, err, w.Body)
+				}
+				var envelope utils.ErrorEnvelope
+				if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+					t.Fatal(err)
+				}
+				if envelope.Code != tt.want || envelope.Error == "" {
+					t.Fatalf("%s: envelope %+v, want code %s", tt.name, envelope, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateResponseViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+		err    string
+	}{
+		{"undocumented property", "/SyncBtcBalance", 200, `{"uid":"u","address":"a","BTC":1,"secret":"s"}`, "undocumented property secret"},
+		{"missing required property", "/SyncBtcBalance", 200, `{"uid":"u","BTC":1}`, "required property address"},
+		{"wrong type", "/SyncBtcBalance", 200, `{"uid":"u","address":"a","BTC":"1"}`, "$.BTC is not of type number"},
+		{"out of enum", "/SyncBtcBalance", 200, `{"uid":"u","address":"a","BTC":1,"status":"deleted"}`, "out of its enum"},
+		{"unknown error code", "/SyncBtcBalance", 500, `{"error":"e","code":"oops"}`, "out of its enum"},
+		{"additional property of the wrong type", "/GetBalanceHistory", 200, `{"uid":"u","granularity":"daily","points":[{"time":"t","height":1,"BTC":1,"values":{"USD":"1"}}]}`, "$.points[0].values.USD is not of type number"},
+		{"not json", "/SyncBtcBalance", 200, `<html>`, "body is not json"},
+		{"undocumented function", "/DropDatabase", 200, `{}`, "not in the specification"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateResponse(tt.path, tt.status, []byte(tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed" // the specification is embedded in the binary
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Spec OpenAPI 3 specification of the HTTP functions
+//go:embed openapi.json
+var Spec []byte
+
+var spec map[string]interface{}
+
+func init() {
+	if err := json.Unmarshal(Spec, &spec); err != nil {
+		panic(fmt.Sprintf("invalid openapi specification: %v", err))
+	}
+}
+
+// ServeSpec HTTP handler serving the specification
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	w.Write(Spec)
+}
+
+// recorder response writer keeping a copy of the response
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = 200
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Contract wrap the HTTP function served at path so that every response is validated against the specification,
+// contract violations are logged
+func Contract(path string, h func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &recorder{ResponseWriter: w}
+		h(rec, r)
+		if err := ValidateResponse(path, rec.status, rec.body.Bytes()); err != nil {
+			log.Printf("contract violation on %s: %v", path, err)
+		}
+	}
+}
+
+// Documented whether the function served at path is described by the specification
+func Documented(path string) bool {
+	return lookup(spec, "paths", path, "post") != nil
+}
+
+// ValidateResponse validate the json body of a response of the function served at path against the specification
+func ValidateResponse(path string, status int, body []byte) error {
+	op, ok := lookup(spec, "paths", path, "post").(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s is not in the specification", path)
+	}
+	responses, _ := op["responses"].(map[string]interface{})
+	rsp, ok := responses[strconv.Itoa(status)]
+	if !ok {
+		rsp = responses["default"]
+	}
+	schema := lookup(resolve(rsp), "content", "application/json", "schema")
+	if schema == nil {
+		return fmt.Errorf("no schema for status %d", status)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("body is not json: %v", err)
+	}
+	return validate(schema, v, "$")
+}
+
+func lookup(v interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		m, ok := resolve(v).(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return resolve(v)
+}
+
+// resolve follow local $ref references
+func resolve(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return v
+	}
+	return lookup(spec, strings.Split(strings.TrimPrefix(ref, "#/"), "/")...)
+}
+
+func validate(s interface{}, v interface{}, at string) error {
+	schema, ok := resolve(s).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if v == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		return fmt.Errorf("%s is null", at)
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, o := range oneOf {
+			if validate(o, v, at) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s matches %d schemas of oneOf", at, matches)
+		}
+		return nil
+	}
+
+	if err := validateType(schema, v, at); err != nil {
+		return err
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if e == v {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s has value %v out of its enum", at, v)
+		}
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		required, _ := schema["required"].([]interface{})
+		for _, r := range required {
+			if _, ok := value[r.(string)]; !ok {
+				return fmt.Errorf("%s misses required property %s", at, r)
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for k, p := range value {
+			ps, ok := props[k]
+			if !ok && additional != nil {
+				ps, ok = additional, true
+			}
+			if !ok {
+				return fmt.Errorf("%s has undocumented property %s", at, k)
+			}
+			if err := validate(ps, p, at+"."+k); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			if err := validate(schema["items"], item, at+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateType(schema map[string]interface{}, v interface{}, at string) error {
+	t, _ := schema["type"].(string)
+	ok := true
+	switch t {
+	case "object":
+		_, ok = v.(map[string]interface{})
+	case "array":
+		_, ok = v.([]interface{})
+	case "string":
+		_, ok = v.(string)
+	case "boolean":
+		_, ok = v.(bool)
+	case "number":
+		_, ok = v.(float64)
+	case "integer":
+		f, isNumber := v.(float64)
+		ok = isNumber && f == float64(int64(f))
+	}
+	if !ok {
+		return fmt.Errorf("%s is not of type %s", at, t)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+)
+
+// Publisher interface of the brokers the outbox events are relayed to. Messages of the same ordering key must be
+// delivered in the order they are published
+type Publisher interface {
+	Publish(topic, orderingKey string, data []byte, attrs map[string]string) error
+}
+
+// Relay publisher the outbox is relayed through
+var Relay Publisher
+
+// InitRelay initialize the publisher the outbox is relayed through
+func InitRelay(p Publisher) {
+	Relay = p
+}
+
+// PubSubPublisher publisher of Cloud Pub/Sub messages, the emulator is used if PUBSUB_EMULATOR_HOST is set
+type PubSubPublisher struct {
+	client *pubsub.Client
+	ctx    context.Context
+	prefix string
+	mu     sync.Mutex
+	topics map[string]*pubsub.Topic
+}
+
+// NewPubSubPublisher create a publisher to the topics of a project, topics are named after the event types
+// prefixed with prefix
+func NewPubSubPublisher(projectID, keypath, prefix string) (*PubSubPublisher, error) {
+	ctx := context.Background()
+	var opts []option.ClientOption
+	if keypath != "" {
+		opts = append(opts, option.WithCredentialsFile(keypath))
+	}
+	client, err := pubsub.NewClient(ctx, projectID, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PubSubPublisher{
+		client: client,
+		ctx:    ctx,
+		prefix: prefix,
+		topics: make(map[string]*pubsub.Topic),
+	}, nil
+}
+
+// Publish publish a message and wait for the broker to acknowledge it
+func (p *PubSubPublisher) Publish(topic, orderingKey string, data []byte, attrs map[string]string) error {
+	t := p.topic(topic)
+	_, err := t.Publish(p.ctx, &pubsub.Message{Data: data, Attributes: attrs, OrderingKey: orderingKey}).Get(p.ctx)
+	if err != nil {
+		// publishing is paused for a key after a failure, until resumed
+		t.ResumePublish(orderingKey)
+	}
+	return err
+}
+
+func (p *PubSubPublisher) topic(name string) *pubsub.Topic {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.topics[p.prefix+name]
+	if !ok {
+		t = p.client.Topic(p.prefix + name)
+		t.EnableMessageOrdering = true
+		p.topics[p.prefix+name] = t
+	}
+	return t
+}
+
+// Message message published to a MemoryPublisher
+type Message struct {
+	Topic       string
+	OrderingKey string
+	Data        []byte
+	Attributes  map[string]string
+}
+
+// MemoryPublisher publisher keeping the messages in memory, to run locally or in tests
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	Messages []*Message
+}
+
+// Publish append a message to the published messages
+func (m *MemoryPublisher) Publish(topic, orderingKey string, data []byte, attrs map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Messages = append(m.Messages, &Message{Topic: topic, OrderingKey: orderingKey, Data: data, Attributes: attrs})
+	return nil
+}
@@ -0,0 +1,74 @@
+package price
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// Median price source aggregating the rates of several sources: stale rates are ignored, as well as rates deviating
+// from the median of the others by more than MaxDeviation (relative)
+type Median struct {
+	Sources      []PriceSource
+	MaxAge       time.Duration
+	MaxDeviation float64
+	// MinSources minimum number of agreeing sources
+	MinSources int
+}
+
+// NewMedian create a median of the given sources
+func NewMedian(maxAge time.Duration, maxDeviation float64, minSources int, sources ...PriceSource) *Median {
+	return &Median{
+		Sources:      sources,
+		MaxAge:       maxAge,
+		MaxDeviation: maxDeviation,
+		MinSources:   minSources,
+	}
+}
+
+// GetRate get the median of the fresh rates of the sources that agree with each other
+func (m *Median) GetRate(base, quote string) (*Rate, error) {
+	now := time.Now()
+	var values []float64
+	for _, s := range m.Sources {
+		r, err := s.GetRate(base, quote)
+		if err != nil {
+			log.Printf("price source %T: %v", s, err)
+			continue
+		}
+		if now.Sub(r.Time) > m.MaxAge {
+			log.Printf("price source %T: stale %s/%s rate of %s", s, base, quote, r.Time)
+			continue
+		}
+		values = append(values, r.Value)
+	}
+
+	mid := median(values)
+	var agreeing []float64
+	for _, v := range values {
+		if math.Abs(v-mid)/mid <= m.MaxDeviation {
+			agreeing = append(agreeing, v)
+		}
+	}
+	if len(agreeing) == 0 || len(agreeing) < m.MinSources {
+		return nil, fmt.Errorf("%w: %d of %d sources agree on %s/%s", ErrNoRate, len(agreeing), len(m.Sources), base, quote)
+	}
+
+	return &Rate{Base: base, Quote: quote, Value: median(agreeing), Time: now}, nil
+}
+
+// median median of values, 0 if there is none
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), values...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
@@ -0,0 +1,88 @@
+package price
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// staticSource price source returning a fixed rate, or an error
+type staticSource struct {
+	value float64
+	age   time.Duration
+	err   error
+}
+
+func (s *staticSource) GetRate(base, quote string) (*Rate, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &Rate{Base: base, Quote: quote, Value: s.value, Time: time.Now().Add(-s.age)}, nil
+}
+
+func TestMedianValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"none", nil, 0},
+		{"one", []float64{3}, 3},
+		{"odd", []float64{5, 1, 3}, 3},
+		{"even", []float64{4, 1, 3, 2}, 2.5},
+		{"duplicates", []float64{2, 2, 9}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := append([]float64(nil), tt.values...)
+			if got := median(values); got != tt.want {
+				t.Fatalf("median = %v, want %v", got, tt.want)
+			}
+			for i := range values {
+				if values[i] != tt.values[i] {
+					t.Fatal("median sorted its input")
+				}
+			}
+		})
+	}
+}
+
+func TestMedianGetRate(t *testing.T) {
+	down := errors.New("unavailable")
+	tests := []struct {
+		name       string
+		sources    []PriceSource
+		minSources int
+		want       float64
+		err        bool
+	}{
+		{"agreeing sources", []PriceSource{&staticSource{value: 100}, &staticSource{value: 102}, &staticSource{value: 101}}, 2, 101, false},
+		{"even number of sources", []PriceSource{&staticSource{value: 100}, &staticSource{value: 102}}, 2, 101, false},
+		{"outlier ignored", []PriceSource{&staticSource{value: 100}, &staticSource{value: 101}, &staticSource{value: 150}}, 2, 100.5, false},
+		{"low outlier ignored", []PriceSource{&staticSource{value: 1}, &staticSource{value: 100}, &staticSource{value: 101}}, 2, 100.5, false},
+		{"failing source ignored", []PriceSource{&staticSource{err: down}, &staticSource{value: 100}, &staticSource{value: 102}}, 2, 101, false},
+		{"stale source ignored", []PriceSource{&staticSource{value: 50, age: time.Hour}, &staticSource{value: 100}, &staticSource{value: 102}}, 2, 101, false},
+		{"too few fresh sources", []PriceSource{&staticSource{value: 100, age: time.Hour}, &staticSource{err: down}, &staticSource{value: 102}}, 2, 0, true},
+		{"too few agreeing sources", []PriceSource{&staticSource{value: 100}, &staticSource{value: 200}}, 2, 0, true},
+		{"every source failing", []PriceSource{&staticSource{err: down}, &staticSource{err: down}}, 1, 0, true},
+		{"no sources", nil, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMedian(time.Minute, 0.05, tt.minSources, tt.sources...)
+			r, err := m.GetRate("BTC", "USD")
+			if tt.err {
+				if !errors.Is(err, ErrNoRate) {
+					t.Fatalf("error = %v, want ErrNoRate", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Value != tt.want || r.Base != "BTC" || r.Quote != "USD" {
+				t.Fatalf("rate = %+v, want %v BTC/USD", r, tt.want)
+			}
+		})
+	}
+}
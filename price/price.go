@@ -0,0 +1,59 @@
+package price
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoRate no exchange rate is available for a currency pair
+var ErrNoRate = errors.New("no exchange rate available")
+
+// Rate exchange rate of a currency pair, Value units of Quote for one Base
+type Rate struct {
+	Base  string    `firestore:"base" json:"base"`
+	Quote string    `firestore:"quote" json:"quote"`
+	Value float64   `firestore:"value" json:"value"`
+	Time  time.Time `firestore:"time" json:"time"`
+}
+
+// PriceSource interface of the providers of exchange rates
+type PriceSource interface {
+	GetRate(base, quote string) (*Rate, error)
+}
+
+// Oracle source of the exchange rates used by the service
+var Oracle PriceSource
+
+// InitOracle initialize the source of the exchange rates, rates are unavailable while s is nil
+func InitOracle(s PriceSource) {
+	Oracle = s
+}
+
+// GetRate get the current exchange rate of a currency pair from the oracle
+func GetRate(base, quote string) (*Rate, error) {
+	if Oracle == nil {
+		return nil, ErrNoRate
+	}
+	return Oracle.GetRate(base, quote)
+}
+
+// HistoricalSource interface of the providers of past exchange rates
+type HistoricalSource interface {
+	GetHistoricalRate(base, quote string, t time.Time) (*Rate, error)
+}
+
+// History source of the past exchange rates used by the service
+var History HistoricalSource
+
+// InitHistory initialize the source of the past exchange rates, they are unavailable while h is nil
+func InitHistory(h HistoricalSource) {
+	History = h
+}
+
+// GetHistoricalRate get the exchange rate of a currency pair at a given time from the history source
+func GetHistoricalRate(base, quote string, t time.Time) (*Rate, error) {
+	if History == nil {
+		return nil, ErrNoRate
+	}
+	return History.GetHistoricalRate(base, quote, t)
+}
@@ -0,0 +1,72 @@
+package reserves
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Signer key signing the reserve reports, nil if none is configured
+var Signer ed25519.PrivateKey
+
+// ErrNoSigner no key is configured to sign the reports
+var ErrNoSigner = errors.New("no reserves signing key")
+
+// InitSigner initialize Signer from the hex encoded ed25519 seed, left nil if seed is empty
+func InitSigner(seed string) error {
+	if seed == "" {
+		return nil
+	}
+	b, err := hex.DecodeString(seed)
+	if err != nil {
+		return err
+	}
+	if len(b) != ed25519.SeedSize {
+		return fmt.Errorf("signing key must be a %d bytes seed", ed25519.SeedSize)
+	}
+	Signer = ed25519.NewKeyFromSeed(b)
+	return nil
+}
+
+// Statement what a report attests: at the block of the given height and hash, the liabilities summed by the tree of
+// root don't exceed the assets held by the addresses, amounts in satoshis
+type Statement struct {
+	Height      int
+	BlockHash   string
+	Root        string
+	Liabilities int64
+	Assets      int64
+	Accounts    int
+	Addresses   int
+	Time        time.Time
+}
+
+// Message canonical message of the statement, which is signed
+func (s *Statement) Message() []byte {
+	return []byte(fmt.Sprintf("soteria proof of reserves v1\nheight:%d\nblock:%s\nroot:%s\nliabilities:%d\nassets:%d\naccounts:%d\naddresses:%d\ntime:%d",
+		s.Height, s.BlockHash, s.Root, s.Liabilities, s.Assets, s.Accounts, s.Addresses, s.Time.Unix()))
+}
+
+// Sign sign the statement with Signer, return the hex public key and signature
+func Sign(s *Statement) (publicKey, signature string, err error) {
+	if Signer == nil {
+		return "", "", ErrNoSigner
+	}
+	pub := Signer.Public().(ed25519.PublicKey)
+	return hex.EncodeToString(pub), hex.EncodeToString(ed25519.Sign(Signer, s.Message())), nil
+}
+
+// VerifySignature whether signature is a signature of the statement by publicKey, both hex encoded
+func VerifySignature(s *Statement, publicKey, signature string) bool {
+	pub, err := hex.DecodeString(publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, s.Message(), sig)
+}
@@ -0,0 +1,156 @@
+package reserves
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sort"
+)
+
+// Domain prefixes of the hashes, so that a leaf can't be passed off as a node
+const (
+	leafPrefix byte = 0
+	nodePrefix byte = 1
+)
+
+// ErrNegativeBalance balances of the tree must not be negative, they would hide liabilities
+var ErrNegativeBalance = errors.New("negative balance")
+
+// Leaf liability of an account, its nonce keeps the uid from being guessed from the leaf hash
+type Leaf struct {
+	UID     string
+	Nonce   string
+	Balance int64
+}
+
+// Hash hash of the leaf, committing to its uid and balance
+func (l *Leaf) Hash() []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write([]byte(l.Nonce))
+	h.Write([]byte(l.UID))
+	writeSum(h, l.Balance)
+	return h.Sum(nil)
+}
+
+// Node node of a merkle sum tree: its sum is the sum of its children, its hash commits to both their hashes and sums
+type Node struct {
+	Hash []byte
+	Sum  int64
+}
+
+func parent(left, right *Node) *Node {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left.Hash)
+	writeSum(h, left.Sum)
+	h.Write(right.Hash)
+	writeSum(h, right.Sum)
+	return &Node{Hash: h.Sum(nil), Sum: left.Sum + right.Sum}
+}
+
+func writeSum(w interface{ Write([]byte) (int, error) }, sum int64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(sum))
+	w.Write(b)
+}
+
+// Step sibling of a node on the path from a leaf to the root, Left if the sibling is on the left
+type Step struct {
+	Hash string `firestore:"hash" json:"hash"`
+	Sum  int64  `firestore:"sum" json:"sum"`
+	Left bool   `firestore:"left" json:"left"`
+}
+
+// Tree merkle sum tree of liabilities, the sum of its root is the total of the balances
+type Tree struct {
+	Leaves []*Leaf
+	levels [][]*Node
+}
+
+// NewTree build the tree of the given balances in satoshis by uid, each leaf getting a random nonce. Leaves are
+// ordered by uid
+func NewTree(balances map[string]int64) (*Tree, error) {
+	leaves := make([]*Leaf, 0, len(balances))
+	for uid, bal := range balances {
+		if bal < 0 {
+			return nil, ErrNegativeBalance
+		}
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, &Leaf{UID: uid, Nonce: hex.EncodeToString(nonce), Balance: bal})
+	}
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].UID < leaves[j].UID })
+	return Build(leaves), nil
+}
+
+// Build build the tree of the given leaves. A node without sibling is carried up to the next level, so that no
+// balance is counted twice
+func Build(leaves []*Leaf) *Tree {
+	level := make([]*Node, len(leaves))
+	for i, l := range leaves {
+		level[i] = &Node{Hash: l.Hash(), Sum: l.Balance}
+	}
+	t := &Tree{Leaves: leaves, levels: [][]*Node{level}}
+	for len(level) > 1 {
+		next := make([]*Node, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, parent(level[i], level[i+1]))
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t
+}
+
+// Root root of the tree, a zero node if it has no leaves
+func (t *Tree) Root() *Node {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return &Node{Hash: make([]byte, sha256.Size)}
+	}
+	return top[0]
+}
+
+// Proof path of the i-th leaf to the root
+func (t *Tree) Proof(i int) []*Step {
+	steps := []*Step{}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := i ^ 1
+		if sibling < len(level) {
+			steps = append(steps, &Step{Hash: hex.EncodeToString(level[sibling].Hash), Sum: level[sibling].Sum, Left: sibling < i})
+		}
+		i /= 2
+	}
+	return steps
+}
+
+// Verify whether the path of a leaf leads to the root
+func Verify(root *Node, l *Leaf, steps []*Step) bool {
+	if l.Balance < 0 {
+		return false
+	}
+	n := &Node{Hash: l.Hash(), Sum: l.Balance}
+	for _, s := range steps {
+		h, err := hex.DecodeString(s.Hash)
+		if err != nil || s.Sum < 0 {
+			return false
+		}
+		sibling := &Node{Hash: h, Sum: s.Sum}
+		if s.Left {
+			n = parent(sibling, n)
+		} else {
+			n = parent(n, sibling)
+		}
+	}
+	return n.Sum == root.Sum && bytes.Equal(n.Hash, root.Hash)
+}
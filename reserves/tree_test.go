@@ -0,0 +1,118 @@
+package reserves
+
+import (
+	"strconv"
+	"testing"
+)
+
+func testLeaves(n int) []*Leaf {
+	leaves := make([]*Leaf, n)
+	for i := range leaves {
+		leaves[i] = &Leaf{UID: "user-" + strconv.Itoa(i), Nonce: "nonce-" + strconv.Itoa(i), Balance: int64(1000 * (i + 1))}
+	}
+	return leaves
+}
+
+func TestBuildProofs(t *testing.T) {
+	// odd counts carry a node without sibling up, it must be counted once
+	for n := 1; n <= 9; n++ {
+		leaves := testLeaves(n)
+		tree := Build(leaves)
+		root := tree.Root()
+
+		var total int64
+		for _, l := range leaves {
+			total += l.Balance
+		}
+		if root.Sum != total {
+			t.Fatalf("%d leaves: root sum = %d, want %d", n, root.Sum, total)
+		}
+		for i, l := range leaves {
+			if !Verify(root, l, tree.Proof(i)) {
+				t.Fatalf("%d leaves: the proof of leaf %d doesn't verify", n, i)
+			}
+		}
+	}
+}
+
+func TestBuildEmpty(t *testing.T) {
+	root := Build(nil).Root()
+	if root.Sum != 0 || len(root.Hash) != 32 {
+		t.Fatalf("root of an empty tree = %+v", root)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	leaves := testLeaves(5)
+	tree := Build(leaves)
+	root := tree.Root()
+
+	tests := []struct {
+		name   string
+		tamper func(l *Leaf, steps []*Step) *Node
+	}{
+		{"leaf balance", func(l *Leaf, steps []*Step) *Node {
+			l.Balance--
+			return root
+		}},
+		{"leaf uid", func(l *Leaf, steps []*Step) *Node {
+			l.UID = "user-4"
+			return root
+		}},
+		{"leaf nonce", func(l *Leaf, steps []*Step) *Node {
+			l.Nonce = "other"
+			return root
+		}},
+		{"sibling sum", func(l *Leaf, steps []*Step) *Node {
+			steps[0].Sum -= 500
+			return root
+		}},
+		{"negative sibling sum", func(l *Leaf, steps []*Step) *Node {
+			// shifting a balance to a negative sibling keeps the total, it must be refused
+			steps[0].Sum = -steps[0].Sum
+			l.Balance += 2 * tree.levels[0][3].Sum
+			return root
+		}},
+		{"sibling side", func(l *Leaf, steps []*Step) *Node {
+			steps[1].Left = !steps[1].Left
+			return root
+		}},
+		{"sibling hash", func(l *Leaf, steps []*Step) *Node {
+			steps[0].Hash = "zz"
+			return root
+		}},
+		{"root sum", func(l *Leaf, steps []*Step) *Node {
+			return &Node{Hash: root.Hash, Sum: root.Sum + 1}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := *leaves[2]
+			steps := tree.Proof(2)
+			for i, s := range steps {
+				c := *s
+				steps[i] = &c
+			}
+			if Verify(tt.tamper(&l, steps), &l, steps) {
+				t.Fatal("verified a tampered proof")
+			}
+		})
+	}
+}
+
+func TestNewTree(t *testing.T) {
+	tree, err := NewTree(map[string]int64{"b": 2000, "a": 1000, "c": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Leaves[0].UID != "a" || tree.Leaves[2].UID != "c" || tree.Root().Sum != 3000 {
+		t.Fatalf("tree of %+v, root %+v", tree.Leaves, tree.Root())
+	}
+	if tree.Leaves[0].Nonce == "" || tree.Leaves[0].Nonce == tree.Leaves[1].Nonce {
+		t.Fatal("leaves don't have random nonces")
+	}
+
+	if _, err := NewTree(map[string]int64{"a": 1000, "b": -1}); err != ErrNegativeBalance {
+		t.Fatalf("error = %v, want ErrNegativeBalance", err)
+	}
+}
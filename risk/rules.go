@@ -0,0 +1,175 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Actions taken on a deposit, from the least to the most severe
+const (
+	ActionCredit = "credit"
+	ActionHold   = "hold"
+	ActionReview = "review"
+)
+
+// Types of rules
+const (
+	// RuleAmount deposits of at least Threshold satoshis
+	RuleAmount = "amount"
+	// RuleVelocity deposits taking the amount received by their user over the window to at least Threshold satoshis
+	RuleVelocity = "velocity"
+	// RuleNewSender deposits spending from an address their user never received from
+	RuleNewSender = "new_sender"
+	// RuleCoinjoin deposits of transactions with at least Threshold outputs of a same value
+	RuleCoinjoin = "coinjoin"
+	// RuleRBF deposits of transactions signaling replace-by-fee
+	RuleRBF = "rbf"
+)
+
+var severity = map[string]int{ActionCredit: 0, ActionHold: 1, ActionReview: 2}
+
+// Rules rules evaluated on the detected deposits, crediting every deposit if none is configured
+var Rules = &Config{}
+
+// Rule rule adding its score to the deposits it matches, and requiring its action
+type Rule struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Threshold int64  `json:"threshold"`
+	Score     int    `json:"score"`
+	Action    string `json:"action"`
+	// Confirmations extra confirmations required by a hold action
+	Confirmations int `json:"confirmations"`
+}
+
+// Config rules and the scores from which deposits are held for HoldConfirmations extra confirmations or reviewed,
+// 0 if the score alone never holds or reviews
+type Config struct {
+	Rules             []*Rule `json:"rules"`
+	HoldScore         int     `json:"hold_score"`
+	HoldConfirmations int     `json:"hold_confirmations"`
+	ReviewScore       int     `json:"review_score"`
+}
+
+// Deposit facts a deposit is evaluated on, amounts in satoshis
+type Deposit struct {
+	Amount int64
+	// Velocity amount received by the user over the window, before this deposit
+	Velocity     int64
+	NewSender    bool
+	EqualOutputs int
+	RBF          bool
+}
+
+// Outcome score of a deposit, the names of the rules it matched and the action they require
+type Outcome struct {
+	Score         int      `firestore:"score" json:"score"`
+	Rules         []string `firestore:"rules" json:"rules"`
+	Action        string   `firestore:"action" json:"action"`
+	Confirmations int      `firestore:"confirmations" json:"confirmations"`
+}
+
+// InitRules load Rules from a JSON file, left empty if path is empty
+func InitRules(path string) error {
+	if path == "" {
+		return nil
+	}
+	c, err := Load(path)
+	if err != nil {
+		return err
+	}
+	Rules = c
+	return nil
+}
+
+// Load read and validate the rules of a JSON file
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c *Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate check the types and the actions of the rules
+func (c *Config) Validate() error {
+	for i, r := range c.Rules {
+		switch r.Type {
+		case RuleAmount, RuleVelocity, RuleCoinjoin:
+			if r.Threshold <= 0 {
+				return fmt.Errorf("rule %d: %s rules need a positive threshold", i, r.Type)
+			}
+		case RuleNewSender, RuleRBF:
+		default:
+			return fmt.Errorf("rule %d: unknown type %s", i, r.Type)
+		}
+		if r.Action == "" {
+			r.Action = ActionCredit
+		}
+		if _, ok := severity[r.Action]; !ok {
+			return fmt.Errorf("rule %d: unknown action %s", i, r.Action)
+		}
+		if r.Name == "" {
+			r.Name = r.Type
+		}
+	}
+	return nil
+}
+
+// Evaluate score a deposit with the rules
+func (c *Config) Evaluate(d *Deposit) *Outcome {
+	o := &Outcome{Rules: []string{}, Action: ActionCredit}
+	for _, r := range c.Rules {
+		if !r.matches(d) {
+			continue
+		}
+		o.Score += r.Score
+		o.Rules = append(o.Rules, r.Name)
+		o.require(r.Action, r.Confirmations)
+	}
+
+	if c.ReviewScore > 0 && o.Score >= c.ReviewScore {
+		o.require(ActionReview, 0)
+	}
+	if c.HoldScore > 0 && o.Score >= c.HoldScore {
+		o.require(ActionHold, c.HoldConfirmations)
+	}
+	if o.Action != ActionHold {
+		o.Confirmations = 0
+	}
+	return o
+}
+
+// require escalate the outcome to an action, holds keep the largest number of extra confirmations required
+func (o *Outcome) require(action string, confirmations int) {
+	if severity[action] > severity[o.Action] {
+		o.Action = action
+	}
+	if action == ActionHold && confirmations > o.Confirmations {
+		o.Confirmations = confirmations
+	}
+}
+
+func (r *Rule) matches(d *Deposit) bool {
+	switch r.Type {
+	case RuleAmount:
+		return d.Amount >= r.Threshold
+	case RuleVelocity:
+		return d.Velocity+d.Amount >= r.Threshold
+	case RuleNewSender:
+		return d.NewSender
+	case RuleCoinjoin:
+		return int64(d.EqualOutputs) >= r.Threshold
+	case RuleRBF:
+		return d.RBF
+	}
+	return false
+}
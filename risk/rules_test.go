@@ -0,0 +1,112 @@
+package risk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	c := &Config{
+		Rules: []*Rule{
+			{Name: "large", Type: RuleAmount, Threshold: 1000000, Score: 40, Action: ActionHold, Confirmations: 3},
+			{Name: "fast", Type: RuleVelocity, Threshold: 5000000, Score: 30, Action: ActionHold, Confirmations: 6},
+			{Name: "new", Type: RuleNewSender, Score: 10, Action: ActionCredit},
+			{Name: "mixer", Type: RuleCoinjoin, Threshold: 5, Score: 50, Action: ActionReview},
+			{Name: "rbf", Type: RuleRBF, Score: 20, Action: ActionHold, Confirmations: 1},
+		},
+		HoldScore:         25,
+		HoldConfirmations: 2,
+		ReviewScore:       90,
+	}
+
+	tests := []struct {
+		name          string
+		deposit       *Deposit
+		score         int
+		rules         []string
+		action        string
+		confirmations int
+	}{
+		{"nothing matches", &Deposit{Amount: 1000}, 0, []string{}, ActionCredit, 0},
+		{"score below the hold score", &Deposit{Amount: 1000, NewSender: true}, 10, []string{"new"}, ActionCredit, 0},
+		{"hold score", &Deposit{Amount: 1000, NewSender: true, RBF: true}, 30, []string{"new", "rbf"}, ActionHold, 2},
+		{"rule hold", &Deposit{Amount: 1000000}, 40, []string{"large"}, ActionHold, 3},
+		{"review score", &Deposit{Amount: 1000000, Velocity: 4000000, RBF: true}, 90, []string{"large", "fast", "rbf"}, ActionReview, 0},
+		// holds keep the largest number of confirmations of the rules and the hold score
+		{"largest confirmations", &Deposit{Amount: 1000000, Velocity: 4000000}, 70, []string{"large", "fast"}, ActionHold, 6},
+		{"velocity includes the deposit", &Deposit{Amount: 10, Velocity: 4999990}, 30, []string{"fast"}, ActionHold, 6},
+		// review is more severe than hold and drops the confirmations
+		{"rule review", &Deposit{Amount: 1000, EqualOutputs: 5}, 50, []string{"mixer"}, ActionReview, 0},
+		{"review over hold", &Deposit{Amount: 1000000, EqualOutputs: 7}, 90, []string{"large", "mixer"}, ActionReview, 0},
+		{"coinjoin below threshold", &Deposit{Amount: 1000, EqualOutputs: 4}, 0, []string{}, ActionCredit, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := c.Evaluate(tt.deposit)
+			if o.Score != tt.score || fmt.Sprint(o.Rules) != fmt.Sprint(tt.rules) || o.Action != tt.action || o.Confirmations != tt.confirmations {
+				t.Fatalf("outcome = %+v, want score %d, rules %v, %s with %d confirmations", o, tt.score, tt.rules, tt.action, tt.confirmations)
+			}
+		})
+	}
+}
+
+func TestEvaluateWithoutScores(t *testing.T) {
+	// scores alone never hold nor review when the thresholds are 0
+	c := &Config{Rules: []*Rule{{Name: "new", Type: RuleNewSender, Score: 1000, Action: ActionCredit}}}
+	if o := c.Evaluate(&Deposit{NewSender: true}); o.Action != ActionCredit || o.Score != 1000 {
+		t.Fatalf("outcome = %+v", o)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []*Rule
+		valid bool
+	}{
+		{"defaults", []*Rule{{Type: RuleRBF}}, true},
+		{"unknown type", []*Rule{{Type: "dust"}}, false},
+		{"amount without threshold", []*Rule{{Type: RuleAmount}}, false},
+		{"velocity without threshold", []*Rule{{Type: RuleVelocity, Threshold: -1}}, false},
+		{"coinjoin without threshold", []*Rule{{Type: RuleCoinjoin}}, false},
+		{"unknown action", []*Rule{{Type: RuleNewSender, Action: "block"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Rules: tt.rules}
+			if err := c.Validate(); (err == nil) != tt.valid {
+				t.Fatalf("error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+
+	c := &Config{Rules: []*Rule{{Type: RuleRBF}}}
+	c.Validate()
+	if c.Rules[0].Name != RuleRBF || c.Rules[0].Action != ActionCredit {
+		t.Fatalf("rule without name nor action = %+v", c.Rules[0])
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "rules.json")
+	ioutil.WriteFile(valid, []byte(`{"rules":[{"type":"amount","threshold":100,"score":10,"action":"review"}],"hold_score":5}`), 0600)
+	invalid := filepath.Join(dir, "invalid.json")
+	ioutil.WriteFile(invalid, []byte(`{"rules":[{"type":"amount"}]}`), 0600)
+
+	c, err := Load(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Rules) != 1 || c.Rules[0].Action != ActionReview || c.HoldScore != 5 {
+		t.Fatalf("config = %+v", c)
+	}
+	if _, err := Load(invalid); err == nil {
+		t.Fatal("loaded a rule without threshold")
+	}
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("loaded a missing file")
+	}
+}
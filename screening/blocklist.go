@@ -0,0 +1,136 @@
+package screening
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Blocklist addresses screened out of deposits and withdrawals, empty if no list is configured
+var Blocklist = &List{set: map[string]string{}}
+
+// List set of blocklisted addresses, each with the source it was listed by
+type List struct {
+	set map[string]string
+}
+
+// entry address of a JSON list given as an object, eg. {"address": "bc1...", "source": "OFAC SDN"}
+type entry struct {
+	Address string `json:"address"`
+	Source  string `json:"source"`
+}
+
+// InitBlocklist load Blocklist from a file, left empty if path is empty
+func InitBlocklist(path string) error {
+	if path == "" {
+		return nil
+	}
+	l, err := Load(path)
+	if err != nil {
+		return err
+	}
+	Blocklist = l
+	return nil
+}
+
+// Load read a list of addresses from a JSON file, an array of addresses or of entries, or from a CSV file, whose
+// address column is the one named "address" or else the first one
+func Load(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	source := filepath.Base(path)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return readJSON(f, source)
+	}
+	return readCSV(f, source)
+}
+
+func readJSON(r io.Reader, source string) (*List, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	l := &List{set: make(map[string]string, len(raw))}
+	for i, m := range raw {
+		var addr string
+		if err := json.Unmarshal(m, &addr); err == nil {
+			l.Add(addr, source)
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(m, &e); err != nil || e.Address == "" {
+			return nil, fmt.Errorf("invalid blocklist entry %d", i)
+		}
+		if e.Source == "" {
+			e.Source = source
+		}
+		l.Add(e.Address, e.Source)
+	}
+	return l, nil
+}
+
+func readCSV(r io.Reader, source string) (*List, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty blocklist")
+	}
+
+	col := 0
+	for i, h := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(h), "address") {
+			col = i
+			records = records[1:]
+			break
+		}
+	}
+
+	l := &List{set: make(map[string]string, len(records))}
+	for _, rec := range records {
+		if col < len(rec) {
+			l.Add(rec[col], source)
+		}
+	}
+	return l, nil
+}
+
+// Add add an address to the list
+func (l *List) Add(address, source string) {
+	if a := normalize(address); a != "" {
+		l.set[a] = source
+	}
+}
+
+// Contains whether an address is blocklisted, and by which source
+func (l *List) Contains(address string) (string, bool) {
+	source, ok := l.set[normalize(address)]
+	return source, ok
+}
+
+// Len number of addresses of the list
+func (l *List) Len() int {
+	return len(l.set)
+}
+
+// normalize bech32 addresses are case insensitive and written lowercase, base58 ones are case sensitive
+func normalize(address string) string {
+	a := strings.TrimSpace(address)
+	if lower := strings.ToLower(a); strings.HasPrefix(lower, "bc1") || strings.HasPrefix(lower, "tb1") || strings.HasPrefix(lower, "bcrt1") {
+		return lower
+	}
+	return a
+}
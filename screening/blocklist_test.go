@@ -0,0 +1,111 @@
+package screening
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		listed   map[string]string
+		unlisted []string
+	}{
+		{"csv with header", "sdn.csv", "name,Address\nlazarus,bc1qa5wkgaew2dkv56kfvj49j0av5nml45x9ek9hz6\nlazarus,1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2\n",
+			map[string]string{"bc1qa5wkgaew2dkv56kfvj49j0av5nml45x9ek9hz6": "sdn.csv", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2": "sdn.csv"},
+			[]string{"lazarus", "Address"}},
+		{"csv without header", "list.csv", "# exported list\nbc1qa5wkgaew2dkv56kfvj49j0av5nml45x9ek9hz6,note\n 1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2 \n",
+			map[string]string{"bc1qa5wkgaew2dkv56kfvj49j0av5nml45x9ek9hz6": "list.csv", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2": "list.csv"},
+			[]string{"note", "# exported list"}},
+		{"json addresses", "list.json", `["bc1qa5wkgaew2dkv56kfvj49j0av5nml45x9ek9hz6"]`,
+			map[string]string{"bc1qa5wkgaew2dkv56kfvj49j0av5nml45x9ek9hz6": "list.json"}, nil},
+		{"json entries", "list.JSON", `[{"address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2","source":"OFAC SDN"},{"address":"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"}]`,
+			map[string]string{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2": "OFAC SDN", "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx": "list.JSON"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			l, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.Len() != len(tt.listed) {
+				t.Fatalf("loaded %d addresses, want %d", l.Len(), len(tt.listed))
+			}
+			for address, source := range tt.listed {
+				if got, ok := l.Contains(address); !ok || got != source {
+					t.Fatalf("%s listed by %q (%v), want %q", address, got, ok, source)
+				}
+			}
+			for _, address := range tt.unlisted {
+				if _, ok := l.Contains(address); ok {
+					t.Fatalf("%s is listed", address)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"empty csv", "list.csv", ""},
+		{"malformed json", "list.json", `["bc1q`},
+		{"json entry without address", "list.json", `[{"source":"OFAC"}]`},
+		{"json entry of another type", "list.json", `[42]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Fatal("loaded an invalid list")
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Fatal("loaded a missing file")
+	}
+}
+
+func TestContains(t *testing.T) {
+	l := &List{set: map[string]string{}}
+	l.Add("BC1QA5WKGAEW2DKV56KFVJ49J0AV5NML45X9EK9HZ6", "ofac")
+	l.Add("tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", "ofac")
+	l.Add("1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", "ofac")
+	l.Add("  ", "ofac")
+
+	tests := []struct {
+		address string
+		listed  bool
+	}{
+		// bech32 addresses match whatever their case
+		{"bc1qa5wkgaew2dkv56kfvj49j0av5nml45x9ek9hz6", true},
+		{"BC1QA5WKGAEW2DKV56KFVJ49J0AV5NML45X9EK9HZ6", true},
+		{"TB1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KXPJZSX", true},
+		{" bc1qa5wkgaew2dkv56kfvj49j0av5nml45x9ek9hz6 ", true},
+		// base58 addresses are case sensitive
+		{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", true},
+		{"1bvbmseystwetqtfn5au4m4gfg7xjanvn2", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, ok := l.Contains(tt.address); ok != tt.listed {
+			t.Fatalf("Contains(%q) = %v, want %v", tt.address, ok, tt.listed)
+		}
+	}
+	if l.Len() != 3 {
+		t.Fatalf("list of %d addresses, want 3", l.Len())
+	}
+}
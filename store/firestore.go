@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"math/big"
 	"strconv"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/SoteriaTech/blockchain-functions/btc"
 	"github.com/SoteriaTech/blockchain-functions/env"
+	"github.com/SoteriaTech/blockchain-functions/price"
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
@@ -111,22 +114,31 @@ func (f *FireStoreStore) GetAllAccountAddresses() ([]*BtcAccountSchema, error) {
 	return accs, nil
 }
 
-// GetConvertRequests get all convert requests of a given account
-func (f *FireStoreStore) GetConvertRequests(uid string) (map[string]interface{}, error) {
-	docs := make(map[string]interface{})
-	iter := f.Client.Collection("convert_history").Doc(uid).Collection("history").Documents(f.ctx)
+// FindConvertRequests find the conversion requests of a given account, latest first, starting after the given cursor if any
+func (f *FireStoreStore) FindConvertRequests(uid string, after *ConvertRequestCursor, limit int) (rs []*ConvertRequestSchema, err error) {
+	q := f.convertHistory(uid).OrderBy("created_at", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc)
+	if after != nil {
+		q = q.StartAfter(after.CreatedAt, after.ID)
+	}
+	iter := q.Limit(limit).Documents(f.ctx)
 	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
 			break
 		}
-		if err != nil {
-			return nil, err
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		r, errData := convertRequestFrom(doc)
+		if errData != nil {
+			err = errData
+			return
 		}
-		docs[uid] = doc.Data()
+		rs = append(rs, r)
 	}
 
-	return docs, nil
+	return
 }
 
 // FindBtcTransaction find a btc transaction by hash
@@ -149,7 +161,7 @@ func (f *FireStoreStore) FindBtcTransaction(idx string) (acc *BtcTransactionSche
 
 // CreateBtcTransaction create a btc transaction
 func (f *FireStoreStore) CreateBtcTransaction(t *BtcTransactionSchema) (err error) {
-	_, err = f.Client.Collection("btc_transactions").Doc(t.TxHash+strconv.Itoa(t.VoutIdx)).Set(f.ctx, &t)
+	_, err = f.Client.Collection("btc_transactions").Doc(t.DocID()).Set(f.ctx, &t)
 	return
 }
 
@@ -171,13 +183,28 @@ func (f *FireStoreStore) GetChainState(chain string) (*btc.HeadBlock, error) {
 func (f *FireStoreStore) UpdateChainState(chain string, data *btc.HeadBlock) (err error) {
 	doc := make(map[string]interface{})
 	doc["height"] = data.Height
+	doc["hash"] = data.Hash
 	doc["time"] = data.Time
 	doc["last_updated"] = time.Now()
 	doc["block_index"] = data.BlockIndex
 	doc["tx_indexes"] = data.TxIndexes
 
-	_, err = f.Client.Collection("chain_state").Doc(chain).Set(f.ctx, doc)
-	return
+	e, err := NewOutboxEvent(EventChainHeadAdvanced, chain, &ChainHeadAdvancedData{
+		Chain:  chain,
+		Height: data.Height,
+		Hash:   data.Hash,
+		Time:   data.Time,
+	})
+	if err != nil {
+		return
+	}
+
+	return f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Set(f.Client.Collection("chain_state").Doc(chain), doc); err != nil {
+			return err
+		}
+		return f.appendEvents(tx, e)
+	})
 }
 
 // FindTransactionsFromBlockHeight find transactions that have been recorded from a specific block height
@@ -202,33 +229,2052 @@ func (f *FireStoreStore) FindTransactionsFromBlockHeight(h int) (txs []*BtcTrans
 	return
 }
 
-// UpdateTransactionsConfirmation update confirmation for each given transaction
-func (f *FireStoreStore) UpdateTransactionsConfirmation(txs []*BtcTransactionSchema) (err error) {
-	for _, t := range txs {
-		uid := t.TxHash
-		if t.VoutIdx >= 0 {
-			uid = uid + strconv.Itoa(t.VoutIdx)
+// FindAccountByAddress find a firestore account from an address, through the address index when it is indexed
+func (f *FireStoreStore) FindAccountByAddress(addr string) (a *BtcAccountSchema, err error) {
+	uid, errIdx := f.FindIndexedBtcAddress(addr)
+	if errIdx != nil {
+		err = errIdx
+		return
+	}
+	if uid != "" {
+		return f.FindBtcAccount(uid)
+	}
+
+	doc, errQ := f.Client.Collection("btc_accounts").Where("address", "==", addr).Documents(f.ctx).Next()
+	if errQ != nil {
+		err = errQ
+		return
+	}
+	if doc.Exists() {
+		doc.DataTo(&a)
+		a.UID = doc.Ref.ID
+	}
+	return
+}
+
+// SaveBtcUtxo create an utxo, an utxo already recorded by a previous scan is left untouched so that its spending
+// survives rescans
+func (f *FireStoreStore) SaveBtcUtxo(u *BtcUtxoSchema) (err error) {
+	_, err = f.Client.Collection("btc_utxos").Doc(u.ID()).Create(f.ctx, u)
+	if grpc.Code(err) == codes.AlreadyExists {
+		err = nil
+	}
+	return
+}
+
+// SpendBtcUtxo mark an utxo as spent at a given height, utxos we don't know about are ignored
+func (f *FireStoreStore) SpendBtcUtxo(id string, height int, txHash string) (err error) {
+	_, err = f.Client.Collection("btc_utxos").Doc(id).Update(f.ctx, []firestore.Update{
+		{Path: "spent", Value: true},
+		{Path: "spent_height", Value: height},
+		{Path: "spent_txHash", Value: txHash},
+	})
+	if grpc.Code(err) == codes.NotFound {
+		err = nil
+	}
+	return
+}
+
+// FindBtcUtxos find the unspent outputs of a user UID
+func (f *FireStoreStore) FindBtcUtxos(uid string) (utxos []*BtcUtxoSchema, err error) {
+	iter := f.Client.Collection("btc_utxos").Where("uid", "==", uid).Where("spent", "==", false).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var u *BtcUtxoSchema
+		if err = doc.DataTo(&u); err != nil {
+			return
+		}
+		utxos = append(utxos, u)
+	}
+
+	return
+}
+
+// FindBtcUtxoByOutpoint find an utxo from the hash and the output index of the transaction that created it
+func (f *FireStoreStore) FindBtcUtxoByOutpoint(txHash string, n int) (u *BtcUtxoSchema, err error) {
+	doc, errQ := f.Client.Collection("btc_utxos").Where("txHash", "==", txHash).Where("vout_idx", "==", n).Documents(f.ctx).Next()
+	if errQ == iterator.Done {
+		return
+	}
+	if errQ != nil {
+		err = errQ
+		return
+	}
+	err = doc.DataTo(&u)
+	return
+}
+
+// FindPendingBtcBroadcasts find the broadcast transactions that are not mined yet, dropped ones included
+func (f *FireStoreStore) FindPendingBtcBroadcasts() (bs []*BtcBroadcastSchema, err error) {
+	iter := f.Client.Collection("btc_broadcasts").Where("status", "in", []string{BroadcastPending, BroadcastDropped}).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var b *BtcBroadcastSchema
+		if err = doc.DataTo(&b); err != nil {
+			return
+		}
+		bs = append(bs, b)
+	}
+
+	return
+}
+
+// UpdateBtcBroadcastMined mark a broadcast transaction as mined at the given height
+func (f *FireStoreStore) UpdateBtcBroadcastMined(txHash string, height int) (err error) {
+	_, err = f.Client.Collection("btc_broadcasts").Doc(txHash).Update(f.ctx, []firestore.Update{
+		{Path: "status", Value: BroadcastMined},
+		{Path: "block_height", Value: height},
+	})
+	return
+}
+
+// UpdateBtcBroadcastDropped mark a broadcast transaction as dropped
+func (f *FireStoreStore) UpdateBtcBroadcastDropped(txHash string) (err error) {
+	_, err = f.Client.Collection("btc_broadcasts").Doc(txHash).Update(f.ctx, []firestore.Update{
+		{Path: "status", Value: BroadcastDropped},
+	})
+	return
+}
+
+// SaveBtcBlock record the hash of a scanned block
+func (f *FireStoreStore) SaveBtcBlock(b *BtcBlockSchema) (err error) {
+	_, err = f.Client.Collection("btc_blocks").Doc(strconv.Itoa(b.Height)).Set(f.ctx, b)
+	return
+}
+
+// FindBtcBlock find the scanned block at a height, nothing if it was scanned before blocks were recorded
+func (f *FireStoreStore) FindBtcBlock(height int) (*BtcBlockSchema, error) {
+	doc, err := f.Client.Collection("btc_blocks").Doc(strconv.Itoa(height)).Get(f.ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var b *BtcBlockSchema
+	err = doc.DataTo(&b)
+	return b, err
+}
+
+// DeleteBtcBlocksAbove delete the scanned blocks above a height
+func (f *FireStoreStore) DeleteBtcBlocksAbove(height int) error {
+	docs, err := f.Client.Collection("btc_blocks").Where("height", ">", height).Documents(f.ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if _, err := doc.Ref.Delete(f.ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackBtcUtxos delete the utxos created above a height and unspend those spent above it
+func (f *FireStoreStore) RollbackBtcUtxos(height int) error {
+	utxos := f.Client.Collection("btc_utxos")
+	created, err := utxos.Where("block_height", ">", height).Documents(f.ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range created {
+		if _, err := doc.Ref.Delete(f.ctx); err != nil {
+			return err
+		}
+	}
+
+	spent, err := utxos.Where("spent_height", ">", height).Documents(f.ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range spent {
+		if _, err := doc.Ref.Update(f.ctx, []firestore.Update{
+			{Path: "spent", Value: false},
+			{Path: "spent_height", Value: 0},
+			{Path: "spent_txHash", Value: ""},
+		}); err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveBtcFeeStats save the fee rates statistics of a scanned block
+func (f *FireStoreStore) SaveBtcFeeStats(s *BtcFeeStatsSchema) (err error) {
+	_, err = f.Client.Collection("btc_fee_stats").Doc(strconv.Itoa(s.Height)).Set(f.ctx, s)
+	return
+}
+
+// FindLatestBtcFeeStats find the fee rates statistics of the n latest scanned blocks
+func (f *FireStoreStore) FindLatestBtcFeeStats(n int) (stats []*BtcFeeStatsSchema, err error) {
+	iter := f.Client.Collection("btc_fee_stats").OrderBy("height", firestore.Desc).Limit(n).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var s *BtcFeeStatsSchema
+		if err = doc.DataTo(&s); err != nil {
+			return
+		}
+		stats = append(stats, s)
+	}
+
+	return
+}
+
+// FindBtcFeeEstimate find the cached fee estimates of the given chain, returns nothing if there are none
+func (f *FireStoreStore) FindBtcFeeEstimate(chain string) (e *BtcFeeEstimateSchema, err error) {
+	doc, errStore := f.Client.Collection("fee_estimates").Doc(chain).Get(f.ctx)
+	if errStore != nil && grpc.Code(errStore) != codes.NotFound {
+		err = errStore
+		return
+	}
+
+	if doc.Exists() {
+		err = doc.DataTo(&e)
+	}
+	return
+}
+
+// SaveBtcFeeEstimate cache the fee estimates of the given chain
+func (f *FireStoreStore) SaveBtcFeeEstimate(chain string, e *BtcFeeEstimateSchema) (err error) {
+	_, err = f.Client.Collection("fee_estimates").Doc(chain).Set(f.ctx, e)
+	return
+}
+
+// ErrInsufficientBalance returned when a hold exceeds the available balance
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// settleBtcBalance release a hold of a user UID and debit the amount actually spent from its btc balance bal
+func (f *FireStoreStore) settleBtcBalance(tx *firestore.Transaction, uid string, bal, hold, spent float64) error {
+	e, err := NewOutboxEvent(EventBalanceChanged, uid, &BalanceChangedData{UID: uid, BTC: bal - spent, Delta: -spent, Reason: "withdrawal"})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Update(f.Client.Collection("balances").Doc(uid), []firestore.Update{
+		{Path: "BTC_held", Value: firestore.Increment(-hold)},
+		{Path: "BTC", Value: firestore.Increment(-spent)},
+	}); err != nil {
+		return err
+	}
+	return f.appendEvents(tx, e)
+}
+
+// ErrUtxoReserved returned when an input of a withdrawal request is spent or reserved by another one
+var ErrUtxoReserved = errors.New("utxo already spent or reserved")
+
+// CreateBtcWithdrawal create a withdrawal request and set its generated id. Its amount is put on hold and its inputs
+// are reserved in the same transaction, failing if the available balance is too low or an input was taken meanwhile
+func (f *FireStoreStore) CreateBtcWithdrawal(w *BtcWithdrawalSchema) error {
+	ref := f.Client.Collection("btc_withdrawals").NewDoc()
+	balRef := f.Client.Collection("balances").Doc(w.UID)
+	var utxoRefs []*firestore.DocumentRef
+	for _, id := range w.Inputs {
+		utxoRefs = append(utxoRefs, f.Client.Collection("btc_utxos").Doc(id))
+	}
+
+	err := f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(balRef)
+		if err != nil {
+			return err
+		}
+		data := make(map[string]float64)
+		if err := doc.DataTo(&data); err != nil {
+			return err
 		}
-		_, errSet := f.Client.Collection("btc_transactions").Doc(uid).Set(f.ctx, BtcTransactionSchema{Confirmed: true}, firestore.Merge([]string{"confirmed"}))
+		if data["BTC"]-data["BTC_held"] < w.Hold {
+			return ErrInsufficientBalance
+		}
+
+		docs, err := tx.GetAll(utxoRefs)
 		if err != nil {
-			err = errSet
+			return err
+		}
+		for _, doc := range docs {
+			var u *BtcUtxoSchema
+			if !doc.Exists() {
+				return ErrUtxoReserved
+			}
+			if err := doc.DataTo(&u); err != nil {
+				return err
+			}
+			if u.Spent || u.ReservedBy != "" {
+				return ErrUtxoReserved
+			}
+		}
+
+		if err := tx.Set(balRef, map[string]interface{}{"BTC_held": data["BTC_held"] + w.Hold}, firestore.MergeAll); err != nil {
+			return err
+		}
+		for _, utxoRef := range utxoRefs {
+			if err := tx.Update(utxoRef, []firestore.Update{{Path: "reserved_by", Value: ref.ID}}); err != nil {
+				return err
+			}
+		}
+		return tx.Create(ref, w)
+	})
+	if err == nil {
+		w.ID = ref.ID
+	}
+	return err
+}
+
+// reservedBtcUtxos find the inputs of a withdrawal request still reserved by it, rolled back ones excluded
+func (f *FireStoreStore) reservedBtcUtxos(tx *firestore.Transaction, w *BtcWithdrawalSchema) (reserved []*firestore.DocumentRef, err error) {
+	var refs []*firestore.DocumentRef
+	for _, id := range w.Inputs {
+		refs = append(refs, f.Client.Collection("btc_utxos").Doc(id))
+	}
+	docs, err := tx.GetAll(refs)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if !doc.Exists() {
 			continue
 		}
+		if by, _ := doc.DataAt("reserved_by"); by == w.ID {
+			reserved = append(reserved, doc.Ref)
+		}
 	}
+	return reserved, nil
+}
+
+// WithdrawalStatusError the withdrawal request doesn't have any of the statuses a change starts from
+type WithdrawalStatusError struct {
+	Status string
+}
 
+func (e *WithdrawalStatusError) Error() string {
+	return "withdrawal is " + e.Status
+}
+
+// TransitionBtcWithdrawal change a withdrawal request with fn provided it has one of the from statuses, in a
+// transaction. The hold of a request that fails or is cancelled is released and the one of a confirmed request is
+// settled along the change, fn errors abort it. The inputs of a request that fails or is cancelled are released too
+func (f *FireStoreStore) TransitionBtcWithdrawal(id string, from []string, fn func(w *BtcWithdrawalSchema) error) (w *BtcWithdrawalSchema, err error) {
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		w, err = f.transitionBtcWithdrawal(tx, id, from, fn)
+		return err
+	})
 	return
 }
 
-// FindAccountByAddress find a firestore account from an address
-func (f *FireStoreStore) FindAccountByAddress(addr string) (a *BtcAccountSchema, err error) {
-	doc, errQ := f.Client.Collection("btc_accounts").Where("address", "==", addr).Documents(f.ctx).Next()
+// BroadcastBtcWithdrawal record the broadcast of a signed withdrawal request and mark the request as broadcast, in
+// a transaction
+func (f *FireStoreStore) BroadcastBtcWithdrawal(id string, b *BtcBroadcastSchema) (w *BtcWithdrawalSchema, err error) {
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		w, err = f.transitionBtcWithdrawal(tx, id, []string{WithdrawalSigned}, func(w *BtcWithdrawalSchema) error {
+			w.Status = WithdrawalBroadcast
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Set(f.Client.Collection("btc_broadcasts").Doc(b.TxHash), b)
+	})
+	return
+}
+
+// transitionBtcWithdrawal change a withdrawal request in the transaction tx, see TransitionBtcWithdrawal
+func (f *FireStoreStore) transitionBtcWithdrawal(tx *firestore.Transaction, id string, from []string, fn func(w *BtcWithdrawalSchema) error) (*BtcWithdrawalSchema, error) {
+	var w *BtcWithdrawalSchema
+	ref := f.Client.Collection("btc_withdrawals").Doc(id)
+	doc, err := tx.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.DataTo(&w); err != nil {
+		return nil, err
+	}
+	w.ID = id
+	prev := w.Status
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || w.Status == s
+	}
+	if !allowed {
+		return nil, &WithdrawalStatusError{Status: w.Status}
+	}
+	if err := fn(w); err != nil {
+		return nil, err
+	}
+	w.UpdatedAt = time.Now()
+
+	switch w.Status {
+	case WithdrawalFailed, WithdrawalCancelled:
+		reserved, err := f.reservedBtcUtxos(tx, w)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Update(f.Client.Collection("balances").Doc(w.UID), []firestore.Update{
+			{Path: "BTC_held", Value: firestore.Increment(-w.Hold)},
+		}); err != nil {
+			return nil, err
+		}
+		for _, ref := range reserved {
+			if err := tx.Update(ref, []firestore.Update{{Path: "reserved_by", Value: firestore.Delete}}); err != nil {
+				return nil, err
+			}
+		}
+	case WithdrawalConfirmed:
+		bal, err := f.btcBalance(tx, w.UID)
+		if err != nil {
+			return nil, err
+		}
+		// amount and fee in btc, the way helpers.FromSatoshiToBtc converts them
+		spent := float64(w.Amount+w.Fee) * 10e-9
+		// the hold of a dropped withdrawal mined late was already released
+		hold := w.Hold
+		if prev == WithdrawalFailed {
+			hold = 0
+		}
+		if err := f.settleBtcBalance(tx, w.UID, bal, hold, spent); err != nil {
+			return nil, err
+		}
+	}
+	return w, tx.Set(ref, w)
+}
+
+// FindBtcWithdrawal find a withdrawal request by id
+func (f *FireStoreStore) FindBtcWithdrawal(id string) (*BtcWithdrawalSchema, error) {
+	var w *BtcWithdrawalSchema
+	doc, err := f.Client.Collection("btc_withdrawals").Doc(id).Get(f.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.DataTo(&w); err != nil {
+		return nil, err
+	}
+	w.ID = id
+	return w, nil
+}
+
+// FindBtcWithdrawalByTxHash find the withdrawal broadcast with the given transaction, returns nothing if there is none
+func (f *FireStoreStore) FindBtcWithdrawalByTxHash(txHash string) (w *BtcWithdrawalSchema, err error) {
+	doc, errQ := f.Client.Collection("btc_withdrawals").Where("txHash", "==", txHash).Documents(f.ctx).Next()
+	if errQ == iterator.Done {
+		return
+	}
 	if errQ != nil {
 		err = errQ
 		return
 	}
-	if doc.Exists() {
-		doc.DataTo(&a)
-		a.UID = doc.Ref.ID
+	if err = doc.DataTo(&w); err != nil {
+		return
+	}
+	w.ID = doc.Ref.ID
+	return
+}
+
+// FindBtcWithdrawals find the withdrawal requests of a user UID, latest first. All requests are returned if uid is empty
+func (f *FireStoreStore) FindBtcWithdrawals(uid string) (ws []*BtcWithdrawalSchema, err error) {
+	q := f.Client.Collection("btc_withdrawals").OrderBy("created_at", firestore.Desc)
+	if uid != "" {
+		q = q.Where("uid", "==", uid)
+	}
+	iter := q.Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var w *BtcWithdrawalSchema
+		if err = doc.DataTo(&w); err != nil {
+			return
+		}
+		w.ID = doc.Ref.ID
+		ws = append(ws, w)
+	}
+
+	return
+}
+
+// FindBtcTransactionsByAddresses find the transactions received by the given addresses, after the cursor if any
+func (f *FireStoreStore) FindBtcTransactionsByAddresses(addrs []string, after *BtcTransactionCursor, limit int) ([]*BtcTransactionSchema, error) {
+	q := f.Client.Collection("btc_transactions").Where("to", "in", addrs)
+	return f.findBtcTransactions(q, after, limit)
+}
+
+// FindOutgoingBtcTransactions find the transactions sent by a user UID, after the cursor if any
+func (f *FireStoreStore) FindOutgoingBtcTransactions(uid string, after *BtcTransactionCursor, limit int) ([]*BtcTransactionSchema, error) {
+	q := f.Client.Collection("btc_transactions").Where("uid", "==", uid).Where("direction", "==", DirectionOut)
+	return f.findBtcTransactions(q, after, limit)
+}
+
+func (f *FireStoreStore) findBtcTransactions(q firestore.Query, after *BtcTransactionCursor, limit int) (txs []*BtcTransactionSchema, err error) {
+	q = q.OrderBy("block_height", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc)
+	if after != nil {
+		q = q.StartAfter(after.BlockHeight, after.ID)
 	}
+	iter := q.Limit(limit).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var tx *BtcTransactionSchema
+		if err = doc.DataTo(&tx); err != nil {
+			return
+		}
+		tx.ID = doc.Ref.ID
+		txs = append(txs, tx)
+	}
+
+	return
+}
+
+// Errors of the account registration
+var (
+	ErrAccountExists = errors.New("account already registered")
+	ErrAddressTaken  = errors.New("address already registered by another account")
+)
+
+// CreateBtcAccount register the btc address of a user UID and create its balance if needed. It fails if the
+// user already has an account or if the address belongs to another account or to an invoice
+func (f *FireStoreStore) CreateBtcAccount(uid, address string) error {
+	accRef := f.Client.Collection("btc_accounts").Doc(uid)
+	balRef := f.Client.Collection("balances").Doc(uid)
+	addrRef := f.Client.Collection("btc_addresses").Doc(address)
+	return f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		acc, err := tx.Get(accRef)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		if acc.Exists() {
+			return ErrAccountExists
+		}
+
+		dups, err := tx.Documents(f.Client.Collection("btc_accounts").Where("address", "==", address).Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(dups) > 0 {
+			return ErrAddressTaken
+		}
+		idx, err := tx.Get(addrRef)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		if idx.Exists() {
+			return ErrAddressTaken
+		}
+
+		bal, err := tx.Get(balRef)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		if !bal.Exists() {
+			if err := tx.Create(balRef, map[string]interface{}{"BTC": 0.0}); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(addrRef, map[string]interface{}{"uid": uid}); err != nil {
+			return err
+		}
+		return tx.Create(accRef, map[string]interface{}{"address": address})
+	})
+}
+
+// NextDerivationIndex reserve the next index of the address derivation pool of the given chain
+func (f *FireStoreStore) NextDerivationIndex(chain string) (index int64, err error) {
+	ref := f.Client.Collection("btc_address_pool").Doc(chain)
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		index = 0
+		if doc.Exists() {
+			next, errData := doc.DataAt("next_index")
+			if errData != nil {
+				return errData
+			}
+			index = next.(int64)
+		}
+		return tx.Set(ref, map[string]interface{}{"next_index": index + 1})
+	})
+	return
+}
+
+// SaveBtcBackfill create or replace the backfill of the history of an address
+func (f *FireStoreStore) SaveBtcBackfill(b *BtcBackfillSchema) (err error) {
+	_, err = f.Client.Collection("btc_backfills").Doc(b.Address).Set(f.ctx, b)
+	return
+}
+
+// FindBtcBackfill find the backfill of the history of an address, returns nothing if there is none
+func (f *FireStoreStore) FindBtcBackfill(address string) (b *BtcBackfillSchema, err error) {
+	doc, errStore := f.Client.Collection("btc_backfills").Doc(address).Get(f.ctx)
+	if errStore != nil && grpc.Code(errStore) != codes.NotFound {
+		err = errStore
+		return
+	}
+
+	if doc.Exists() {
+		err = doc.DataTo(&b)
+	}
+	return
+}
+
+// FindIndexedBtcAddress find the uid of the account an address is indexed to, empty if it isn't indexed
+func (f *FireStoreStore) FindIndexedBtcAddress(address string) (string, error) {
+	doc, err := f.Client.Collection("btc_addresses").Doc(address).Get(f.ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	uid, err := doc.DataAt("uid")
+	if err != nil {
+		return "", err
+	}
+	return uid.(string), nil
+}
+
+// IndexBtcAddress index the address of the account of a user UID, replacing its previous address if any
+func (f *FireStoreStore) IndexBtcAddress(uid, address, oldAddress string) (err error) {
+	b := f.Client.Batch()
+	if oldAddress != "" {
+		b.Delete(f.Client.Collection("btc_addresses").Doc(oldAddress))
+	}
+	b.Set(f.Client.Collection("btc_addresses").Doc(address), map[string]interface{}{"uid": uid})
+	_, err = b.Commit(f.ctx)
+	return
+}
+
+// Errors of the conversion requests
+var (
+	ErrConvertProcessed = errors.New("conversion request already processed")
+)
+
+func (f *FireStoreStore) convertHistory(uid string) *firestore.CollectionRef {
+	return f.Client.Collection("convert_history").Doc(uid).Collection("history")
+}
+
+func convertRequestFrom(doc *firestore.DocumentSnapshot) (r *ConvertRequestSchema, err error) {
+	if err = doc.DataTo(&r); err != nil {
+		return
+	}
+	r.ID = doc.Ref.ID
+	r.UID = doc.Ref.Parent.Parent.ID
+	if r.Status == "" {
+		r.Status = ConvertPending
+	}
+	return
+}
+
+// processedConvertRequest updates of the fields set by the processing of a conversion request, the fields written by
+// the app are left untouched
+func processedConvertRequest(r *ConvertRequestSchema) []firestore.Update {
+	return []firestore.Update{
+		{Path: "status", Value: r.Status},
+		{Path: "reason", Value: r.Reason},
+		{Path: "executed_rate", Value: r.ExecutedRate},
+		{Path: "received", Value: r.Received},
+		{Path: "processed_at", Value: r.ProcessedAt},
+	}
+}
+
+// FindConvertRequest find a conversion request of a user UID
+func (f *FireStoreStore) FindConvertRequest(uid, id string) (*ConvertRequestSchema, error) {
+	doc, err := f.convertHistory(uid).Doc(id).Get(f.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return convertRequestFrom(doc)
+}
+
+// FindPendingConvertRequests find the pending conversion requests of every account, those written by the app without
+// a status included
+func (f *FireStoreStore) FindPendingConvertRequests() (rs []*ConvertRequestSchema, err error) {
+	docs, err := f.Client.CollectionGroup("history").Where("status", "==", ConvertPending).Documents(f.ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// documents without a field don't match any filter on it, they are looked for among every request
+	iter := f.Client.CollectionGroup("history").Select("status").Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			return nil, errIter
+		}
+		if status, errField := doc.DataAt("status"); errField == nil && status != "" {
+			continue
+		}
+		full, errGet := doc.Ref.Get(f.ctx)
+		if errGet != nil {
+			return nil, errGet
+		}
+		docs = append(docs, full)
+	}
+
+	for _, doc := range docs {
+		r, errData := convertRequestFrom(doc)
+		if errData != nil {
+			return nil, errData
+		}
+		rs = append(rs, r)
+	}
+	return
+}
+
+// BackfillConvertRequestStatus mark a conversion request written by the app without a status as pending
+func (f *FireStoreStore) BackfillConvertRequestStatus(uid, id string) error {
+	ref := f.convertHistory(uid).Doc(id)
+	return f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if status, err := doc.DataAt("status"); err == nil && status != "" {
+			return nil
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "status", Value: ConvertPending}})
+	})
+}
+
+// ConvertBalance execute a pending conversion request at the given rate: the amount is debited from the balance of
+// the From currency and received is credited to the balance of the To currency, along a BalanceChanged event when
+// either is btc. The request is rejected instead if the account isn't active or the available balance is insufficient
+func (f *FireStoreStore) ConvertBalance(uid, id string, rate, received float64) (*ConvertRequestSchema, error) {
+	reqRef := f.convertHistory(uid).Doc(id)
+	accRef := f.Client.Collection("btc_accounts").Doc(uid)
+	balRef := f.Client.Collection("balances").Doc(uid)
+	var r *ConvertRequestSchema
+	err := f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(reqRef)
+		if err != nil {
+			return err
+		}
+		if r, err = convertRequestFrom(doc); err != nil {
+			return err
+		}
+		if r.Status != ConvertPending {
+			return ErrConvertProcessed
+		}
+
+		acc, err := tx.Get(accRef)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		a := &BtcAccountSchema{}
+		if acc.Exists() {
+			if err := acc.DataTo(a); err != nil {
+				return err
+			}
+		}
+		bal, err := tx.Get(balRef)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		data := make(map[string]float64)
+		if bal.Exists() {
+			if err := bal.DataTo(&data); err != nil {
+				return err
+			}
+		}
+
+		r.ProcessedAt = time.Now()
+		switch {
+		case !acc.Exists() || !a.Active():
+			r.Status = ConvertRejected
+			r.Reason = ErrAccountNotActive.Error()
+			return tx.Update(reqRef, processedConvertRequest(r))
+		case data[r.From]-data[r.From+"_held"] < r.Amount:
+			r.Status = ConvertRejected
+			r.Reason = ErrInsufficientBalance.Error()
+			return tx.Update(reqRef, processedConvertRequest(r))
+		}
+
+		r.Status = ConvertCompleted
+		r.ExecutedRate = rate
+		r.Received = received
+		var events []*OutboxEventSchema
+		if delta := convertedBtc(r); delta != 0 {
+			e, err := NewOutboxEvent(EventBalanceChanged, uid, &BalanceChangedData{UID: uid, BTC: data["BTC"] + delta, Delta: delta, Reason: "conversion"})
+			if err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+
+		if err := tx.Set(balRef, map[string]interface{}{
+			r.From: data[r.From] - r.Amount,
+			r.To:   data[r.To] + received,
+		}, firestore.MergeAll); err != nil {
+			return err
+		}
+		if err := tx.Update(reqRef, processedConvertRequest(r)); err != nil {
+			return err
+		}
+		return f.appendEvents(tx, events...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// convertedBtc change of the btc balance made by a completed conversion request
+func convertedBtc(r *ConvertRequestSchema) (delta float64) {
+	if r.From == "BTC" {
+		delta -= r.Amount
+	}
+	if r.To == "BTC" {
+		delta += r.Received
+	}
+	return
+}
+
+// RejectConvertRequest reject a pending conversion request with a reason
+func (f *FireStoreStore) RejectConvertRequest(uid, id, reason string) (*ConvertRequestSchema, error) {
+	ref := f.convertHistory(uid).Doc(id)
+	var r *ConvertRequestSchema
+	err := f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if r, err = convertRequestFrom(doc); err != nil {
+			return err
+		}
+		if r.Status != ConvertPending {
+			return ErrConvertProcessed
+		}
+
+		r.Status = ConvertRejected
+		r.Reason = reason
+		r.ProcessedAt = time.Now()
+		return tx.Update(ref, processedConvertRequest(r))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SaveRate record an exchange rate
+func (f *FireStoreStore) SaveRate(r *price.Rate) (err error) {
+	id := r.Base + "_" + r.Quote + "_" + strconv.FormatInt(r.Time.Unix(), 10)
+	_, err = f.Client.Collection("rates").Doc(id).Set(f.ctx, r)
+	return
+}
+
+// FindRateAt find the latest exchange rate of a currency pair recorded at or before t, returns nothing if there is none
+func (f *FireStoreStore) FindRateAt(base, quote string, t time.Time) (r *price.Rate, err error) {
+	doc, errQ := f.Client.Collection("rates").
+		Where("base", "==", base).
+		Where("quote", "==", quote).
+		Where("time", "<=", t).
+		OrderBy("time", firestore.Desc).
+		Limit(1).
+		Documents(f.ctx).Next()
+	if errQ == iterator.Done {
+		return
+	}
+	if errQ != nil {
+		err = errQ
+		return
+	}
+	err = doc.DataTo(&r)
+	return
+}
+
+// FindBtcBalances find the btc balance of every account, by user UID
+func (f *FireStoreStore) FindBtcBalances() (map[string]float64, error) {
+	balances := make(map[string]float64)
+	iter := f.Client.Collection("balances").Documents(f.ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data := make(map[string]interface{})
+		if err := doc.DataTo(&data); err != nil {
+			return nil, err
+		}
+		bal, _ := data["BTC"].(float64)
+		balances[doc.Ref.ID] = bal
+	}
+	return balances, nil
+}
+
+// SaveBalanceSnapshots record balance snapshots, a snapshot replaces the one of the same account taken in the same hour
+func (f *FireStoreStore) SaveBalanceSnapshots(snaps []*BalanceSnapshotSchema) error {
+	// a batch is limited to 500 writes
+	for start := 0; start < len(snaps); start += 500 {
+		end := start + 500
+		if end > len(snaps) {
+			end = len(snaps)
+		}
+		b := f.Client.Batch()
+		for _, s := range snaps[start:end] {
+			id := s.UID + "_" + strconv.FormatInt(s.Time.Truncate(time.Hour).Unix(), 10)
+			b.Set(f.Client.Collection("balance_snapshots").Doc(id), s)
+		}
+		if _, err := b.Commit(f.ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindBalanceSnapshots find the balance snapshots of a user UID taken between from and to (excluded), oldest first,
+// preceded by the last one taken before from if any
+func (f *FireStoreStore) FindBalanceSnapshots(uid string, from, to time.Time) (snaps []*BalanceSnapshotSchema, err error) {
+	snapshots := f.Client.Collection("balance_snapshots").Where("uid", "==", uid)
+	prev, errPrev := snapshots.Where("time", "<", from).OrderBy("time", firestore.Desc).Limit(1).Documents(f.ctx).Next()
+	if errPrev != nil && errPrev != iterator.Done {
+		err = errPrev
+		return
+	}
+	if errPrev == nil {
+		var s *BalanceSnapshotSchema
+		if err = prev.DataTo(&s); err != nil {
+			return
+		}
+		snaps = append(snaps, s)
+	}
+
+	iter := snapshots.
+		Where("time", ">=", from).
+		Where("time", "<", to).
+		OrderBy("time", firestore.Asc).
+		Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var s *BalanceSnapshotSchema
+		if err = doc.DataTo(&s); err != nil {
+			return
+		}
+		snaps = append(snaps, s)
+	}
+
+	return
+}
+
+// FindUnconfirmedBtcTransactionsAbove find the unconfirmed transactions recorded in blocks above the given height
+func (f *FireStoreStore) FindUnconfirmedBtcTransactionsAbove(h int) (txs []*BtcTransactionSchema, err error) {
+	iter := f.Client.Collection("btc_transactions").Where("block_height", ">", h).Where("confirmed", "==", false).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var tx *BtcTransactionSchema
+		if err = doc.DataTo(&tx); err != nil {
+			return
+		}
+		tx.ID = doc.Ref.ID
+		txs = append(txs, tx)
+	}
+
+	return
+}
+
+// FindConfirmedBtcDepositsAbove find the confirmed deposits recorded in blocks above the given height
+func (f *FireStoreStore) FindConfirmedBtcDepositsAbove(h int) ([]*BtcTransactionSchema, error) {
+	txs, err := f.getBtcTransactions(f.Client.Collection("btc_transactions").Where("block_height", ">", h).Where("confirmed", "==", true))
+	if err != nil {
+		return nil, err
+	}
+	var deposits []*BtcTransactionSchema
+	for _, t := range txs {
+		if t.Direction != DirectionOut {
+			deposits = append(deposits, t)
+		}
+	}
+	return deposits, nil
+}
+
+// DeleteBtcTransaction delete a btc transaction
+func (f *FireStoreStore) DeleteBtcTransaction(id string) (err error) {
+	_, err = f.Client.Collection("btc_transactions").Doc(id).Delete(f.ctx)
+	return
+}
+
+// CreateWebhook create a webhook
+func (f *FireStoreStore) CreateWebhook(w *WebhookSchema) (err error) {
+	ref := f.Client.Collection("webhooks").NewDoc()
+	w.ID = ref.ID
+	_, err = ref.Create(f.ctx, w)
+	return
+}
+
+// UpdateWebhook update a webhook
+func (f *FireStoreStore) UpdateWebhook(w *WebhookSchema) (err error) {
+	_, err = f.Client.Collection("webhooks").Doc(w.ID).Set(f.ctx, w)
+	return
+}
+
+// FindWebhook find a webhook by id
+func (f *FireStoreStore) FindWebhook(id string) (*WebhookSchema, error) {
+	var w *WebhookSchema
+	doc, err := f.Client.Collection("webhooks").Doc(id).Get(f.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.DataTo(&w); err != nil {
+		return nil, err
+	}
+	w.ID = id
+	return w, nil
+}
+
+// FindWebhooks find every webhook, or only the active ones subscribed to an event type if it is given
+func (f *FireStoreStore) FindWebhooks(eventType string) (ws []*WebhookSchema, err error) {
+	q := f.Client.Collection("webhooks").Query
+	if eventType != "" {
+		q = q.Where("active", "==", true).Where("events", "array-contains", eventType)
+	}
+	iter := q.Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var w *WebhookSchema
+		if err = doc.DataTo(&w); err != nil {
+			return
+		}
+		w.ID = doc.Ref.ID
+		ws = append(ws, w)
+	}
+
+	return
+}
+
+// CreateWebhookDelivery create the delivery of an event to a webhook, returns false if it already exists
+func (f *FireStoreStore) CreateWebhookDelivery(d *WebhookDeliverySchema) (bool, error) {
+	d.ID = d.EventID + "_" + d.WebhookID
+	_, err := f.Client.Collection("webhook_deliveries").Doc(d.ID).Create(f.ctx, d)
+	if grpc.Code(err) == codes.AlreadyExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// UpdateWebhookDelivery update the delivery of an event to a webhook
+func (f *FireStoreStore) UpdateWebhookDelivery(d *WebhookDeliverySchema) (err error) {
+	_, err = f.Client.Collection("webhook_deliveries").Doc(d.ID).Set(f.ctx, d)
+	return
+}
+
+// FindWebhookDelivery find the delivery of an event to a webhook by id
+func (f *FireStoreStore) FindWebhookDelivery(id string) (*WebhookDeliverySchema, error) {
+	var d *WebhookDeliverySchema
+	doc, err := f.Client.Collection("webhook_deliveries").Doc(id).Get(f.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.DataTo(&d); err != nil {
+		return nil, err
+	}
+	d.ID = id
+	return d, nil
+}
+
+// FindDueWebhookDeliveries find the pending deliveries whose next attempt is due at t
+func (f *FireStoreStore) FindDueWebhookDeliveries(t time.Time) (ds []*WebhookDeliverySchema, err error) {
+	iter := f.Client.Collection("webhook_deliveries").
+		Where("status", "==", DeliveryPending).
+		Where("next_attempt_at", "<=", t).
+		Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var d *WebhookDeliverySchema
+		if err = doc.DataTo(&d); err != nil {
+			return
+		}
+		d.ID = doc.Ref.ID
+		ds = append(ds, d)
+	}
+
+	return
+}
+
+// NewOutboxEvent create an event of the given type and ordering key, with data as json payload
+func NewOutboxEvent(eventType, key string, data interface{}) (*OutboxEventSchema, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxEventSchema{Type: eventType, Key: key, Payload: string(payload)}, nil
+}
+
+// NewDepositEvent create a deposit event of the given type
+func NewDepositEvent(eventType string, t *BtcTransactionSchema) (*OutboxEventSchema, error) {
+	return NewOutboxEvent(eventType, t.UID, &DepositEventData{
+		ID:          t.DocID(),
+		UID:         t.UID,
+		TxHash:      t.TxHash,
+		VoutIdx:     t.VoutIdx,
+		Address:     t.To,
+		Amount:      t.Amount,
+		BlockHeight: t.BlockHeight,
+		Confirmed:   t.Confirmed,
+	})
+}
+
+// appendEvents append events to the outbox within a transaction, they are committed along with it
+func (f *FireStoreStore) appendEvents(tx *firestore.Transaction, events ...*OutboxEventSchema) error {
+	for i, e := range events {
+		e.Seq = i
+		if err := tx.Create(f.Client.Collection("outbox").NewDoc(), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// btcBalance read the btc balance of a user UID within a transaction, 0 if it has none
+func (f *FireStoreStore) btcBalance(tx *firestore.Transaction, uid string) (float64, error) {
+	doc, err := tx.Get(f.Client.Collection("balances").Doc(uid))
+	if grpc.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	data := make(map[string]interface{})
+	if err := doc.DataTo(&data); err != nil {
+		return 0, err
+	}
+	bal, _ := data["BTC"].(float64)
+	return bal, nil
+}
+
+// FindOrCreateBtcTransaction find a btc transaction and returns it, or create it if not exist and returns nothing.
+// The creation of a deposit appends a DepositDetected event
+func (f *FireStoreStore) FindOrCreateBtcTransaction(t *BtcTransactionSchema) (existing *BtcTransactionSchema, err error) {
+	ref := f.Client.Collection("btc_transactions").Doc(t.DocID())
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing = nil
+		doc, err := tx.Get(ref)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		if doc.Exists() {
+			return doc.DataTo(&existing)
+		}
+
+		if err := tx.Create(ref, t); err != nil {
+			return err
+		}
+		if t.Direction == DirectionOut {
+			return nil
+		}
+		e, err := NewDepositEvent(EventDepositDetected, t)
+		if err != nil {
+			return err
+		}
+		return f.appendEvents(tx, e)
+	})
+	return
+}
+
+// ConfirmBtcDeposit confirm a deposit of a user UID and credit its amount to the btc balance, along with
+// DepositConfirmed and BalanceChanged events. Deposits already confirmed are left untouched, those of accounts that
+// are not active are queued for review instead. Returns whether the deposit was credited
+func (f *FireStoreStore) ConfirmBtcDeposit(t *BtcTransactionSchema, uid string) (credited bool, err error) {
+	ref := f.Client.Collection("btc_transactions").Doc(t.DocID())
+	accRef := f.Client.Collection("btc_accounts").Doc(uid)
+	balRef := f.Client.Collection("balances").Doc(uid)
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		credited = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var current *BtcTransactionSchema
+		if err := doc.DataTo(&current); err != nil {
+			return err
+		}
+		if current.Confirmed {
+			return nil
+		}
+		accDoc, err := tx.Get(accRef)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		acc := &BtcAccountSchema{}
+		if accDoc.Exists() {
+			if err := accDoc.DataTo(acc); err != nil {
+				return err
+			}
+		}
+		if !acc.Active() {
+			return f.queueDepositReview(tx, ref, uid, acc.Status)
+		}
+		bal, err := f.btcBalance(tx, uid)
+		if err != nil {
+			return err
+		}
+
+		current.Confirmed = true
+		if current.UID == "" {
+			current.UID = uid
+		}
+		confirmed, err := NewDepositEvent(EventDepositConfirmed, current)
+		if err != nil {
+			return err
+		}
+		changed, err := NewOutboxEvent(EventBalanceChanged, uid, &BalanceChangedData{UID: uid, BTC: bal + current.Amount, Delta: current.Amount, Reason: "deposit"})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Update(ref, []firestore.Update{{Path: "confirmed", Value: true}}); err != nil {
+			return err
+		}
+		if err := tx.Set(balRef, map[string]interface{}{"BTC": bal + current.Amount}, firestore.MergeAll); err != nil {
+			return err
+		}
+		credited = true
+		return f.appendEvents(tx, confirmed, changed)
+	})
+	return
+}
+
+// queueDepositReview withhold a deposit of an account that is not active until it is reviewed, and record it in the
+// audit trail of the account
+func (f *FireStoreStore) queueDepositReview(tx *firestore.Transaction, ref *firestore.DocumentRef, uid, status string) error {
+	reason := "account is " + status
+	if err := tx.Update(ref, []firestore.Update{
+		{Path: "review", Value: ReviewPending},
+		{Path: "review_reason", Value: reason},
+		{Path: "hold_until", Value: firestore.Delete},
+	}); err != nil {
+		return err
+	}
+	return tx.Create(f.Client.Collection("btc_accounts").Doc(uid).Collection("audit").NewDoc(), &AccountAuditSchema{
+		UID:       uid,
+		Action:    AuditDepositReview,
+		Status:    status,
+		Reason:    reason,
+		Deposit:   ref.ID,
+		CreatedAt: time.Now(),
+	})
+}
+
+// FindUnpublishedEvents find the events of the outbox that are not published yet, oldest first
+func (f *FireStoreStore) FindUnpublishedEvents(limit int) (es []*OutboxEventSchema, err error) {
+	iter := f.Client.Collection("outbox").
+		Where("published", "==", false).
+		OrderBy("created_at", firestore.Asc).
+		OrderBy("seq", firestore.Asc).
+		Limit(limit).
+		Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var e *OutboxEventSchema
+		if err = doc.DataTo(&e); err != nil {
+			return
+		}
+		e.ID = doc.Ref.ID
+		es = append(es, e)
+	}
+
+	return
+}
+
+// MarkEventPublished mark an event of the outbox as published
+func (f *FireStoreStore) MarkEventPublished(id string) (err error) {
+	_, err = f.Client.Collection("outbox").Doc(id).Update(f.ctx, []firestore.Update{
+		{Path: "published", Value: true},
+		{Path: "published_at", Value: time.Now()},
+	})
+	return
+}
+
+// FindOutboxEvent find an event of the outbox, nil if it doesn't exist
+func (f *FireStoreStore) FindOutboxEvent(id string) (*OutboxEventSchema, error) {
+	doc, err := f.Client.Collection("outbox").Doc(id).Get(f.ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e *OutboxEventSchema
+	if err := doc.DataTo(&e); err != nil {
+		return nil, err
+	}
+	e.ID = doc.Ref.ID
+	return e, nil
+}
+
+// ListenAccountEvents call fn with the events of a user UID in order, as they are appended to the outbox. Events
+// appended after the event after are listened, or after now if it is nil. Listening stops when ctx is done, which
+// isn't an error, or when fn fails
+func (f *FireStoreStore) ListenAccountEvents(ctx context.Context, uid string, after *OutboxEventSchema, fn func(*OutboxEventSchema) error) error {
+	q := f.Client.Collection("outbox").
+		Where("key", "==", uid).
+		OrderBy("created_at", firestore.Asc).
+		OrderBy("seq", firestore.Asc)
+	if after != nil {
+		q = q.StartAfter(after.CreatedAt, after.Seq)
+	} else {
+		q = q.Where("created_at", ">", time.Now())
+	}
+
+	iter := q.Snapshots(ctx)
+	defer iter.Stop()
+	for {
+		snap, err := iter.Next()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// changes are in the order of the query, events being immutable only additions matter
+		for _, c := range snap.Changes {
+			if c.Kind != firestore.DocumentAdded {
+				continue
+			}
+			var e *OutboxEventSchema
+			if err := c.Doc.DataTo(&e); err != nil {
+				return err
+			}
+			e.ID = c.Doc.Ref.ID
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// FindCompletedConvertRequests find the executed conversion requests of a user UID
+func (f *FireStoreStore) FindCompletedConvertRequests(uid string) (rs []*ConvertRequestSchema, err error) {
+	iter := f.convertHistory(uid).Where("status", "==", ConvertCompleted).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		r, errData := convertRequestFrom(doc)
+		if errData != nil {
+			err = errData
+			return
+		}
+		rs = append(rs, r)
+	}
+
+	return
+}
+
+// CreateReconciliation create the report of a reconciliation and set its generated id
+func (f *FireStoreStore) CreateReconciliation(r *ReconciliationSchema) (err error) {
+	ref := f.Client.Collection("reconciliations").NewDoc()
+	r.ID = ref.ID
+	_, err = ref.Create(f.ctx, r)
+	return
+}
+
+// UpdateReconciliation update the report of a reconciliation
+func (f *FireStoreStore) UpdateReconciliation(r *ReconciliationSchema) (err error) {
+	_, err = f.Client.Collection("reconciliations").Doc(r.ID).Set(f.ctx, r)
+	return
+}
+
+// SaveBalanceDiscrepancy save a discrepancy of a reconciliation, identified by the run and the account
+func (f *FireStoreStore) SaveBalanceDiscrepancy(d *BalanceDiscrepancySchema) (err error) {
+	d.ID = d.Run + "_" + d.UID
+	_, err = f.Client.Collection("balance_discrepancies").Doc(d.ID).Set(f.ctx, d)
+	return
+}
+
+// ErrBalanceChanged the balance changed since it was read
+var ErrBalanceChanged = errors.New("balance changed")
+
+// AdjustBtcBalance credit the amount of an adjustment to the btc balance of its account, which must still be before.
+// The adjustment is recorded in the ledger along a BalanceChanged event
+func (f *FireStoreStore) AdjustBtcBalance(a *LedgerAdjustmentSchema) error {
+	balRef := f.Client.Collection("balances").Doc(a.UID)
+	ref := f.Client.Collection("ledger_adjustments").NewDoc()
+	a.ID = ref.ID
+	return f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		bal, err := f.btcBalance(tx, a.UID)
+		if err != nil {
+			return err
+		}
+		if bal != a.Before {
+			return ErrBalanceChanged
+		}
+		e, err := NewOutboxEvent(EventBalanceChanged, a.UID, &BalanceChangedData{UID: a.UID, BTC: a.After, Delta: a.Amount, Reason: "adjustment"})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Set(balRef, map[string]interface{}{"BTC": a.After}, firestore.MergeAll); err != nil {
+			return err
+		}
+		if err := tx.Create(ref, a); err != nil {
+			return err
+		}
+		return f.appendEvents(tx, e)
+	})
+}
+
+// ErrAccountNotActive the account is frozen or closed
+var ErrAccountNotActive = errors.New("account is not active")
+
+// CreditBtcBalance credit delta btc to the balance of an active account of a user UID, along a BalanceChanged event
+// giving the reason of the change, and return the new balance
+func (f *FireStoreStore) CreditBtcBalance(uid string, delta float64, reason string) (balance float64, err error) {
+	accRef := f.Client.Collection("btc_accounts").Doc(uid)
+	balRef := f.Client.Collection("balances").Doc(uid)
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(accRef)
+		if err != nil {
+			return err
+		}
+		acc := &BtcAccountSchema{}
+		if err := doc.DataTo(acc); err != nil {
+			return err
+		}
+		if !acc.Active() {
+			return ErrAccountNotActive
+		}
+		bal, err := f.btcBalance(tx, uid)
+		if err != nil {
+			return err
+		}
+		balance = bal + delta
+		e, err := NewOutboxEvent(EventBalanceChanged, uid, &BalanceChangedData{UID: uid, BTC: balance, Delta: delta, Reason: reason})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Set(balRef, map[string]interface{}{"BTC": balance}, firestore.MergeAll); err != nil {
+			return err
+		}
+		return f.appendEvents(tx, e)
+	})
+	return
+}
+
+// reserveReports collection of the proofs of reserves
+func (f *FireStoreStore) reserveReports() *firestore.CollectionRef {
+	return f.Client.Collection("reserve_reports")
+}
+
+// CreateReserveReport create a proof of reserves with the inclusion proofs of its accounts and set its generated id.
+// The proofs are written first so that a report is never published without them
+func (f *FireStoreStore) CreateReserveReport(r *ReserveReportSchema, proofs []*ReserveProofSchema) error {
+	ref := f.reserveReports().NewDoc()
+	// a batch is limited to 500 writes
+	for start := 0; start < len(proofs); start += 500 {
+		end := start + 500
+		if end > len(proofs) {
+			end = len(proofs)
+		}
+		b := f.Client.Batch()
+		for _, p := range proofs[start:end] {
+			b.Set(ref.Collection("proofs").Doc(p.UID), p)
+		}
+		if _, err := b.Commit(f.ctx); err != nil {
+			return err
+		}
+	}
+
+	r.ID = ref.ID
+	_, err := ref.Create(f.ctx, r)
+	return err
+}
+
+// FindReserveReport find a proof of reserves, the latest one if id is empty. Returns nil if there is none
+func (f *FireStoreStore) FindReserveReport(id string) (*ReserveReportSchema, error) {
+	var doc *firestore.DocumentSnapshot
+	if id == "" {
+		docs, err := f.reserveReports().OrderBy("created_at", firestore.Desc).Limit(1).Documents(f.ctx).GetAll()
+		if err != nil || len(docs) == 0 {
+			return nil, err
+		}
+		doc = docs[0]
+	} else {
+		d, err := f.reserveReports().Doc(id).Get(f.ctx)
+		if grpc.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		doc = d
+	}
+
+	var r *ReserveReportSchema
+	if err := doc.DataTo(&r); err != nil {
+		return nil, err
+	}
+	r.ID = doc.Ref.ID
+	return r, nil
+}
+
+// FindReserveProof find the inclusion proof of a user UID in a proof of reserves, nil if it isn't included
+func (f *FireStoreStore) FindReserveProof(report, uid string) (*ReserveProofSchema, error) {
+	doc, err := f.reserveReports().Doc(report).Collection("proofs").Doc(uid).Get(f.ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p *ReserveProofSchema
+	if err := doc.DataTo(&p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CreateAddressChallenge create an address challenge and set its generated id
+func (f *FireStoreStore) CreateAddressChallenge(c *AddressChallengeSchema) (err error) {
+	ref := f.Client.Collection("address_challenges").NewDoc()
+	c.ID = ref.ID
+	_, err = ref.Create(f.ctx, c)
+	return
+}
+
+// FindAddressChallenge find an address challenge, nil if it doesn't exist
+func (f *FireStoreStore) FindAddressChallenge(id string) (*AddressChallengeSchema, error) {
+	doc, err := f.Client.Collection("address_challenges").Doc(id).Get(f.ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c *AddressChallengeSchema
+	if err := doc.DataTo(&c); err != nil {
+		return nil, err
+	}
+	c.ID = doc.Ref.ID
+	return c, nil
+}
+
+// ErrChallengeUsed the challenge was already used to verify its address
+var ErrChallengeUsed = errors.New("challenge already used")
+
+// VerifyBtcAddress mark the address of a challenge as verified on the account of its user, a challenge is used once
+func (f *FireStoreStore) VerifyBtcAddress(c *AddressChallengeSchema, v *VerifiedAddressSchema) error {
+	ref := f.Client.Collection("address_challenges").Doc(c.ID)
+	verified := f.Client.Collection("btc_accounts").Doc(c.UID).Collection("verified_addresses").Doc(c.Address)
+	return f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		used, err := doc.DataAt("verified")
+		if err != nil {
+			return err
+		}
+		if used == true {
+			return ErrChallengeUsed
+		}
+
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "verified", Value: true},
+			{Path: "verified_at", Value: v.VerifiedAt},
+		}); err != nil {
+			return err
+		}
+		return tx.Set(verified, v)
+	})
+}
+
+// CreateInvoice create an invoice and index its address to the account of its user, set its generated id. It fails
+// if the address is already used
+func (f *FireStoreStore) CreateInvoice(i *InvoiceSchema) error {
+	ref := f.Client.Collection("invoices").NewDoc()
+	addrRef := f.Client.Collection("btc_addresses").Doc(i.Address)
+	i.ID = ref.ID
+	return f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		idx, err := tx.Get(addrRef)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		if idx.Exists() {
+			return ErrAddressTaken
+		}
+
+		if err := tx.Create(addrRef, map[string]interface{}{"uid": i.UID, "invoice": i.ID}); err != nil {
+			return err
+		}
+		return tx.Create(ref, i)
+	})
+}
+
+func invoiceFrom(doc *firestore.DocumentSnapshot) (*InvoiceSchema, error) {
+	var i *InvoiceSchema
+	if err := doc.DataTo(&i); err != nil {
+		return nil, err
+	}
+	i.ID = doc.Ref.ID
+	return i, nil
+}
+
+// FindInvoice find an invoice, nil if it doesn't exist
+func (f *FireStoreStore) FindInvoice(id string) (*InvoiceSchema, error) {
+	doc, err := f.Client.Collection("invoices").Doc(id).Get(f.ctx)
+	if grpc.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return invoiceFrom(doc)
+}
+
+// FindInvoices find the invoices of a user UID, or of every user if uid is empty
+func (f *FireStoreStore) FindInvoices(uid string) (is []*InvoiceSchema, err error) {
+	q := f.Client.Collection("invoices").Query
+	if uid != "" {
+		q = q.Where("uid", "==", uid)
+	}
+	iter := q.Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		i, errData := invoiceFrom(doc)
+		if errData != nil {
+			err = errData
+			return
+		}
+		is = append(is, i)
+	}
+
+	return
+}
+
+// FindInvoiceByAddress find the invoice paid to an address, nil if there is none
+func (f *FireStoreStore) FindInvoiceByAddress(address string) (*InvoiceSchema, error) {
+	docs, err := f.Client.Collection("invoices").Where("address", "==", address).Limit(1).Documents(f.ctx).GetAll()
+	if err != nil || len(docs) == 0 {
+		return nil, err
+	}
+	return invoiceFrom(docs[0])
+}
+
+// FindActiveInvoices find the invoices awaiting funds, and those with outputs in the mempool
+func (f *FireStoreStore) FindActiveInvoices() ([]*InvoiceSchema, error) {
+	var active []*InvoiceSchema
+	seen := make(map[string]bool)
+	for _, q := range []firestore.Query{
+		f.Client.Collection("invoices").Where("status", "in", []string{InvoiceOpen, InvoiceUnderpaid}),
+		f.Client.Collection("invoices").Where("pending", ">", 0),
+	} {
+		docs, err := q.Documents(f.ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			if seen[doc.Ref.ID] {
+				continue
+			}
+			seen[doc.Ref.ID] = true
+			i, err := invoiceFrom(doc)
+			if err != nil {
+				return nil, err
+			}
+			active = append(active, i)
+		}
+	}
+	return active, nil
+}
+
+// UpdateInvoice update an invoice with fn within a transaction, and return it updated
+func (f *FireStoreStore) UpdateInvoice(id string, fn func(i *InvoiceSchema) error) (*InvoiceSchema, error) {
+	ref := f.Client.Collection("invoices").Doc(id)
+	var i *InvoiceSchema
+	err := f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if i, err = invoiceFrom(doc); err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+		return tx.Set(ref, i)
+	})
+	return i, err
+}
+
+// GetAllInvoiceAddresses get the addresses of every invoice, with the uid of their account
+func (f *FireStoreStore) GetAllInvoiceAddresses() ([]*BtcAccountSchema, error) {
+	var accs []*BtcAccountSchema
+	iter := f.Client.Collection("invoices").Select("uid", "address").Documents(f.ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var i *InvoiceSchema
+		if err := doc.DataTo(&i); err != nil {
+			return nil, err
+		}
+		accs = append(accs, &BtcAccountSchema{UID: i.UID, Address: i.Address})
+	}
+	return accs, nil
+}
+
+// QuarantineBtcDeposit record a deposit sent from a blocklisted address without any event, mark its utxo as
+// quarantined and raise its screening alert. Returns the deposit if it was already recorded, leaving it untouched
+func (f *FireStoreStore) QuarantineBtcDeposit(t *BtcTransactionSchema, a *ScreeningAlertSchema) (existing *BtcTransactionSchema, err error) {
+	ref := f.Client.Collection("btc_transactions").Doc(t.DocID())
+	alertRef := f.Client.Collection("screening_alerts").Doc(t.DocID())
+	utxos := f.Client.Collection("btc_utxos").Where("txHash", "==", t.TxHash).Where("vout_idx", "==", t.VoutIdx)
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing = nil
+		doc, err := tx.Get(ref)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		if doc.Exists() {
+			if err := doc.DataTo(&existing); err != nil {
+				return err
+			}
+		}
+		// a rescan of the block saves the utxo again
+		us, err := tx.Documents(utxos).GetAll()
+		if err != nil {
+			return err
+		}
+		if existing != nil && !existing.Quarantined {
+			return nil
+		}
+		for _, u := range us {
+			if err := tx.Update(u.Ref, []firestore.Update{{Path: "quarantined", Value: true}}); err != nil {
+				return err
+			}
+		}
+		if existing != nil {
+			return nil
+		}
+
+		t.Quarantined = true
+		if err := tx.Create(ref, t); err != nil {
+			return err
+		}
+		return tx.Set(alertRef, a)
+	})
+	if err == nil && existing == nil {
+		a.ID = alertRef.ID
+	}
+	return
+}
+
+// CreateScreeningAlert save a screening alert, under its id if it has one
+func (f *FireStoreStore) CreateScreeningAlert(a *ScreeningAlertSchema) error {
+	ref := f.Client.Collection("screening_alerts").NewDoc()
+	if a.ID != "" {
+		ref = f.Client.Collection("screening_alerts").Doc(a.ID)
+	}
+	if _, err := ref.Set(f.ctx, a); err != nil {
+		return err
+	}
+	a.ID = ref.ID
+	return nil
+}
+
+// FindScreeningAlerts find the screening alerts of a status, all of them if status is empty, latest first
+func (f *FireStoreStore) FindScreeningAlerts(status string) (as []*ScreeningAlertSchema, err error) {
+	q := f.Client.Collection("screening_alerts").Query
+	if status != "" {
+		q = q.Where("status", "==", status)
+	}
+	iter := q.OrderBy("created_at", firestore.Desc).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var a *ScreeningAlertSchema
+		if err = doc.DataTo(&a); err != nil {
+			return
+		}
+		a.ID = doc.Ref.ID
+		as = append(as, a)
+	}
+
+	return
+}
+
+// ErrNotInReview the deposit is not waiting for a review
+var ErrNotInReview = errors.New("deposit is not in review")
+
+// FindHeldBtcTransactions find the unconfirmed deposits whose hold ends at or before the given height
+func (f *FireStoreStore) FindHeldBtcTransactions(h int) ([]*BtcTransactionSchema, error) {
+	q := f.Client.Collection("btc_transactions").Where("confirmed", "==", false).Where("hold_until", "<=", h)
+	return f.getBtcTransactions(q)
+}
+
+// FindBtcTransactionsInReview find the deposits waiting for a review, oldest first
+func (f *FireStoreStore) FindBtcTransactionsInReview() ([]*BtcTransactionSchema, error) {
+	q := f.Client.Collection("btc_transactions").Where("review", "==", ReviewPending).OrderBy("block_height", firestore.Asc)
+	return f.getBtcTransactions(q)
+}
+
+func (f *FireStoreStore) getBtcTransactions(q firestore.Query) (txs []*BtcTransactionSchema, err error) {
+	iter := q.Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var tx *BtcTransactionSchema
+		if err = doc.DataTo(&tx); err != nil {
+			return
+		}
+		tx.ID = doc.Ref.ID
+		txs = append(txs, tx)
+	}
+
+	return
+}
+
+// SumBtcDeposits sum the deposits received by a user UID between two times, quarantined ones excluded
+func (f *FireStoreStore) SumBtcDeposits(uid string, from, to time.Time) (float64, error) {
+	q := f.Client.Collection("btc_transactions").Where("uid", "==", uid).Where("direction", "==", DirectionIn).
+		Where("time", ">=", from).Where("time", "<=", to)
+	txs, err := f.getBtcTransactions(q)
+	if err != nil {
+		return 0, err
+	}
+	sum := 0.0
+	for _, t := range txs {
+		if !t.Quarantined {
+			sum += t.Amount
+		}
+	}
+	return sum, nil
+}
+
+// FindNewSenders find among addresses the ones a user UID never received a deposit from
+func (f *FireStoreStore) FindNewSenders(uid string, addrs []string) ([]string, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	senders := f.Client.Collection("btc_accounts").Doc(uid).Collection("senders")
+	refs := make([]*firestore.DocumentRef, len(addrs))
+	for i, a := range addrs {
+		refs[i] = senders.Doc(a)
+	}
+	docs, err := f.Client.GetAll(f.ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	var unseen []string
+	for i, doc := range docs {
+		if !doc.Exists() {
+			unseen = append(unseen, addrs[i])
+		}
+	}
+	return unseen, nil
+}
+
+// SaveSenders record the addresses a user UID received a deposit from
+func (f *FireStoreStore) SaveSenders(uid string, ss []*SenderSchema) error {
+	senders := f.Client.Collection("btc_accounts").Doc(uid).Collection("senders")
+	for i := 0; i < len(ss); i += 500 {
+		end := i + 500
+		if end > len(ss) {
+			end = len(ss)
+		}
+		batch := f.Client.Batch()
+		for _, s := range ss[i:end] {
+			batch.Set(senders.Doc(s.Address), s)
+		}
+		if _, err := batch.Commit(f.ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReviewBtcDeposit record the review of a deposit waiting for one. An approved deposit is held until it has the given
+// number of confirmations, a rejected one is never credited
+func (f *FireStoreStore) ReviewBtcDeposit(id, review, reviewer, reason string, confirmations int) (t *BtcTransactionSchema, err error) {
+	ref := f.Client.Collection("btc_transactions").Doc(id)
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&t); err != nil {
+			return err
+		}
+		t.ID = doc.Ref.ID
+		if t.Review != ReviewPending {
+			return ErrNotInReview
+		}
+
+		t.Review = review
+		t.ReviewedBy = reviewer
+		t.ReviewReason = reason
+		updates := []firestore.Update{
+			{Path: "review", Value: review},
+			{Path: "reviewed_by", Value: reviewer},
+			{Path: "review_reason", Value: reason},
+		}
+		if review == ReviewApproved {
+			t.HoldUntil = t.BlockHeight + confirmations
+			updates = append(updates, firestore.Update{Path: "hold_until", Value: t.HoldUntil})
+		}
+		return tx.Update(ref, updates)
+	})
+	return
+}
+
+// ErrAccountClosed the account is closed and its status can't change anymore
+var ErrAccountClosed = errors.New("account is closed")
+
+// ErrStatusUnchanged the account already has the requested status
+var ErrStatusUnchanged = errors.New("account already has this status")
+
+// UpdateBtcAccountStatus change the status of an account and record the change in its audit trail
+func (f *FireStoreStore) UpdateBtcAccountStatus(a *AccountAuditSchema) (acc *BtcAccountSchema, err error) {
+	accRef := f.Client.Collection("btc_accounts").Doc(a.UID)
+	auditRef := accRef.Collection("audit").NewDoc()
+	err = f.Client.RunTransaction(f.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(accRef)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&acc); err != nil {
+			return err
+		}
+		acc.UID = a.UID
+		if acc.Status == AccountClosed {
+			return ErrAccountClosed
+		}
+		if acc.Status == a.Status || (acc.Active() && a.Status == AccountActive) {
+			return ErrStatusUnchanged
+		}
+
+		acc.Status = a.Status
+		if err := tx.Update(accRef, []firestore.Update{{Path: "status", Value: a.Status}}); err != nil {
+			return err
+		}
+		return tx.Create(auditRef, a)
+	})
+	if err == nil {
+		a.ID = auditRef.ID
+	}
+	return
+}
+
+// FindAccountAudit find the audit trail of an account, latest first
+func (f *FireStoreStore) FindAccountAudit(uid string) (as []*AccountAuditSchema, err error) {
+	iter := f.Client.Collection("btc_accounts").Doc(uid).Collection("audit").OrderBy("created_at", firestore.Desc).Documents(f.ctx)
+	for {
+		doc, errIter := iter.Next()
+		if errIter == iterator.Done {
+			break
+		}
+		if errIter != nil {
+			err = errIter
+			return
+		}
+		var a *AccountAuditSchema
+		if err = doc.DataTo(&a); err != nil {
+			return
+		}
+		a.ID = doc.Ref.ID
+		as = append(as, a)
+	}
+
 	return
 }
@@ -1,22 +1,102 @@
 package store
 
-import "time"
+import (
+	"strconv"
+	"time"
+
+	"github.com/SoteriaTech/blockchain-functions/reserves"
+	"github.com/SoteriaTech/blockchain-functions/risk"
+)
 
 //BtcAccountSchema firestore schema of a bitcoin account
 type BtcAccountSchema struct {
 	UID     string  `json:"uid"`
 	Address string  `json:"address"`
 	Balance float64 `json:"BTC"`
+	Status  string  `firestore:"status,omitempty" json:"status,omitempty"`
+}
+
+// Status of a btc account, accounts recorded before statuses existed are active
+const (
+	AccountActive = "active"
+	AccountFrozen = "frozen"
+	// AccountClosed accounts are closed for good
+	AccountClosed = "closed"
+)
+
+// Active whether deposits are credited to the account and withdrawals made from it
+func (a *BtcAccountSchema) Active() bool {
+	return a.Status == "" || a.Status == AccountActive
+}
+
+// Actions recorded in the audit trail of an account
+const (
+	AuditFreeze   = "freeze"
+	AuditUnfreeze = "unfreeze"
+	AuditClose    = "close"
+	// AuditDepositReview deposits confirmed while the account was not active are queued for review
+	AuditDepositReview = "deposit_review"
+)
+
+// AccountAuditSchema firestore schema of an entry of the audit trail of an account: a change of its status by an
+// admin, or a deposit withheld because of it
+type AccountAuditSchema struct {
+	ID     string `firestore:"-" json:"id"`
+	UID    string `firestore:"uid" json:"uid"`
+	Action string `firestore:"action" json:"action"`
+	// Status of the account after the action
+	Status string `firestore:"status" json:"status"`
+	Reason string `firestore:"reason" json:"reason"`
+	// Actor uid of the admin, empty for the scan
+	Actor     string    `firestore:"actor,omitempty" json:"actor,omitempty"`
+	Deposit   string    `firestore:"deposit,omitempty" json:"deposit,omitempty"`
+	CreatedAt time.Time `firestore:"created_at" json:"created_at"`
 }
 
 // BtcTransactionSchema firestore schema of a btc transaction
 type BtcTransactionSchema struct {
+	ID          string  `firestore:"-"`
 	Amount      float64 `firestore:"amount"`
 	To          string  `firestore:"to"`
 	TxHash      string  `firestore:"txHash"`
 	VoutIdx     int     `firestore:"vout_idx"`
 	BlockHeight int     `firestore:"block_height"`
 	Confirmed   bool    `firestore:"confirmed"`
+	// Direction, UID and Time are empty for deposits recorded before withdrawals existed
+	Direction string    `firestore:"direction,omitempty"`
+	UID       string    `firestore:"uid,omitempty"`
+	Time      time.Time `firestore:"time,omitempty"`
+	// Quarantined deposits were sent from a blocklisted address, they are recorded but never confirmed nor credited
+	Quarantined bool `firestore:"quarantined,omitempty"`
+	// Risk outcome of the rules evaluated when the deposit was detected. Held deposits are confirmed once the block
+	// of height HoldUntil is mined, deposits in review once their review is approved
+	Risk         *risk.Outcome `firestore:"risk,omitempty"`
+	HoldUntil    int           `firestore:"hold_until,omitempty"`
+	Review       string        `firestore:"review,omitempty"`
+	ReviewedBy   string        `firestore:"reviewed_by,omitempty"`
+	ReviewReason string        `firestore:"review_reason,omitempty"`
+}
+
+// DocID document id of a transaction, its hash and output index. Withdrawals recorded with the output paying their
+// destination are suffixed, the deposit of that output to one of our accounts has its own document
+func (t *BtcTransactionSchema) DocID() string {
+	if t.Direction == DirectionOut && t.VoutIdx >= 0 {
+		return t.TxHash + strconv.Itoa(t.VoutIdx) + "_out"
+	}
+	return t.TxHash + strconv.Itoa(t.VoutIdx)
+}
+
+// Status of the review of a deposit
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// BtcTransactionCursor position of a transaction in the history, ordered by block height then id
+type BtcTransactionCursor struct {
+	BlockHeight int
+	ID          string
 }
 
 // ChainStateSchema firestore schema of a chain state
@@ -28,3 +108,476 @@ type ChainStateSchema struct {
 	Height      int       `firestore:"height"`
 	TxIndexes   []int     `firestore:"txIndexes"`
 }
+
+// BtcUtxoSchema firestore schema of an unspent (or spent) output owned by an account
+type BtcUtxoSchema struct {
+	UID         string `firestore:"uid" json:"uid"`
+	Address     string `firestore:"address" json:"address"`
+	TxHash      string `firestore:"txHash" json:"tx_hash"`
+	TxIndex     string `firestore:"tx_index" json:"tx_index"`
+	VoutIdx     int    `firestore:"vout_idx" json:"vout_idx"`
+	Value       int64  `firestore:"value" json:"value"`
+	Script      string `firestore:"script" json:"script"`
+	ScriptType  string `firestore:"script_type" json:"script_type"`
+	BlockHeight int    `firestore:"block_height" json:"block_height"`
+	Spent       bool   `firestore:"spent" json:"spent"`
+	SpentHeight int    `firestore:"spent_height" json:"spent_height,omitempty"`
+	SpentTxHash string `firestore:"spent_txHash" json:"spent_tx_hash,omitempty"`
+	// Quarantined outputs of deposits from blocklisted addresses are not spent by withdrawals
+	Quarantined bool `firestore:"quarantined,omitempty" json:"quarantined,omitempty"`
+	// ReservedBy id of the withdrawal request spending the output, until it fails or is cancelled
+	ReservedBy string `firestore:"reserved_by,omitempty" json:"reserved_by,omitempty"`
+}
+
+// ID document id of an utxo, outputs are identified by the index of their transaction and their position
+func (u *BtcUtxoSchema) ID() string {
+	return UtxoID(u.TxIndex, u.VoutIdx)
+}
+
+// UtxoID build the document id of an utxo
+func UtxoID(txIndex string, n int) string {
+	return txIndex + ":" + strconv.Itoa(n)
+}
+
+// Status of a broadcast transaction
+const (
+	BroadcastPending = "pending"
+	BroadcastMined   = "mined"
+	// BroadcastDropped not mined before the broadcast timeout, still settled if it is mined later
+	BroadcastDropped = "dropped"
+)
+
+// BtcBroadcastSchema firestore schema of a transaction we broadcast, tracked until it is mined
+type BtcBroadcastSchema struct {
+	UID         string    `firestore:"uid" json:"uid"`
+	TxHash      string    `firestore:"txHash" json:"tx_hash"`
+	RawTx       string    `firestore:"raw_tx" json:"raw_tx"`
+	Fee         int64     `firestore:"fee" json:"fee"`
+	Status      string    `firestore:"status" json:"status"`
+	BroadcastAt time.Time `firestore:"broadcast_at" json:"broadcast_at"`
+	BlockHeight int       `firestore:"block_height" json:"block_height,omitempty"`
+}
+
+// BtcBlockSchema firestore schema of a scanned block, its hash tells whether a reorg replaced it
+type BtcBlockSchema struct {
+	Height    int       `firestore:"height"`
+	Hash      string    `firestore:"hash"`
+	PrevHash  string    `firestore:"prev_hash"`
+	ScannedAt time.Time `firestore:"scanned_at"`
+}
+
+// BtcFeeStatsSchema firestore schema of the fee rates (sat/vB) paid in a scanned block, summarized as quantiles
+type BtcFeeStatsSchema struct {
+	Height    int       `firestore:"height"`
+	TxCount   int       `firestore:"tx_count"`
+	Quantiles []float64 `firestore:"quantiles"`
+}
+
+// BtcFeeEstimateSchema firestore schema of the cached fee estimates of a chain
+type BtcFeeEstimateSchema struct {
+	Fast        float64   `firestore:"fast" json:"fast"`
+	Normal      float64   `firestore:"normal" json:"normal"`
+	Slow        float64   `firestore:"slow" json:"slow"`
+	Height      int       `firestore:"height" json:"height"`
+	LastUpdated time.Time `firestore:"last_updated" json:"last_updated"`
+}
+
+// Direction of a btc transaction relative to the account
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// Status of a withdrawal along its lifecycle
+const (
+	WithdrawalRequested   = "requested"
+	WithdrawalRiskChecked = "risk_checked"
+	WithdrawalApproved    = "approved"
+	WithdrawalSigned      = "signed"
+	WithdrawalBroadcast   = "broadcast"
+	WithdrawalConfirmed   = "confirmed"
+	WithdrawalFailed      = "failed"
+	WithdrawalCancelled   = "cancelled"
+)
+
+// BtcWithdrawalSchema firestore schema of a withdrawal request. Amounts are in satoshis, the hold in btc
+type BtcWithdrawalSchema struct {
+	ID                string    `firestore:"-" json:"id"`
+	UID               string    `firestore:"uid" json:"uid"`
+	To                string    `firestore:"to" json:"to"`
+	Amount            int64     `firestore:"amount" json:"amount"`
+	Fee               int64     `firestore:"fee" json:"fee"`
+	FeeRate           int64     `firestore:"fee_rate" json:"fee_rate"`
+	Hold              float64   `firestore:"hold" json:"hold"`
+	Psbt              string    `firestore:"psbt" json:"psbt"`
+	Inputs            []string  `firestore:"inputs" json:"inputs"`
+	Status            string    `firestore:"status" json:"status"`
+	RequiredApprovals int       `firestore:"required_approvals" json:"required_approvals"`
+	Approvals         []string  `firestore:"approvals" json:"approvals"`
+	TxHash            string    `firestore:"txHash" json:"tx_hash,omitempty"`
+	BlockHeight       int       `firestore:"block_height" json:"block_height,omitempty"`
+	Reason            string    `firestore:"reason" json:"reason,omitempty"`
+	CreatedAt         time.Time `firestore:"created_at" json:"created_at"`
+	UpdatedAt         time.Time `firestore:"updated_at" json:"updated_at"`
+}
+
+// Status of an address backfill
+const (
+	BackfillPending = "pending"
+	BackfillRunning = "running"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+// BtcBackfillSchema firestore schema of the backfill of the history of an address registered mid-chain
+type BtcBackfillSchema struct {
+	UID          string    `firestore:"uid" json:"uid"`
+	Address      string    `firestore:"address" json:"address"`
+	Status       string    `firestore:"status" json:"status"`
+	Transactions int       `firestore:"transactions" json:"transactions"`
+	Error        string    `firestore:"error" json:"error,omitempty"`
+	CreatedAt    time.Time `firestore:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `firestore:"updated_at" json:"updated_at"`
+}
+
+// Status of a conversion request, requests created without status are pending
+const (
+	ConvertPending   = "pending"
+	ConvertCompleted = "completed"
+	ConvertRejected  = "rejected"
+)
+
+// ConvertRequestSchema firestore schema of a request to convert an amount of a balance into another currency at a
+// quoted Rate (units of To for one From), executed if the market rate is within Slippage (relative) of the quote
+type ConvertRequestSchema struct {
+	ID           string    `firestore:"-" json:"id"`
+	UID          string    `firestore:"-" json:"uid"`
+	From         string    `firestore:"from" json:"from"`
+	To           string    `firestore:"to" json:"to"`
+	Amount       float64   `firestore:"amount" json:"amount"`
+	Rate         float64   `firestore:"rate" json:"rate"`
+	Slippage     float64   `firestore:"slippage" json:"slippage"`
+	Status       string    `firestore:"status" json:"status"`
+	Reason       string    `firestore:"reason" json:"reason,omitempty"`
+	ExecutedRate float64   `firestore:"executed_rate" json:"executed_rate,omitempty"`
+	Received     float64   `firestore:"received" json:"received,omitempty"`
+	CreatedAt    time.Time `firestore:"created_at" json:"created_at"`
+	ProcessedAt  time.Time `firestore:"processed_at" json:"processed_at,omitempty"`
+}
+
+// ConvertRequestCursor position of a conversion request in the history, ordered by creation time then id
+type ConvertRequestCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// BalanceSnapshotSchema firestore schema of the balance of an account at a given block, valued in fiat currencies
+type BalanceSnapshotSchema struct {
+	UID    string             `firestore:"uid" json:"uid"`
+	Height int                `firestore:"height" json:"height"`
+	Time   time.Time          `firestore:"time" json:"time"`
+	BTC    float64            `firestore:"BTC" json:"BTC"`
+	Values map[string]float64 `firestore:"values" json:"values"`
+}
+
+// Types of the events sent to webhooks
+const (
+	DepositDetected  = "deposit.detected"
+	DepositConfirmed = "deposit.confirmed"
+	DepositReversed  = "deposit.reversed"
+)
+
+// WebhookSchema firestore schema of an endpoint receiving the events of the given types, signed with its secret
+type WebhookSchema struct {
+	ID        string    `firestore:"-" json:"id"`
+	URL       string    `firestore:"url" json:"url"`
+	Secret    string    `firestore:"secret" json:"secret,omitempty"`
+	Events    []string  `firestore:"events" json:"events"`
+	Active    bool      `firestore:"active" json:"active"`
+	CreatedAt time.Time `firestore:"created_at" json:"created_at"`
+	RotatedAt time.Time `firestore:"rotated_at" json:"rotated_at"`
+}
+
+// Status of the delivery of an event to a webhook
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead deliveries that failed too many times, kept as dead-letters until replayed
+	DeliveryDead = "dead"
+)
+
+// WebhookDeliverySchema firestore schema of the delivery of an event to a webhook
+type WebhookDeliverySchema struct {
+	ID            string    `firestore:"-" json:"id"`
+	WebhookID     string    `firestore:"webhook_id" json:"webhook_id"`
+	EventID       string    `firestore:"event_id" json:"event_id"`
+	Type          string    `firestore:"type" json:"type"`
+	Payload       string    `firestore:"payload" json:"payload"`
+	Status        string    `firestore:"status" json:"status"`
+	Attempts      int       `firestore:"attempts" json:"attempts"`
+	NextAttemptAt time.Time `firestore:"next_attempt_at" json:"next_attempt_at"`
+	LastError     string    `firestore:"last_error" json:"last_error,omitempty"`
+	CreatedAt     time.Time `firestore:"created_at" json:"created_at"`
+	DeliveredAt   time.Time `firestore:"delivered_at" json:"delivered_at"`
+}
+
+// Types of the domain events published through the outbox, named after their topic
+const (
+	EventDepositDetected   = "DepositDetected"
+	EventDepositConfirmed  = "DepositConfirmed"
+	EventBalanceChanged    = "BalanceChanged"
+	EventChainHeadAdvanced = "ChainHeadAdvanced"
+)
+
+// OutboxEventSchema firestore schema of a domain event written along the state change it describes, until it is
+// published. Events of the same Key are published in order of creation then Seq
+type OutboxEventSchema struct {
+	ID          string    `firestore:"-" json:"id"`
+	Type        string    `firestore:"type" json:"type"`
+	Key         string    `firestore:"key" json:"key"`
+	Payload     string    `firestore:"payload" json:"payload"`
+	Seq         int       `firestore:"seq" json:"seq"`
+	CreatedAt   time.Time `firestore:"created_at,serverTimestamp" json:"created_at"`
+	Published   bool      `firestore:"published" json:"published"`
+	PublishedAt time.Time `firestore:"published_at" json:"published_at"`
+}
+
+// DepositEventData payload of the DepositDetected and DepositConfirmed events
+type DepositEventData struct {
+	ID          string  `json:"id"`
+	UID         string  `json:"uid"`
+	TxHash      string  `json:"tx_hash"`
+	VoutIdx     int     `json:"vout_idx"`
+	Address     string  `json:"address"`
+	Amount      float64 `json:"amount"`
+	BlockHeight int     `json:"block_height"`
+	Confirmed   bool    `json:"confirmed"`
+}
+
+// BalanceChangedData payload of the BalanceChanged events, balances in btc
+type BalanceChangedData struct {
+	UID    string  `json:"uid"`
+	BTC    float64 `json:"BTC"`
+	Delta  float64 `json:"delta"`
+	Reason string  `json:"reason"`
+}
+
+// ChainHeadAdvancedData payload of the ChainHeadAdvanced events
+type ChainHeadAdvancedData struct {
+	Chain  string `json:"chain"`
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+	Time   int    `json:"time"`
+}
+
+// Status of a balance discrepancy
+const (
+	DiscrepancyOpen      = "open"
+	DiscrepancyCorrected = "corrected"
+)
+
+// ReconciliationSchema firestore schema of a run of the reconciliation of the stored balances with the chain
+type ReconciliationSchema struct {
+	ID            string                      `firestore:"-" json:"id"`
+	Accounts      int                         `firestore:"accounts" json:"accounts"`
+	Discrepancies []*BalanceDiscrepancySchema `firestore:"-" json:"discrepancies"`
+	Open          int                         `firestore:"open" json:"open"`
+	Corrected     int                         `firestore:"corrected" json:"corrected"`
+	// Failed accounts whose balance couldn't be fetched from the provider
+	Failed    int       `firestore:"failed" json:"failed"`
+	CreatedAt time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// BalanceDiscrepancySchema firestore schema of an account whose balances disagree during a reconciliation, in btc.
+// Chain is the balance of the provider less the deposits not confirmed yet, the stored balance is expected to be
+// Chain plus the net amount Converted to btc
+type BalanceDiscrepancySchema struct {
+	ID         string    `firestore:"-" json:"id"`
+	Run        string    `firestore:"run" json:"run"`
+	UID        string    `firestore:"uid" json:"uid"`
+	Address    string    `firestore:"address" json:"address"`
+	Stored     float64   `firestore:"stored" json:"stored"`
+	Ledger     float64   `firestore:"ledger" json:"ledger"`
+	Chain      float64   `firestore:"chain" json:"chain"`
+	Pending    float64   `firestore:"pending" json:"pending"`
+	Converted  float64   `firestore:"converted" json:"converted"`
+	InFlight   float64   `firestore:"in_flight" json:"in_flight"`
+	Status     string    `firestore:"status" json:"status"`
+	Adjustment string    `firestore:"adjustment" json:"adjustment,omitempty"`
+	CreatedAt  time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// LedgerAdjustmentSchema firestore schema of a correction of the btc balance of an account, outside of any transaction
+type LedgerAdjustmentSchema struct {
+	ID          string    `firestore:"-" json:"id"`
+	UID         string    `firestore:"uid" json:"uid"`
+	Amount      float64   `firestore:"amount" json:"amount"`
+	Before      float64   `firestore:"before" json:"before"`
+	After       float64   `firestore:"after" json:"after"`
+	Reason      string    `firestore:"reason" json:"reason"`
+	Discrepancy string    `firestore:"discrepancy" json:"discrepancy"`
+	CreatedAt   time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// ReserveReportSchema firestore schema of a signed proof of reserves at a block height, amounts in satoshis.
+// Liabilities is the sum of the merkle sum tree of the btc balances whose root is Root, Assets the balance of our
+// addresses at the block
+type ReserveReportSchema struct {
+	ID          string    `firestore:"-" json:"id"`
+	Height      int       `firestore:"height" json:"height"`
+	BlockHash   string    `firestore:"block_hash" json:"block_hash"`
+	Root        string    `firestore:"root" json:"root"`
+	Liabilities int64     `firestore:"liabilities" json:"liabilities"`
+	Assets      int64     `firestore:"assets" json:"assets"`
+	Accounts    int       `firestore:"accounts" json:"accounts"`
+	Addresses   int       `firestore:"addresses" json:"addresses"`
+	PublicKey   string    `firestore:"public_key" json:"public_key"`
+	Signature   string    `firestore:"signature" json:"signature"`
+	CreatedAt   time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// Statement statement signed by the report
+func (r *ReserveReportSchema) Statement() *reserves.Statement {
+	return &reserves.Statement{
+		Height:      r.Height,
+		BlockHash:   r.BlockHash,
+		Root:        r.Root,
+		Liabilities: r.Liabilities,
+		Assets:      r.Assets,
+		Accounts:    r.Accounts,
+		Addresses:   r.Addresses,
+		Time:        r.CreatedAt,
+	}
+}
+
+// ReserveProofSchema firestore schema of the inclusion proof of the balance of an account in a proof of reserves
+type ReserveProofSchema struct {
+	UID     string               `firestore:"uid" json:"uid"`
+	Nonce   string               `firestore:"nonce" json:"nonce"`
+	Balance int64                `firestore:"balance" json:"balance"`
+	Leaf    string               `firestore:"leaf" json:"leaf"`
+	Path    []*reserves.Step     `firestore:"path" json:"path"`
+	Report  *ReserveReportSchema `firestore:"-" json:"report"`
+}
+
+// AddressChallengeSchema firestore schema of a challenge proving that a user controls an address by signing Message
+type AddressChallengeSchema struct {
+	ID         string    `firestore:"-" json:"id"`
+	UID        string    `firestore:"uid" json:"uid"`
+	Address    string    `firestore:"address" json:"address"`
+	Nonce      string    `firestore:"nonce" json:"nonce"`
+	Message    string    `firestore:"message" json:"message"`
+	Verified   bool      `firestore:"verified" json:"verified"`
+	CreatedAt  time.Time `firestore:"created_at" json:"created_at"`
+	ExpiresAt  time.Time `firestore:"expires_at" json:"expires_at"`
+	VerifiedAt time.Time `firestore:"verified_at" json:"verified_at,omitempty"`
+}
+
+// VerifiedAddressSchema firestore schema of an address its account proved to control, with a signature of the
+// given format
+type VerifiedAddressSchema struct {
+	Address    string    `firestore:"address" json:"address"`
+	Format     string    `firestore:"format" json:"format"`
+	Challenge  string    `firestore:"challenge" json:"challenge"`
+	VerifiedAt time.Time `firestore:"verified_at" json:"verified_at"`
+}
+
+// Status of an invoice
+const (
+	InvoiceOpen      = "open"
+	InvoicePaid      = "paid"
+	InvoiceUnderpaid = "underpaid"
+	InvoiceOverpaid  = "overpaid"
+	// InvoiceExpired invoices not fully paid before they expired, a later payment still updates them
+	InvoiceExpired = "expired"
+)
+
+// InvoiceSchema firestore schema of a request of Amount satoshis paid to an address dedicated to the invoice.
+// Outputs are the outputs received in blocks and Mempool those waiting in the mempool, by transaction id
+type InvoiceSchema struct {
+	ID        string           `firestore:"-" json:"id"`
+	UID       string           `firestore:"uid" json:"uid"`
+	Address   string           `firestore:"address" json:"address"`
+	Amount    int64            `firestore:"amount" json:"amount"`
+	Memo      string           `firestore:"memo" json:"memo,omitempty"`
+	URI       string           `firestore:"uri" json:"uri"`
+	Status    string           `firestore:"status" json:"status"`
+	Received  int64            `firestore:"received" json:"received"`
+	Pending   int64            `firestore:"pending" json:"pending"`
+	Outputs   map[string]int64 `firestore:"outputs" json:"-"`
+	Mempool   map[string]int64 `firestore:"mempool" json:"-"`
+	CreatedAt time.Time        `firestore:"created_at" json:"created_at"`
+	ExpiresAt time.Time        `firestore:"expires_at" json:"expires_at"`
+	UpdatedAt time.Time        `firestore:"updated_at" json:"updated_at"`
+}
+
+// Active whether the invoice still awaits funds or has outputs in the mempool
+func (i *InvoiceSchema) Active() bool {
+	return i.Status == InvoiceOpen || i.Status == InvoiceUnderpaid || i.Pending > 0
+}
+
+// Settle compute the amounts received and the status of the invoice from its outputs at time t. The status only
+// counts the outputs received in blocks, those in the mempool are reported as pending
+func (i *InvoiceSchema) Settle(t time.Time) {
+	i.Received, i.Pending = 0, 0
+	for _, v := range i.Outputs {
+		i.Received += v
+	}
+	for id, v := range i.Mempool {
+		if _, mined := i.Outputs[id]; !mined {
+			i.Pending += v
+		}
+	}
+
+	switch {
+	case i.Received == i.Amount:
+		i.Status = InvoicePaid
+	case i.Received > i.Amount:
+		i.Status = InvoiceOverpaid
+	case t.After(i.ExpiresAt):
+		i.Status = InvoiceExpired
+	case i.Received == 0:
+		i.Status = InvoiceOpen
+	default:
+		i.Status = InvoiceUnderpaid
+	}
+	i.UpdatedAt = t
+}
+
+// Kind of the operation a screening alert was raised on
+const (
+	ScreenedDeposit    = "deposit"
+	ScreenedWithdrawal = "withdrawal"
+	// ReorgedDeposit deposit credited in a block a reorg replaced, it isn't reversed automatically
+	ReorgedDeposit = "reorged_deposit"
+)
+
+// Status of a screening alert
+const (
+	AlertOpen = "open"
+)
+
+// ScreeningAlertSchema firestore schema of an alert raised when a deposit was sent from, or a withdrawal to, a
+// blocklisted address, or when a credited deposit was reorged out, kept for review
+type ScreeningAlertSchema struct {
+	ID      string `firestore:"-" json:"id"`
+	Kind    string `firestore:"kind" json:"kind"`
+	UID     string `firestore:"uid" json:"uid"`
+	Address string `firestore:"address" json:"address"`
+	// Source list the address is blocklisted by, "reorg" for reorged deposits
+	Source string `firestore:"source" json:"source"`
+	// Amount in satoshis of the deposit or the withdrawal
+	Amount     int64     `firestore:"amount" json:"amount"`
+	TxHash     string    `firestore:"txHash,omitempty" json:"tx_hash,omitempty"`
+	VoutIdx    int       `firestore:"vout_idx,omitempty" json:"vout_idx,omitempty"`
+	Withdrawal string    `firestore:"withdrawal,omitempty" json:"withdrawal,omitempty"`
+	Status     string    `firestore:"status" json:"status"`
+	CreatedAt  time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// SenderSchema firestore schema of an address an account received a deposit from, first seen in transaction TxHash
+type SenderSchema struct {
+	Address   string    `firestore:"address"`
+	TxHash    string    `firestore:"txHash"`
+	FirstSeen time.Time `firestore:"first_seen"`
+}
@@ -7,10 +7,54 @@ import (
 	"cloud.google.com/go/errorreporting"
 )
 
-// ErrorService structure of a custom error that contains code and an error
+// Machine-readable error codes of the error envelope
+const (
+	CodeInvalidArgument  = "invalid_argument"
+	CodeUnauthenticated  = "unauthenticated"
+	CodePermissionDenied = "permission_denied"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeProviderError    = "provider_error"
+	CodeInternal         = "internal"
+)
+
+var defaultReasons = map[int]string{
+	400: CodeInvalidArgument,
+	401: CodeUnauthenticated,
+	403: CodePermissionDenied,
+	404: CodeNotFound,
+	409: CodeConflict,
+	502: CodeProviderError,
+}
+
+// ErrorService structure of a custom error that contains code and an error.
+// Reason is the machine-readable code of the error, derived from the http code if empty
 type ErrorService struct {
-	Code int
-	Err  error
+	Code   int
+	Err    error
+	Reason string
+}
+
+// ErrorEnvelope body of every error response
+type ErrorEnvelope struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// Envelope get the error envelope of the error
+func (e *ErrorService) Envelope() *ErrorEnvelope {
+	return &ErrorEnvelope{Error: e.Err.Error(), Code: ReasonOf(e.Code, e.Reason)}
+}
+
+// ReasonOf get the machine-readable code of an error from its http code, unless a reason is given
+func ReasonOf(code int, reason string) string {
+	if reason != "" {
+		return reason
+	}
+	if r, ok := defaultReasons[code]; ok {
+		return r
+	}
+	return CodeInternal
 }
 
 // ErrorReporter structure of the ErrorReporter instance
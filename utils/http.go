@@ -2,21 +2,33 @@ package utils
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 )
 
 const jsonContentType = "application/json"
 
+// Request interface of the typed request of an HTTP function
+type Request interface {
+	Validate() error
+}
+
 // RespondJSON send Response with Json content
 func RespondJSON(w http.ResponseWriter, code int, payload interface{}) {
-	w.WriteHeader(code)
 	w.Header().Set("content-type", jsonContentType)
+	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(payload)
 }
 
 // RespondJSONWithError send a response that container an error message
 func RespondJSONWithError(w http.ResponseWriter, code int, message string) {
-	RespondJSON(w, code, map[string]string{"error": message})
+	RespondJSON(w, code, &ErrorEnvelope{Error: message, Code: ReasonOf(code, "")})
+}
+
+// RespondError send a response with the error envelope of an error
+func RespondError(w http.ResponseWriter, e *ErrorService) {
+	RespondJSON(w, e.Code, e.Envelope())
 }
 
 // RequestData parse data from http request
@@ -27,3 +39,17 @@ func RequestData(r *http.Request) (map[string]string, error) {
 	}
 	return data, nil
 }
+
+// DecodeRequest decode the json body of a request into a typed request and validate it. An empty body
+// decodes into the zero request
+func DecodeRequest(r *http.Request, req Request) *ErrorService {
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+			return &ErrorService{Code: 400, Err: fmt.Errorf("malformed request: %v", err)}
+		}
+	}
+	if err := req.Validate(); err != nil {
+		return &ErrorService{Code: 400, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of a webhook request
+const (
+	EventHeader     = "X-Soteria-Event"
+	EventIDHeader   = "X-Soteria-Event-Id"
+	TimestampHeader = "X-Soteria-Timestamp"
+	SignatureHeader = "X-Soteria-Signature"
+)
+
+// sendTimeout time after which an endpoint is considered unavailable
+const sendTimeout = 10 * time.Second
+
+// maxBackoff maximum delay between two attempts
+const maxBackoff = 24 * time.Hour
+
+// Sender structure of the webhook sender
+type Sender struct {
+	*http.Client
+}
+
+// Webhooks instance of the webhook sender
+var Webhooks *Sender
+
+// InitSender initialize the instance of the webhook sender
+func InitSender() {
+	Webhooks = &Sender{Client: &http.Client{Timeout: sendTimeout}}
+}
+
+// Send post a signed event to an endpoint. The event id is the idempotency key of the endpoint
+func (s *Sender) Send(url, secret, eventType, eventID string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	t := time.Now()
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(EventIDHeader, eventID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(t.Unix(), 10))
+	req.Header.Set(SignatureHeader, "v1="+Sign(secret, t, body))
+
+	rsp, err := s.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.Status[0] != '2' {
+		data, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("expected status 2xx, got %s: %s", rsp.Status, string(data))
+	}
+	return nil
+}
+
+// Sign hex encoded HMAC-SHA256 of the timestamp and the body of a request, as "<unix timestamp>.<body>"
+func Sign(secret string, t time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(t.Unix(), 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generate a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Backoff delay before the next attempt after the given number of failed attempts, doubling from base
+func Backoff(base time.Duration, attempts int) time.Duration {
+	d := base
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
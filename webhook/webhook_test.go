@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	ts := time.Unix(1618000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+
+	tests := []struct {
+		name   string
+		secret string
+		t      time.Time
+		body   []byte
+		valid  bool
+	}{
+		{"same request", "whsec_test", ts, body, true},
+		{"other secret", "whsec_other", ts, body, false},
+		{"other timestamp", "whsec_test", ts.Add(time.Second), body, false},
+		{"other body", "whsec_test", ts, []byte(`{"id":"evt_2"}`), false},
+	}
+	want := "d1e334beb2429237f097a00a975db11ebc0112866eb35d1027f21af312323deb"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.t, tt.body); (got == want) != tt.valid {
+				t.Fatalf("signature = %s, want valid %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		base     time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{time.Minute, 0, time.Minute},
+		{time.Minute, 1, time.Minute},
+		{time.Minute, 2, 2 * time.Minute},
+		{time.Minute, 5, 16 * time.Minute},
+		{time.Minute, 11, 1024 * time.Minute},
+		// the delay is capped, even when doubling would overflow
+		{time.Minute, 12, maxBackoff},
+		{time.Minute, 1000, maxBackoff},
+		{48 * time.Hour, 1, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.base, tt.attempts); got != tt.want {
+			t.Fatalf("Backoff(%s, %d) = %s, want %s", tt.base, tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := &Sender{Client: srv.Client()}
+	if err := s.Send(srv.URL, "whsec_test", "deposit.confirmed", "evt_1", []byte(`{"id":"evt_1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get(EventHeader) != "deposit.confirmed" || req.Header.Get(EventIDHeader) != "evt_1" {
+		t.Fatalf("headers = %v", req.Header)
+	}
+	ts, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get(SignatureHeader) != "v1="+Sign("whsec_test", time.Unix(ts, 0), body) {
+		t.Fatalf("signature %s doesn't match the timestamp and the body", req.Header.Get(SignatureHeader))
+	}
+
+	status = http.StatusInternalServerError
+	if err := s.Send(srv.URL, "whsec_test", "deposit.confirmed", "evt_1", nil); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("error = %v, want the status of the endpoint", err)
+	}
+}